@@ -3,13 +3,13 @@ package cmd
 import (
 	"maps"
 	"net/url"
+	"os"
 	"path/filepath"
 	"regexp"
 
 	"github.com/apple/pkl-go/pkl"
 	"github.com/spf13/cobra"
 	"hpkl.io/hpkl/pkg/app"
-	"hpkl.io/hpkl/pkg/pklutils"
 )
 
 func NewResolveCmd(appConfig *app.AppConfig) *cobra.Command {
@@ -41,6 +41,7 @@ func NewResolveCmd(appConfig *app.AppConfig) *cobra.Command {
 	}
 
 	cmd.Flags().BoolVarP(&appConfig.PlainHttp, "plain-http", "p", false, "Use plain http for registry")
+	cmd.Flags().StringVar(&appConfig.LockfileFormat, "lockfile-format", "json", "Format of the written lockfile: json, yaml or toml")
 
 	return cmd
 }
@@ -60,29 +61,6 @@ func CollectLocalDependencies(dependecies *pkl.ProjectDependencies) map[string]*
 	return result
 }
 
-func CollectRemoteDependencies(dependecies *pkl.ProjectDependencies) map[string]app.Dependency {
-	result := make(map[string]app.Dependency)
-
-	for _, dep := range dependecies.LocalDependencies {
-		remote := dep.Dependencies.RemoteDependencies
-
-		for n, remoteDep := range remote {
-			result[remoteDep.PackageUri] = app.Dependency{Uri: remoteDep.PackageUri, Name: n}
-		}
-
-		for _, localDep := range dep.Dependencies.LocalDependencies {
-			inner := CollectRemoteDependencies(localDep.Dependencies)
-			maps.Copy(result, inner)
-		}
-	}
-
-	for n, dep := range dependecies.RemoteDependencies {
-		result[dep.PackageUri] = app.Dependency{Uri: dep.PackageUri, Name: n}
-	}
-
-	return result
-}
-
 func Resolve(appConfig *app.AppConfig) error {
 	resolver, err := app.NewResolver(appConfig)
 	if err != nil {
@@ -90,9 +68,13 @@ func Resolve(appConfig *app.AppConfig) error {
 		return err
 	}
 
+	if useRequirements(appConfig.WorkingDir) {
+		return ResolveRequirements(appConfig, resolver)
+	}
+
 	project := appConfig.Project()
 
-	remoteDependencies := CollectRemoteDependencies(project.Dependencies())
+	remoteDependencies := app.CollectRemoteDependencies(project.Dependencies())
 
 	resolvedDependencies, err := resolver.Resolve(remoteDependencies)
 
@@ -101,50 +83,24 @@ func Resolve(appConfig *app.AppConfig) error {
 		return err
 	}
 
-	resolvedDependencies, err = resolver.Deduplicate(resolvedDependencies)
+	resolvedDependencies, err = resolver.Deduplicate(resolvedDependencies, app.DedupHighestVersion)
 
 	if err != nil {
 		appConfig.Logger.Error("Error on deduplication")
 		return err
 	}
 
-	err = resolver.Download(resolvedDependencies)
+	_, err = resolver.Download(resolvedDependencies)
 
 	if err != nil {
 		return err
 	}
 
-	dependencies := make(map[string]*pklutils.ResolvedDependency, len(resolvedDependencies)+len(project.Dependencies().LocalDependencies))
-
-	projectDeps := pklutils.ProjectDeps{
-		SchemaVersion:        1,
-		ResolvedDependencies: dependencies,
-	}
-
-	for _, dep := range resolvedDependencies {
-
-		mapUri, err := resolver.MajorVersionPackage(dep)
+	projectDeps, err := resolver.Lockfile(resolvedDependencies)
 
-		if err != nil {
-			appConfig.Logger.Error("Error on dependency resolving")
-			return err
-		}
-
-		packageUri, err := url.Parse(dep.PackageUri)
-
-		if err != nil {
-			return err
-		}
-
-		packageUri.Scheme = "projectpackage"
-
-		resolvedDependency := pklutils.ResolvedDependency{
-			DependencyType: "remote",
-			Uri:            packageUri.String(),
-			Checksums:      map[string]string{"sha256": dep.Checksum},
-		}
-
-		projectDeps.ResolvedDependencies[mapUri] = &resolvedDependency
+	if err != nil {
+		appConfig.Logger.Error("Error on dependency resolving")
+		return err
 	}
 
 	projectFileUri, err := url.Parse(project.ProjectFileUri)
@@ -182,7 +138,7 @@ func Resolve(appConfig *app.AppConfig) error {
 			return err
 		}
 
-		resolvedDependency := pklutils.ResolvedDependency{
+		resolvedDependency := app.ResolvedDependency{
 			DependencyType: "local",
 			Path:           rel,
 			Uri:            projectUri.String(),
@@ -190,7 +146,7 @@ func Resolve(appConfig *app.AppConfig) error {
 		projectDeps.ResolvedDependencies[mapUri] = &resolvedDependency
 	}
 
-	err = pklutils.PklWriteDeps(appConfig.WorkingDir, &projectDeps)
+	err = app.WriteLockfile(appConfig.WorkingDir, projectDeps, app.LockfileFormat(appConfig.LockfileFormat))
 	if err != nil {
 		appConfig.Logger.Error("Error on write deps")
 		return err
@@ -198,3 +154,53 @@ func Resolve(appConfig *app.AppConfig) error {
 
 	return nil
 }
+
+// useRequirements reports whether workingDir declares its dependencies in a requirements
+// file instead of a PklProject
+func useRequirements(workingDir string) bool {
+	if _, err := os.Stat(filepath.Join(workingDir, "PklProject")); err == nil {
+		return false
+	}
+
+	_, err := os.Stat(filepath.Join(workingDir, app.RequirementsFile))
+
+	return err == nil
+}
+
+// ResolveRequirements resolves, downloads and locks the dependencies of the requirements
+// file of the working directory
+func ResolveRequirements(appConfig *app.AppConfig, resolver *app.Resolver) error {
+	dependencies, err := app.LoadRequirements(appConfig.WorkingDir)
+
+	if err != nil {
+		appConfig.Logger.Error("Error on reading %s", app.RequirementsFile)
+		return err
+	}
+
+	resolvedDependencies, err := resolver.Resolve(dependencies)
+
+	if err != nil {
+		appConfig.Logger.Error("Error on resolving remote dependencies")
+		return err
+	}
+
+	resolvedDependencies, err = resolver.Deduplicate(resolvedDependencies, app.DedupHighestVersion)
+
+	if err != nil {
+		appConfig.Logger.Error("Error on deduplication")
+		return err
+	}
+
+	if _, err = resolver.Download(resolvedDependencies); err != nil {
+		return err
+	}
+
+	projectDeps, err := resolver.Lockfile(resolvedDependencies)
+
+	if err != nil {
+		appConfig.Logger.Error("Error on dependency resolving")
+		return err
+	}
+
+	return app.WriteLockfile(appConfig.WorkingDir, projectDeps, app.LockfileFormat(appConfig.LockfileFormat))
+}
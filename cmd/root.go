@@ -70,4 +70,9 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&appConfig.CacheDir, "cache-dir", filepath.Join(homeDir, ".pkl/cache"), "The cache directory for storing packages")
 	rootCmd.PersistentFlags().StringVarP(&appConfig.WorkingDir, "working-dir", "w", workingDir, "Base path that relative module paths are resolved against.")
 	rootCmd.PersistentFlags().StringVar(&appConfig.RootDir, "root-dir", "", "Restricts access to file-based modules and resources to those located under the root directory.")
+	rootCmd.PersistentFlags().StringVar(&appConfig.LogLevel, "log-level", "info", "Minimum level of logged messages: debug, info or error")
+
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		return appConfig.ApplyLogLevel()
+	}
 }
@@ -0,0 +1,103 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// AdvisoryKind is a non-ideal path taken while resolving a package
+type AdvisoryKind int
+
+const (
+	// AdvisoryRegistryFallback the package was missing from its registry and served by
+	// another registry of AppConfig.Registries
+	AdvisoryRegistryFallback AdvisoryKind = iota
+	// AdvisoryPlainHttpFallback https failed and the metadata was fetched over plain http
+	AdvisoryPlainHttpFallback
+	// AdvisoryReplaced a replace directive redirected the dependency to another uri or version
+	AdvisoryReplaced
+	// AdvisoryDowngrade a replace directive selected a lower version than the one requested
+	AdvisoryDowngrade
+)
+
+// Advisory reports a non-ideal path taken for the package Uri, so that it can be reviewed
+type Advisory struct {
+	Uri    string
+	Kind   AdvisoryKind
+	Detail string
+}
+
+func (k AdvisoryKind) String() string {
+	switch k {
+	case AdvisoryRegistryFallback:
+		return "registry-fallback"
+	case AdvisoryPlainHttpFallback:
+		return "plain-http-fallback"
+	case AdvisoryReplaced:
+		return "replaced"
+	case AdvisoryDowngrade:
+		return "downgrade"
+	default:
+		return fmt.Sprintf("AdvisoryKind(%d)", int(k))
+	}
+}
+
+func (a Advisory) String() string {
+	return fmt.Sprintf("%s: %s: %s", a.Uri, a.Kind, a.Detail)
+}
+
+// Advisories returns the advisories recorded on the packages resolved by Resolve
+// and downloaded by Download, sorted by uri and kind
+func Advisories(resolved map[string]*Metadata) []Advisory {
+	var advisories []Advisory
+
+	for _, m := range resolved {
+		advisories = append(advisories, m.Advisories...)
+	}
+
+	sort.Slice(advisories, func(i, j int) bool {
+		if c := strings.Compare(advisories[i].Uri, advisories[j].Uri); c != 0 {
+			return c < 0
+		}
+
+		return advisories[i].Kind < advisories[j].Kind
+	})
+
+	return advisories
+}
+
+// advise records an advisory of kind on m, once per kind as metadata is reused from
+// the memory cache across resolutions
+func (m *Metadata) advise(kind AdvisoryKind, format string, args ...any) {
+	for _, advisory := range m.Advisories {
+		if advisory.Kind == kind {
+			return
+		}
+	}
+
+	m.Advisories = append(m.Advisories, Advisory{Uri: m.PackageUri, Kind: kind, Detail: fmt.Sprintf(format, args...)})
+}
+
+// adviseReplaced records that m replaced the dependency requested as requested
+func (m *Metadata) adviseReplaced(requested string) {
+	m.advise(AdvisoryReplaced, "replaced %s", requested)
+
+	_, version, err := SplitPackageUri(requested)
+
+	if err != nil {
+		return
+	}
+
+	from, err := parseVersion(version)
+
+	if err != nil {
+		return
+	}
+
+	to, err := parseVersion(m.Version)
+
+	if err == nil && to.LessThan(from) {
+		m.advise(AdvisoryDowngrade, "version %s is lower than the requested %s", m.Version, version)
+	}
+}
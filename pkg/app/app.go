@@ -2,15 +2,19 @@ package app
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"time"
 
 	"github.com/apple/pkl-go/pkl"
 	"hpkl.io/hpkl/pkg/logger"
-	"hpkl.io/hpkl/pkg/pklutils"
 )
 
 type AppConfig struct {
@@ -23,6 +27,141 @@ type AppConfig struct {
 	WorkingDir      string
 	RootDir         string
 	Parameters      []string
+	// CacheMaxEntries bounds the in-memory metadata cache, 0 means unbounded
+	CacheMaxEntries int
+	// DisableMemoryCache makes resolvers rely on the disk cache only
+	DisableMemoryCache bool
+	// OciReferrers fetches OCI package metadata attached through the referrers API
+	OciReferrers bool
+	// PlainHttpFallbackHosts may be retried over plain http when https fails to connect
+	PlainHttpFallbackHosts []string
+	// Connection pool tuning of the registry http transport, 0 keeps the Go defaults
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	// SignatureMode controls verification of package signatures during download
+	SignatureMode SignatureMode
+	// TrustedKeys are paths to OpenPGP or cosign public keys trusted to sign packages
+	TrustedKeys []string
+	// DownloadConcurrency caps parallel archive downloads, 0 uses the default
+	DownloadConcurrency int
+	// DownloadConcurrencyPerHost caps parallel archive downloads per registry host, 0 means no cap
+	DownloadConcurrencyPerHost int
+	// StrictMetadata rejects package metadata containing unknown fields
+	StrictMetadata bool
+	// RegistryProxyURL routes all registry traffic through a caching proxy
+	RegistryProxyURL string
+	// MetadataOnly guarantees no archive is fetched, for commands working on the dependency graph only
+	MetadataOnly bool
+	// Replace forces dependencies, by package uri with or without version, to another uri or version
+	Replace map[string]string
+	// GithubToken authenticates GitHub API requests of github:// dependencies
+	GithubToken string
+	// GithubApiUrl overrides the GitHub API endpoint, for GitHub Enterprise
+	GithubApiUrl string
+	// FloatingTagTTL is how long the resolution of a floating tag like latest is reused,
+	// 0 re-checks floating tags on every resolution
+	FloatingTagTTL time.Duration
+	// MetadataIndexUrl points to a json array of package metadata served instead of per package requests
+	MetadataIndexUrl string
+	// HttpTokenUrl is an OAuth client credentials endpoint issuing bearer tokens for http registries
+	HttpTokenUrl     string
+	HttpClientId     string
+	HttpClientSecret string
+	// HttpTokenPrefixes are the registries the bearer token is sent to, a host optionally
+	// followed by a path like RegistryCredential.Prefix. Required with HttpTokenUrl.
+	HttpTokenPrefixes []string
+	// DisallowPlainHttp fails resolution and download of anything fetched over plain http
+	DisallowPlainHttp bool
+	// CanonicalChecksum computes metadata checksums over a canonical json form instead of
+	// the raw bytes, Metadata.RawChecksum keeps the raw one available
+	CanonicalChecksum bool
+	// Registries is an ordered list of registry hosts, a package missing from one is looked up on the next
+	Registries []string
+	// RecordProvenance records in the lockfile which registry served each dependency and when
+	RecordProvenance bool
+	// IncludePrereleases lets version selection and deduplication pick pre-releases over stable versions
+	IncludePrereleases bool
+	// LogLevel is the minimum level of logged messages: debug, info or error
+	LogLevel string
+	// MaxResolveDepth bounds the length of dependency chains walked by Resolve, 0 uses a default of 64
+	MaxResolveDepth int
+	// GrpcCaFile is a PEM bundle of the certificate authorities trusted for grpc:// registries,
+	// the system ones are used when empty
+	GrpcCaFile string
+	// GrpcCertFile and GrpcKeyFile are a client certificate presented to grpc:// registries
+	GrpcCertFile string
+	GrpcKeyFile  string
+	// GrpcServerName overrides the server name verified in the certificate of grpc:// registries
+	GrpcServerName string
+	// LockfileFormat is the format of the lockfile written by resolve: json, yaml or toml
+	LockfileFormat string
+	// RegistryTarball is a tar file, optionally gzipped, of every package metadata and archive,
+	// all packages are resolved and downloaded from it without network access
+	RegistryTarball string
+	// ArchiveSchemes overrides, by host, the scheme (http or https) archives of http registries
+	// are fetched with, independently of the scheme their metadata was fetched with
+	ArchiveSchemes map[string]string
+	// ContinueOnError makes Download attempt every package after one failed, returning the
+	// archives downloaded along with the errors of the failed ones
+	ContinueOnError bool
+	// Credentials authenticate http registries by host and path prefix, the most specific
+	// matching credential is used for each request
+	Credentials []RegistryCredential
+	// RedirectPolicy controls redirects of http registries to another host
+	RedirectPolicy RedirectPolicy
+	// RedirectHosts are the hosts http registries may redirect to with RedirectAllowlist
+	RedirectHosts []string
+	// AllowedLicenses are the licenses LicenseReport accepts, any license is accepted when empty
+	AllowedLicenses []string
+	// DeniedLicenses are the licenses LicenseReport flags, even when allowed
+	DeniedLicenses []string
+	// OciLayout is an OCI image layout directory, or oci: uri, oci dependencies are resolved
+	// and downloaded from instead of their registry
+	OciLayout string
+	// MetadataTimeout bounds each metadata request of http and oci registries, 0 means no timeout
+	MetadataTimeout time.Duration
+	// ArchiveTimeout bounds each archive download of http and oci registries, 0 means no timeout
+	ArchiveTimeout time.Duration
+	// Exclude are package uri globs, matched with and without version, transitive dependencies
+	// matching one are not resolved, along with their own dependencies
+	Exclude []string
+	// SameHostArchives rejects http package metadata pointing to an archive on another host
+	// than the metadata, unless that host is listed in ArchiveHosts
+	SameHostArchives bool
+	ArchiveHosts     []string
+	// CacheNaming controls how package uris map to cache file names, CacheNamingPlain keeps
+	// the layout pkl reads, the others are portable to filesystems like the ones of Windows
+	CacheNaming CacheNaming
+	// HttpProtocol forces or disables http/2 with registries over https, by default it is
+	// negotiated when offered
+	HttpProtocol HttpProtocol
+	// ReuseArchives makes Download link an archive already stored under another package
+	// name when the sha256 declared by the metadata matches, instead of fetching it again
+	ReuseArchives bool
+	// Cookies seed the cookie jar of registry requests, by url, cookies set by registries
+	// are kept in the jar for the following requests
+	Cookies map[string][]*http.Cookie
+	// MaxPackages bounds the number of packages a single Resolve or Download handles, 0 means no limit
+	MaxPackages int
+	// MaxDownloadBytes bounds the archive bytes fetched by a single Download, 0 means no limit
+	MaxDownloadBytes int64
+	// MetadataTransform may rewrite the metadata fetched by http and oci registries before it
+	// is cached and used, the checksum is computed over Source as left by the transform
+	MetadataTransform func(*Metadata) error
+	// AcceptLanguage is sent as the Accept-Language header of metadata requests to http
+	// registries serving localized metadata, like descriptions and author names
+	AcceptLanguage string
+	// CacheTiers are cache directories read in order, fastest first, replacing CacheDir. A
+	// package found in a slower tier is copied into the first writable one, the primary
+	// tier, which downloads are stored in.
+	CacheTiers []string
+	// AttestationKey is the path of an armored OpenPGP or PEM ECDSA private key Attest signs
+	// attestations with, they are not signed when empty
+	AttestationKey string
+	// projectKey is the EvaluationCacheKey project was evaluated with, so changing the
+	// working directory or the parameters evaluates the project again
+	projectKey string
 }
 
 const (
@@ -32,17 +171,19 @@ const (
 func (a *AppConfig) ProjectOrErr() (*pkl.Project, error) {
 
 	projectFile := filepath.Join(a.WorkingDir, "PklProject")
+	key := a.EvaluationCacheKey(projectFile)
 
-	if a.project == nil {
+	if a.project == nil || a.projectKey != key {
 		if _, err := os.Stat(projectFile); err == nil {
 
-			proj, err := pklutils.LoadProject(a.ctx, projectFile)
+			proj, err := loadProject(a.ctx, projectFile)
 
 			if err != nil {
 				a.Logger.Error("Project file path: %s", projectFile)
 				return nil, err
 			}
 			a.project = proj
+			a.projectKey = key
 		} else {
 			return nil, errors.New(fmt.Sprintf("PklProject file not found in the working directory %s", a.WorkingDir))
 		}
@@ -60,8 +201,40 @@ func (a *AppConfig) Project() *pkl.Project {
 	return p
 }
 
+// EvaluationCacheKey identifies an evaluation of module within the current project,
+// so results evaluated with different parameters never share a cache entry
+func (a *AppConfig) EvaluationCacheKey(module string) string {
+	parameters := slices.Clone(a.Parameters)
+	slices.Sort(parameters)
+
+	hasher := sha256.New()
+	for _, part := range append([]string{a.WorkingDir, module}, parameters...) {
+		hasher.Write([]byte(part))
+		hasher.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// ApplyLogLevel sets the minimum level of the logger from LogLevel
+func (a *AppConfig) ApplyLogLevel() error {
+	if a.LogLevel == "" {
+		return nil
+	}
+
+	level, err := logger.ParseLevel(a.LogLevel)
+
+	if err != nil {
+		return err
+	}
+
+	a.Logger.SetLevel(level)
+	return nil
+}
+
 func (a *AppConfig) Reset() {
 	a.project = nil
+	a.projectKey = ""
 }
 
 func NewAppConfig(ctx context.Context, outWriter io.Writer, errWriter io.Writer) (*AppConfig, error) {
@@ -0,0 +1,63 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apple/pkl-go/pkl"
+	"hpkl.io/hpkl/pkg/pklutils"
+)
+
+func TestEvaluationCacheKey(t *testing.T) {
+	config := &AppConfig{WorkingDir: "/project", Parameters: []string{"env=dev", "region=eu"}}
+	other := &AppConfig{WorkingDir: "/project", Parameters: []string{"env=prod", "region=eu"}}
+	reordered := &AppConfig{WorkingDir: "/project", Parameters: []string{"region=eu", "env=dev"}}
+	shifted := &AppConfig{WorkingDir: "/project", Parameters: []string{"env=devregion=eu"}}
+
+	key := config.EvaluationCacheKey("main.pkl")
+
+	if key == other.EvaluationCacheKey("main.pkl") {
+		t.Error("expected different parameters to produce different keys")
+	}
+
+	if key == shifted.EvaluationCacheKey("main.pkl") {
+		t.Error("expected parameter boundaries to be part of the key")
+	}
+
+	if key != reordered.EvaluationCacheKey("main.pkl") {
+		t.Error("expected parameter order not to affect the key")
+	}
+
+	if key == config.EvaluationCacheKey("other.pkl") {
+		t.Error("expected different modules to produce different keys")
+	}
+}
+
+func TestProjectEvaluatedPerParameters(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "PklProject"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	evaluations := 0
+	loadProject = func(_ context.Context, path string) (*pkl.Project, error) {
+		evaluations++
+		return &pkl.Project{ProjectFileUri: "file://" + path}, nil
+	}
+	t.Cleanup(func() { loadProject = pklutils.LoadProject })
+
+	config := &AppConfig{WorkingDir: dir, Parameters: []string{"env=dev"}}
+
+	for _, parameters := range [][]string{{"env=dev"}, {"env=dev"}, {"env=prod"}} {
+		config.Parameters = parameters
+		if _, err := config.ProjectOrErr(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if evaluations != 2 {
+		t.Errorf("expected the project to be evaluated again only when the parameters change, got %d evaluations", evaluations)
+	}
+}
@@ -0,0 +1,196 @@
+package app
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+type (
+	// Attestation records the exact bytes every package of a resolved set was resolved
+	// from, for provenance like SLSA. It is signed when AppConfig.AttestationKey is set.
+	Attestation struct {
+		Builder   string                `json:"builder"`
+		CreatedAt string                `json:"createdAt"`
+		Packages  []AttestedPackage     `json:"packages"`
+		Signature *AttestationSignature `json:"signature,omitempty"`
+	}
+
+	// AttestedPackage holds the checksums of a resolved package and where and when it was resolved
+	AttestedPackage struct {
+		Uri string `json:"uri"`
+		// MetadataSha256 is the sha256 of the metadata bytes as served by the registry
+		MetadataSha256 string `json:"metadataSha256"`
+		// ArchiveSha256 is the sha256 of the archive declared by the metadata, in hex
+		ArchiveSha256 string `json:"archiveSha256,omitempty"`
+		ResolvedAt    string `json:"resolvedAt,omitempty"`
+		Registry      string `json:"registry"`
+	}
+
+	// AttestationSignature signs the Payload of an Attestation, as an armored OpenPGP
+	// detached signature or a base64 ASN.1 ECDSA signature of its sha256 like cosign
+	AttestationSignature struct {
+		Format string `json:"format"`
+		Value  string `json:"value"`
+	}
+)
+
+const (
+	attestationPgp    = "pgp"
+	attestationCosign = "cosign"
+)
+
+// Attest records the checksums of the resolved packages deps, as returned by Resolve
+func (r *Resolver) Attest(deps map[string]*Metadata) (Attestation, error) {
+	attestation := Attestation{
+		Builder:   "hpkl-" + Version(),
+		CreatedAt: now().UTC().Format(time.RFC3339),
+		Packages:  make([]AttestedPackage, 0, len(deps)),
+	}
+
+	for uri, m := range deps {
+		pkg := AttestedPackage{
+			Uri:            uri,
+			MetadataSha256: m.RawChecksum(),
+			Registry:       m.Registry,
+		}
+
+		if pkg.Registry == "" {
+			u, err := url.Parse(uri)
+
+			if err != nil {
+				return Attestation{}, err
+			}
+
+			pkg.Registry = u.Host
+		}
+
+		if m.PackageZipChecksums.Sha256 != "" {
+			digest, err := DecodeSha256(m.PackageZipChecksums.Sha256)
+
+			if err != nil {
+				return Attestation{}, fmt.Errorf("%s: %w", uri, err)
+			}
+
+			pkg.ArchiveSha256 = hex.EncodeToString(digest)
+		}
+
+		if !m.ResolvedAt.IsZero() {
+			pkg.ResolvedAt = m.ResolvedAt.UTC().Format(time.RFC3339)
+		}
+
+		attestation.Packages = append(attestation.Packages, pkg)
+	}
+
+	sort.Slice(attestation.Packages, func(i, j int) bool {
+		return attestation.Packages[i].Uri < attestation.Packages[j].Uri
+	})
+
+	if r.config.AttestationKey == "" {
+		return attestation, nil
+	}
+
+	payload, err := attestation.Payload()
+
+	if err != nil {
+		return Attestation{}, err
+	}
+
+	if attestation.Signature, err = signAttestation(r.config.AttestationKey, payload); err != nil {
+		return Attestation{}, fmt.Errorf("signing attestation with %s: %w", r.config.AttestationKey, err)
+	}
+
+	return attestation, nil
+}
+
+// Payload returns the json document the signature of the attestation covers, the
+// attestation without its signature
+func (a Attestation) Payload() ([]byte, error) {
+	a.Signature = nil
+	return json.Marshal(a)
+}
+
+// signAttestation signs payload with an armored OpenPGP private key or a PEM encoded
+// ECDSA private key, the kinds of keys TrustedKeys verifies
+func signAttestation(keyPath string, payload []byte) (*AttestationSignature, error) {
+	data, err := os.ReadFile(keyPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Contains(data, []byte("BEGIN PGP PRIVATE KEY BLOCK")) {
+		entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(entities) == 0 || entities[0].PrivateKey == nil || entities[0].PrivateKey.Encrypted {
+			return nil, errors.New("an unencrypted OpenPGP private key is required")
+		}
+
+		var signature bytes.Buffer
+		if err := openpgp.ArmoredDetachSign(&signature, entities[0], bytes.NewReader(payload), nil); err != nil {
+			return nil, err
+		}
+
+		return &AttestationSignature{Format: attestationPgp, Value: signature.String()}, nil
+	}
+
+	block, _ := pem.Decode(data)
+
+	if block == nil {
+		return nil, errors.New("neither an OpenPGP nor a PEM private key")
+	}
+
+	key, err := parseEcdsaPrivateKey(block.Bytes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256(payload)
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &AttestationSignature{Format: attestationCosign, Value: base64.StdEncoding.EncodeToString(signature)}, nil
+}
+
+// parseEcdsaPrivateKey parses a SEC 1 or PKCS #8 encoded ECDSA private key
+func parseEcdsaPrivateKey(der []byte) (*ecdsa.PrivateKey, error) {
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(der)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ecdsaKey, ok := key.(*ecdsa.PrivateKey)
+
+	if !ok {
+		return nil, errors.New("cosign keys must be ECDSA")
+	}
+
+	return ecdsaKey, nil
+}
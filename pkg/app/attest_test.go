@@ -0,0 +1,156 @@
+package app
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/google/go-cmp/cmp"
+)
+
+func attestationFixture() map[string]*Metadata {
+	archive := sha256.Sum256([]byte("archive"))
+	resolvedAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	return map[string]*Metadata{
+		"package://example.com/lib@1.0.0": {
+			Name:                "lib",
+			PackageUri:          "package://example.com/lib@1.0.0",
+			PackageZipChecksums: Checksums{Sha256: "sha256:" + base64.StdEncoding.EncodeToString(archive[:])},
+			Source:              []byte(`{"name":"lib"}`),
+			ResolvedAt:          resolvedAt,
+			Registry:            "mirror.example.com",
+		},
+		"package://example.com/app@1.0.0": {
+			Name:       "app",
+			PackageUri: "package://example.com/app@1.0.0",
+			Source:     []byte(`{"name":"app"}`),
+		},
+	}
+}
+
+func TestAttest(t *testing.T) {
+	now = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+	t.Cleanup(func() { now = time.Now })
+
+	attestation, err := newTestResolver(t).Attest(attestationFixture())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := func(data string) string {
+		sum := sha256.Sum256([]byte(data))
+		return hex.EncodeToString(sum[:])
+	}
+
+	expected := []AttestedPackage{
+		{Uri: "package://example.com/app@1.0.0", MetadataSha256: digest(`{"name":"app"}`), Registry: "example.com"},
+		{
+			Uri:            "package://example.com/lib@1.0.0",
+			MetadataSha256: digest(`{"name":"lib"}`),
+			ArchiveSha256:  digest("archive"),
+			ResolvedAt:     "2024-05-01T10:00:00Z",
+			Registry:       "mirror.example.com",
+		},
+	}
+
+	if diff := cmp.Diff(expected, attestation.Packages); diff != "" {
+		t.Errorf("unexpected attested packages (-expected +actual):\n%s", diff)
+	}
+
+	if attestation.CreatedAt != "2024-05-01T12:00:00Z" || attestation.Signature != nil {
+		t.Errorf("expected an unsigned attestation created now, got %+v", attestation)
+	}
+}
+
+func TestAttestSigned(t *testing.T) {
+	dir := t.TempDir()
+
+	entity, err := openpgp.NewEntity("hpkl", "test", "test@hpkl.io", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var private bytes.Buffer
+	w, err := armor.Encode(&private, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.SerializePrivate(w, nil); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	pgpKey := filepath.Join(dir, "private.asc")
+	if err := os.WriteFile(pgpKey, private.Bytes(), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalECPrivateKey(ecdsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cosignKey := filepath.Join(dir, "cosign.key")
+	if err := os.WriteFile(cosignKey, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		key    string
+		verify func(payload []byte, signature string) bool
+	}{
+		{"pgp", pgpKey, func(payload []byte, signature string) bool {
+			_, err := openpgp.CheckArmoredDetachedSignature(openpgp.EntityList{entity}, bytes.NewReader(payload), strings.NewReader(signature), nil)
+			return err == nil
+		}},
+		{"cosign", cosignKey, func(payload []byte, signature string) bool {
+			sig, err := base64.StdEncoding.DecodeString(signature)
+			digest := sha256.Sum256(payload)
+			return err == nil && ecdsa.VerifyASN1(&ecdsaKey.PublicKey, digest[:], sig)
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestResolver(t, func(config *AppConfig) {
+				config.AttestationKey = tt.key
+			})
+
+			attestation, err := r.Attest(attestationFixture())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if attestation.Signature == nil || attestation.Signature.Format != tt.name {
+				t.Fatalf("expected a %s signature, got %+v", tt.name, attestation.Signature)
+			}
+
+			payload, err := attestation.Payload()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !tt.verify(payload, attestation.Signature.Value) {
+				t.Error("expected the signature to verify against the payload")
+			}
+		})
+	}
+}
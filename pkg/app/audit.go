@@ -0,0 +1,112 @@
+package app
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+type (
+	// AuditFinding is a cached package whose archive failed verification
+	AuditFinding struct {
+		Uri  string `json:"uri"`
+		Path string `json:"path"`
+		Err  error  `json:"-"`
+	}
+
+	// auditJob is a cached archive to verify against the checksum of its metadata
+	auditJob struct {
+		uri         string
+		metaPath    string
+		archivePath string
+	}
+)
+
+// Audit re-verifies every archive of the cache against the checksum of its metadata.
+// Archives are hashed concurrently, one worker per CPU.
+func (r *Resolver) Audit() ([]AuditFinding, error) {
+	cached, err := r.ListCached()
+
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]auditJob, len(cached))
+
+	for i, pkg := range cached {
+		base := filepath.Join(pkg.Path, filepath.Base(pkg.Path))
+		jobs[i] = auditJob{uri: pkg.Uri, metaPath: base + ".json", archivePath: base + ".zip"}
+	}
+
+	findings := verifyArchives(jobs, runtime.NumCPU())
+
+	for _, finding := range findings {
+		r.config.Logger.Error("Audit failed for %s: %s", finding.Uri, finding.Err)
+	}
+
+	return findings, nil
+}
+
+// verifyArchives hashes the archives of jobs with a pool of workers and returns
+// the failures sorted by package uri
+func verifyArchives(jobs []auditJob, workers int) []AuditFinding {
+	queue := make(chan auditJob)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var findings []AuditFinding
+
+	for i := 0; i < max(workers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				if err := job.verify(); err != nil {
+					mu.Lock()
+					findings = append(findings, AuditFinding{Uri: job.uri, Path: job.archivePath, Err: err})
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, job := range jobs {
+		queue <- job
+	}
+
+	close(queue)
+	wg.Wait()
+
+	sort.Slice(findings, func(i, j int) bool {
+		return findings[i].Uri < findings[j].Uri
+	})
+
+	return findings
+}
+
+func (job auditJob) verify() error {
+	data, err := os.ReadFile(job.metaPath)
+
+	if err != nil {
+		return err
+	}
+
+	var metadata Metadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return err
+	}
+
+	if metadata.PackageZipChecksums.Sha256 == "" {
+		return nil
+	}
+
+	archive, err := os.ReadFile(job.archivePath)
+
+	if err != nil {
+		return err
+	}
+
+	return VerifySha256(archive, metadata.PackageZipChecksums.Sha256)
+}
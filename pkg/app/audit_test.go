@@ -0,0 +1,85 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// seedVerifiedCache writes a package with the archive checksum recorded in its metadata
+func seedVerifiedCache(t testing.TB, basePath string, name string, archive []byte) auditJob {
+	dir := filepath.Join(basePath, "example.com", name+"@1.0.0")
+	base := filepath.Join(dir, name+"@1.0.0")
+	sum := sha256.Sum256(archive)
+
+	data, err := json.Marshal(Metadata{
+		Name:                name,
+		Version:             "1.0.0",
+		PackageUri:          "package://example.com/" + name + "@1.0.0",
+		PackageZipChecksums: Checksums{Sha256: hex.EncodeToString(sum[:])},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(base+".json", data, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(base+".zip", archive, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	return auditJob{uri: "package://example.com/" + name + "@1.0.0", metaPath: base + ".json", archivePath: base + ".zip"}
+}
+
+func TestAudit(t *testing.T) {
+	r := newTestResolver(t)
+
+	seedVerifiedCache(t, r.basePath, "intact", []byte("intact"))
+	corrupted := seedVerifiedCache(t, r.basePath, "corrupted", []byte("corrupted"))
+
+	if err := os.WriteFile(corrupted.archivePath, []byte("tampered"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	findings, err := r.Audit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(findings) != 1 || findings[0].Uri != corrupted.uri || findings[0].Err == nil {
+		t.Errorf("expected only %s to fail the audit, got %+v", corrupted.uri, findings)
+	}
+}
+
+func BenchmarkVerifyArchives(b *testing.B) {
+	basePath := b.TempDir()
+	archive := make([]byte, 4<<20)
+	jobs := make([]auditJob, 64)
+
+	for i := range jobs {
+		jobs[i] = seedVerifiedCache(b, basePath, fmt.Sprintf("pkg%d", i), archive)
+	}
+
+	b.Run("serial", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			verifyArchives(jobs, 1)
+		}
+	})
+
+	b.Run("parallel", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			verifyArchives(jobs, runtime.NumCPU())
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// blobsDir holds package archives keyed by their sha256 digest, which is also
+// the OCI layer digest, package directories link to the blobs instead of
+// storing their own copy so that identical archives are kept only once
+const blobsDir = "blobs"
+
+// storeArchive writes archive into the blob store unless it is already there
+// and links it into archivePath
+func (r *Resolver) storeArchive(archivePath string, archive []byte) error {
+	r.blobMu.Lock()
+	defer r.blobMu.Unlock()
+
+	sum := sha256.Sum256(archive)
+	blobPath := filepath.Join(r.basePath, blobsDir, "sha256", hex.EncodeToString(sum[:])+".zip")
+
+	if _, err := os.Stat(blobPath); errors.Is(err, os.ErrNotExist) {
+		if err := os.MkdirAll(filepath.Dir(blobPath), os.ModePerm); err != nil {
+			return err
+		}
+
+		if err := writeFile(blobPath, archive, os.ModePerm); err != nil {
+			os.Remove(blobPath)
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	if err := os.Link(blobPath, archivePath); err != nil {
+		r.config.Logger.Error("Linking %s to %s failed, storing a copy: %s", archivePath, blobPath, err)
+		return writeFile(archivePath, archive, os.ModePerm)
+	}
+
+	return nil
+}
+
+// storedBlob reads the archive of m from the blob store when AppConfig.ReuseArchives is
+// set and a package of another name already stored an archive with the sha256 m declares
+func (r *Resolver) storedBlob(m *Metadata) ([]byte, bool) {
+	if !r.config.ReuseArchives || m.PackageZipChecksums.Sha256 == "" {
+		return nil, false
+	}
+
+	digest, err := DecodeSha256(m.PackageZipChecksums.Sha256)
+
+	if err != nil {
+		return nil, false
+	}
+
+	r.blobMu.Lock()
+	defer r.blobMu.Unlock()
+
+	archive, err := os.ReadFile(filepath.Join(r.basePath, blobsDir, "sha256", hex.EncodeToString(digest)+".zip"))
+
+	if err != nil {
+		return nil, false
+	}
+
+	return archive, true
+}
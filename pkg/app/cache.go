@@ -0,0 +1,191 @@
+package app
+
+import (
+	"container/list"
+	"sync"
+)
+
+type (
+	// metadataCache keeps resolved metadata in memory. When maxEntries is
+	// positive the least recently used entries are evicted once the limit is
+	// reached, when it is negative nothing is stored at all. It is safe for
+	// concurrent use since resolvers scoped by ResolveContext and resolvers
+	// created WithMetadataStore share it.
+	metadataCache struct {
+		mu         sync.Mutex
+		maxEntries int
+		entries    map[string]*list.Element
+		order      *list.List
+	}
+
+	// dependencyClosures remembers the transitive closure of the packages resolved at
+	// the top level, by package uri. Like metadataCache it evicts the least recently
+	// used closures beyond maxEntries and stores nothing when maxEntries is negative.
+	// It is safe for concurrent use since resolvers scoped by ResolveContext share it.
+	dependencyClosures struct {
+		mu         sync.Mutex
+		maxEntries int
+		entries    map[string]*list.Element
+		order      *list.List
+	}
+
+	dependencyClosure struct {
+		uri     string
+		members []string
+		// replaced holds the uri a replace directive redirected, by member
+		replaced map[string]string
+	}
+
+	metadataCacheEntry struct {
+		uri      string
+		metadata *Metadata
+	}
+
+	// MetadataStore is an in-memory metadata cache shared by the resolvers created
+	// WithMetadataStore, so hot metadata outlives the resolver that fetched it. The
+	// least recently used entries are evicted beyond maxEntries, 0 means unbounded.
+	MetadataStore struct {
+		cache *metadataCache
+	}
+)
+
+func NewMetadataStore(maxEntries int) *MetadataStore {
+	return &MetadataStore{cache: newMetadataCache(max(maxEntries, 0))}
+}
+
+// WithMetadataStore makes the resolver keep metadata in store instead of a cache of its own
+func WithMetadataStore(store *MetadataStore) ResolverOption {
+	return func(r *Resolver) {
+		r.cache = store.cache
+		r.closures = newDependencyClosures(store.cache.maxEntries)
+	}
+}
+
+// Len returns the number of metadata entries in the store
+func (s *MetadataStore) Len() int {
+	return s.cache.Len()
+}
+
+func newMetadataCache(maxEntries int) *metadataCache {
+	return &metadataCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+func (c *metadataCache) Get(uri string) (*Metadata, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[uri]
+
+	if !ok {
+		return nil, false
+	}
+
+	metadata := element.Value.(*metadataCacheEntry).metadata
+
+	if metadata.expired() {
+		c.order.Remove(element)
+		delete(c.entries, uri)
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	return metadata, true
+}
+
+func (c *metadataCache) Put(uri string, metadata *Metadata) {
+	if c.maxEntries < 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[uri]; ok {
+		element.Value.(*metadataCacheEntry).metadata = metadata
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[uri] = c.order.PushFront(&metadataCacheEntry{uri: uri, metadata: metadata})
+
+	if c.maxEntries > 0 {
+		for c.order.Len() > c.maxEntries {
+			oldest := c.order.Back()
+			c.order.Remove(oldest)
+			delete(c.entries, oldest.Value.(*metadataCacheEntry).uri)
+		}
+	}
+}
+
+func (c *metadataCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func newDependencyClosures(maxEntries int) *dependencyClosures {
+	return &dependencyClosures{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+func (c *dependencyClosures) get(uri string) (*dependencyClosure, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[uri]
+
+	if !ok {
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	return element.Value.(*dependencyClosure), true
+}
+
+// add records the closure of uri unless a concurrent walk recorded it first
+func (c *dependencyClosures) add(uri string, members []string, replaced map[string]string) {
+	if c.maxEntries < 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[uri]; ok {
+		return
+	}
+
+	c.entries[uri] = c.order.PushFront(&dependencyClosure{uri: uri, members: members, replaced: replaced})
+
+	if c.maxEntries > 0 {
+		for c.order.Len() > c.maxEntries {
+			oldest := c.order.Back()
+			c.order.Remove(oldest)
+			delete(c.entries, oldest.Value.(*dependencyClosure).uri)
+		}
+	}
+}
+
+// remove forgets the closure of uri, once part of it has been evicted from the metadata cache
+func (c *dependencyClosures) remove(uri string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[uri]; ok {
+		c.order.Remove(element)
+		delete(c.entries, uri)
+	}
+}
+
+func (c *dependencyClosures) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
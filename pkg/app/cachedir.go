@@ -0,0 +1,306 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"hpkl.io/hpkl/pkg/logger"
+)
+
+type CachedPackage struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Uri     string `json:"uri"`
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+}
+
+// ListCached returns every complete package stored in the resolver cache
+func (r *Resolver) ListCached() ([]CachedPackage, error) {
+	return listCached(r.basePath, r.config.Logger)
+}
+
+func listCached(basePath string, logger *logger.Logger) ([]CachedPackage, error) {
+	var result []CachedPackage
+
+	if _, err := os.Stat(basePath); os.IsNotExist(err) {
+		return result, nil
+	}
+
+	err := filepath.WalkDir(basePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".json") {
+			return nil
+		}
+
+		cached, err := readCachedPackage(basePath, path)
+
+		if err != nil {
+			logger.Error("Skipping cache entry %s: %s", path, err)
+			return nil
+		}
+
+		result = append(result, *cached)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Uri < result[j].Uri
+	})
+
+	return result, nil
+}
+
+// UnusedCached returns the cached packages lockfile does not reference, which can be
+// removed without affecting the project, without removing them
+func (r *Resolver) UnusedCached(lockfile *ProjectDependencies) ([]CachedPackage, error) {
+	cached, err := r.ListCached()
+
+	if err != nil {
+		return nil, err
+	}
+
+	locked := make(map[string]bool, len(lockfile.ResolvedDependencies))
+
+	for _, dependency := range lockfile.ResolvedDependencies {
+		if dependency.DependencyType != "remote" {
+			continue
+		}
+
+		u, err := url.Parse(dependency.Uri)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid locked uri %s: %w", dependency.Uri, err)
+		}
+
+		u.Scheme = "package"
+		locked[lockedPackageKey(u.String())] = true
+	}
+
+	unused := make([]CachedPackage, 0)
+
+	for _, pkg := range cached {
+		if !locked[lockedPackageKey(pkg.Uri)] {
+			unused = append(unused, pkg)
+		}
+	}
+
+	return unused, nil
+}
+
+// lockedPackageKey identifies the package uri regardless of a leading v in its version
+func lockedPackageKey(uri string) string {
+	base, version, err := SplitPackageUri(uri)
+
+	if err != nil {
+		return uri
+	}
+
+	return base + "@" + normalizeVersion(version)
+}
+
+type CacheDiffKind int
+
+const (
+	// OnlyInA packages are cached in the first directory only
+	OnlyInA CacheDiffKind = iota
+	// OnlyInB packages are cached in the second directory only
+	OnlyInB
+	// ChecksumMismatch packages are cached in both directories with different archives
+	ChecksumMismatch
+)
+
+// CacheDiff is a package that differs between two cache directories
+type CacheDiff struct {
+	Uri       string        `json:"uri"`
+	Kind      CacheDiffKind `json:"kind"`
+	ChecksumA string        `json:"checksumA,omitempty"`
+	ChecksumB string        `json:"checksumB,omitempty"`
+}
+
+// DiffCaches compares the packages of two cache directories, reporting packages
+// cached in only one of them and packages whose archives differ
+func DiffCaches(dirA string, dirB string) ([]CacheDiff, error) {
+	checksumsA, err := cachedChecksums(dirA)
+
+	if err != nil {
+		return nil, err
+	}
+
+	checksumsB, err := cachedChecksums(dirB)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []CacheDiff
+
+	for uri, checksumA := range checksumsA {
+		checksumB, ok := checksumsB[uri]
+
+		if !ok {
+			diffs = append(diffs, CacheDiff{Uri: uri, Kind: OnlyInA, ChecksumA: checksumA})
+		} else if checksumA != checksumB {
+			diffs = append(diffs, CacheDiff{Uri: uri, Kind: ChecksumMismatch, ChecksumA: checksumA, ChecksumB: checksumB})
+		}
+	}
+
+	for uri, checksumB := range checksumsB {
+		if _, ok := checksumsA[uri]; !ok {
+			diffs = append(diffs, CacheDiff{Uri: uri, Kind: OnlyInB, ChecksumB: checksumB})
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].Uri != diffs[j].Uri {
+			return diffs[i].Uri < diffs[j].Uri
+		}
+		return diffs[i].Kind < diffs[j].Kind
+	})
+
+	return diffs, nil
+}
+
+// cachedChecksums returns the sha256 of the archive of every package cached in cacheDir
+func cachedChecksums(cacheDir string) (map[string]string, error) {
+	cached, err := listCached(filepath.Join(cacheDir, "package-2"), logger.New(io.Discard, io.Discard))
+
+	if err != nil {
+		return nil, err
+	}
+
+	checksums := make(map[string]string, len(cached))
+
+	for _, pkg := range cached {
+		archive, err := os.ReadFile(filepath.Join(pkg.Path, filepath.Base(pkg.Path)+".zip"))
+
+		if err != nil {
+			return nil, err
+		}
+
+		sum := sha256.Sum256(archive)
+		checksums[pkg.Uri] = hex.EncodeToString(sum[:])
+	}
+
+	return checksums, nil
+}
+
+// loadCachedMetadata reads the metadata of dependency from a complete package in
+// the cache directory. Floating uris are never served from disk.
+func (r *Resolver) loadCachedMetadata(dependency Dependency) (*Metadata, bool) {
+	if isFloatingUri(dependency.Uri) {
+		return nil, false
+	}
+
+	u, err := url.Parse(dependency.Uri)
+
+	if err != nil {
+		return nil, false
+	}
+
+	dir := cacheDir(r.config.CacheNaming, r.basePath, u)
+	metaPath := filepath.Join(dir, filepath.Base(dir)+".json")
+
+	// secondary cache tiers are only read here, Download promotes their packages
+	if _, err := os.Stat(strings.TrimSuffix(metaPath, ".json") + ".zip"); err != nil {
+		tier, ok := r.tierDir(u)
+
+		if !ok {
+			return nil, false
+		}
+
+		metaPath = filepath.Join(tier, filepath.Base(dir)+".json")
+	}
+
+	data, err := os.ReadFile(metaPath)
+
+	if err != nil {
+		return nil, false
+	}
+
+	metadata, err := decodeMetadata(data, r.config.StrictMetadata)
+
+	if err != nil {
+		r.config.Logger.Error("Ignoring cached metadata %s: %s", metaPath, err)
+		return nil, false
+	}
+
+	sum := sha256.Sum256(data)
+
+	metadata.ResolverType = HTTP
+	if isGithubUri(dependency.Uri) {
+		metadata.ResolverType = GITHUB
+	} else if isGrpcUri(dependency.Uri) {
+		metadata.ResolverType = GRPC
+		metadata.PackageZipUrl = dependency.Uri
+	} else if strings.HasSuffix(dependency.Name, ".oci") {
+		metadata.ResolverType = OCI
+	}
+	metadata.PlainHttp = strings.Contains(dependency.Name, ".plain")
+	if metadata.ResolverType == GRPC {
+		metadata.PlainHttp = metadata.PlainHttp || r.config.PlainHttp
+	}
+	metadata.Source = data
+	metadata.Checksum = hex.EncodeToString(sum[:])
+	nameDependencies(metadata)
+
+	return metadata, true
+}
+
+func readCachedPackage(basePath string, metaPath string) (*CachedPackage, error) {
+	dir := filepath.Dir(metaPath)
+	archivePath := strings.TrimSuffix(metaPath, ".json") + ".zip"
+
+	archiveInfo, err := os.Stat(archivePath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	metaInfo, err := os.Stat(metaPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(metaPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata Metadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, err
+	}
+
+	rel, err := filepath.Rel(basePath, dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &CachedPackage{
+		Name:    metadata.Name,
+		Version: metadata.Version,
+		Uri:     cachedUri(rel, &metadata),
+		Path:    dir,
+		Size:    archiveInfo.Size() + metaInfo.Size(),
+	}, nil
+}
@@ -0,0 +1,152 @@
+package app
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"hpkl.io/hpkl/pkg/logger"
+)
+
+// seedCache writes a package into a cache base path the way Download lays it out
+func seedCache(t *testing.T, basePath string, host string, name string, version string, archive []byte) string {
+	dir := filepath.Join(basePath, host, name+"@"+version)
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(Metadata{Name: name, Version: version, PackageUri: "package://" + host + "/" + name + "@" + version})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, name+"@"+version+".json"), data, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if archive != nil {
+		if err := os.WriteFile(filepath.Join(dir, name+"@"+version+".zip"), archive, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestListCached(t *testing.T) {
+	errWriter := new(bytes.Buffer)
+	r := newTestResolver(t)
+	r.config.Logger = logger.New(new(bytes.Buffer), errWriter)
+
+	first := seedCache(t, r.basePath, "example.com", "first", "1.0.0", []byte("12345"))
+	second := seedCache(t, r.basePath, "example.com", "second", "2.1.0", []byte("1"))
+	seedCache(t, r.basePath, "example.com", "partial", "1.0.0", nil)
+
+	garbage := filepath.Join(r.basePath, "example.com", "garbage@1.0.0")
+	os.MkdirAll(garbage, os.ModePerm)
+	os.WriteFile(filepath.Join(garbage, "garbage@1.0.0.json"), []byte("{not json"), os.ModePerm)
+	os.WriteFile(filepath.Join(garbage, "garbage@1.0.0.zip"), []byte("zip"), os.ModePerm)
+
+	actual, err := r.ListCached()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metaSize := func(dir string, file string) int64 {
+		info, err := os.Stat(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Size()
+	}
+
+	expected := []CachedPackage{
+		{Name: "first", Version: "1.0.0", Uri: "package://example.com/first@1.0.0", Path: first, Size: 5 + metaSize(first, "first@1.0.0.json")},
+		{Name: "second", Version: "2.1.0", Uri: "package://example.com/second@2.1.0", Path: second, Size: 1 + metaSize(second, "second@2.1.0.json")},
+	}
+
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error(diff)
+	}
+
+	if !bytes.Contains(errWriter.Bytes(), []byte("garbage@1.0.0.json")) || !bytes.Contains(errWriter.Bytes(), []byte("partial@1.0.0.json")) {
+		t.Errorf("expected warnings for skipped entries, got %q", errWriter.String())
+	}
+}
+
+func TestDiffCaches(t *testing.T) {
+	dirA, dirB := t.TempDir(), t.TempDir()
+	baseA, baseB := filepath.Join(dirA, "package-2"), filepath.Join(dirB, "package-2")
+
+	seedCache(t, baseA, "example.com", "shared", "1.0.0", []byte("shared"))
+	seedCache(t, baseB, "example.com", "shared", "1.0.0", []byte("shared"))
+	seedCache(t, baseA, "example.com", "drifted", "1.0.0", []byte("mine"))
+	seedCache(t, baseB, "example.com", "drifted", "1.0.0", []byte("theirs"))
+	seedCache(t, baseA, "example.com", "lib", "1.0.0", []byte("lib"))
+	seedCache(t, baseB, "example.com", "lib", "1.1.0", []byte("lib"))
+
+	diffs, err := DiffCaches(dirA, dirB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checksum := func(data string) string {
+		sum := sha256.Sum256([]byte(data))
+		return hex.EncodeToString(sum[:])
+	}
+
+	expected := []CacheDiff{
+		{Uri: "package://example.com/drifted@1.0.0", Kind: ChecksumMismatch, ChecksumA: checksum("mine"), ChecksumB: checksum("theirs")},
+		{Uri: "package://example.com/lib@1.0.0", Kind: OnlyInA, ChecksumA: checksum("lib")},
+		{Uri: "package://example.com/lib@1.1.0", Kind: OnlyInB, ChecksumB: checksum("lib")},
+	}
+
+	if diff := cmp.Diff(expected, diffs); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestUnusedCached(t *testing.T) {
+	r := newTestResolver(t)
+
+	seedCache(t, r.basePath, "example.com", "used", "1.0.0", []byte("used"))
+	outdated := seedCache(t, r.basePath, "example.com", "used", "0.9.0", []byte("outdated"))
+	orphan := seedCache(t, r.basePath, "example.com", "orphan", "1.0.0", []byte("orphan"))
+
+	lockfile := &ProjectDependencies{
+		SchemaVersion: 1,
+		ResolvedDependencies: map[string]*ResolvedDependency{
+			"package://example.com/used@1":  {DependencyType: "remote", Uri: "projectpackage://example.com/used@1.0.0"},
+			"package://example.com/local@1": {DependencyType: "local", Uri: "projectpackage://example.com/local@1.0.0", Path: "../local"},
+		},
+	}
+
+	unused, err := r.UnusedCached(lockfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var actual []string
+	for _, pkg := range unused {
+		actual = append(actual, pkg.Path)
+	}
+
+	if diff := cmp.Diff([]string{orphan, outdated}, actual); diff != "" {
+		t.Errorf("unexpected unused packages (-expected +actual):\n%s", diff)
+	}
+
+	cached, err := r.ListCached()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cached) != 3 {
+		t.Errorf("expected the cache to be left untouched, got %d packages", len(cached))
+	}
+}
@@ -0,0 +1,92 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"hpkl.io/hpkl/pkg/pklutils"
+)
+
+// CacheNaming controls how package uris map to directories and files of the cache
+type CacheNaming int
+
+const (
+	// CacheNamingPlain mirrors the package uri as host/path/name@version, the layout pkl reads
+	CacheNamingPlain CacheNaming = iota
+	// CacheNamingEscape percent-encodes the characters of the package uri that are not
+	// allowed in file names on some filesystems, like ':' on Windows, and spaces
+	CacheNamingEscape
+	// CacheNamingHash stores every package in a single directory named after the sha256
+	// of its versioned uri
+	CacheNamingHash
+)
+
+// unsafeFileChars are escaped by CacheNamingEscape, along with control characters
+const unsafeFileChars = `<>:"/\|?*% `
+
+// cacheDir returns the cache directory of the package uri u below basePath
+func cacheDir(naming CacheNaming, basePath string, u *url.URL) string {
+	switch naming {
+	case CacheNamingEscape:
+		segments := []string{basePath, escapeFileName(u.Host)}
+
+		for _, segment := range strings.Split(strings.Trim(u.Path, "/"), "/") {
+			segments = append(segments, escapeFileName(segment))
+		}
+
+		return filepath.Join(segments...)
+	case CacheNamingHash:
+		sum := sha256.Sum256([]byte(u.Host + u.Path))
+		return filepath.Join(basePath, hex.EncodeToString(sum[:]))
+	default:
+		return pklutils.PklGetRelativePath(basePath, u)
+	}
+}
+
+// escapeFileName percent-encodes the characters of name not portable in file names.
+// A trailing dot, dropped by Windows, is escaped as well.
+func escapeFileName(name string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+
+		if c < 0x20 || c == 0x7f || strings.IndexByte(unsafeFileChars, c) >= 0 || (c == '.' && i == len(name)-1) {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+// cachedUri returns the package uri of the cache directory rel, relative to the base
+// path, written with any CacheNaming. Hashed directories are resolved through the
+// packageUri of their metadata.
+func cachedUri(rel string, metadata *Metadata) string {
+	rel = filepath.ToSlash(rel)
+
+	if isHashedDir(rel) && metadata.PackageUri != "" {
+		return metadata.PackageUri
+	}
+
+	if unescaped, err := url.PathUnescape(rel); err == nil {
+		rel = unescaped
+	}
+
+	return "package://" + rel
+}
+
+func isHashedDir(rel string) bool {
+	if len(rel) != sha256.Size*2 {
+		return false
+	}
+
+	_, err := hex.DecodeString(rel)
+	return err == nil
+}
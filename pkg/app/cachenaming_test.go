@@ -0,0 +1,91 @@
+package app
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCacheNamingPortableFileNames(t *testing.T) {
+	uri := "package://registry.example.com:8443/team one/lib:core@1.0.0"
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, naming := range map[string]CacheNaming{"escape": CacheNamingEscape, "hash": CacheNamingHash} {
+		t.Run(name, func(t *testing.T) {
+			basePath := t.TempDir()
+			dir := cacheDir(naming, basePath, u)
+
+			rel, err := filepath.Rel(basePath, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, element := range strings.Split(rel, string(filepath.Separator)) {
+				if strings.ContainsAny(element, `<>:"/\|?* `) {
+					t.Errorf("expected a portable file name, got %q in %s", element, rel)
+				}
+			}
+
+			if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := os.WriteFile(filepath.Join(dir, filepath.Base(dir)+".zip"), []byte("zip"), os.ModePerm); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := cachedUri(rel, &Metadata{PackageUri: uri}); got != uri {
+				t.Errorf("expected the cache directory to map back to %s, got %s", uri, got)
+			}
+		})
+	}
+}
+
+func TestDownloadWithEscapedCacheNames(t *testing.T) {
+	reg := newTestRegistry(t)
+	dep := reg.add(t, "lib", "1.0.0", []byte("lib"))
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.CacheNaming = CacheNamingEscape
+	})
+
+	resolved, err := r.Resolve(dependencySet(dep))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := r.Download(resolved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rel, err := filepath.Rel(r.basePath, paths[dep.Uri])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the host of the test registry carries a port
+	if strings.Contains(rel, ":") {
+		t.Errorf("expected the port separator to be escaped, got %s", rel)
+	}
+
+	cached, err := r.ListCached()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cached) != 1 || cached[0].Uri != dep.Uri {
+		t.Errorf("expected %s to be listed, got %v", dep.Uri, cached)
+	}
+
+	metadata, ok := r.loadCachedMetadata(Dependency{Uri: dep.Uri, Name: "lib"})
+	if !ok || metadata.Name != "lib" {
+		t.Errorf("expected the cached metadata of %s to be found, got %v", dep.Uri, metadata)
+	}
+}
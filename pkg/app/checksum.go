@@ -0,0 +1,238 @@
+package app
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	sha256Prefix = "sha256:"
+	sha512Prefix = "sha512:"
+)
+
+// ErrChecksumDowngrade is returned when a registry no longer offers the checksum
+// algorithm pinned by the lockfile, only weaker ones
+var ErrChecksumDowngrade = errors.New("checksum algorithm downgrade")
+
+// ErrChecksumMismatch is returned when data does not match its expected digest
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// ErrUnknownChecksumAlgorithm is returned when a digest uses an algorithm no hash is registered for
+var ErrUnknownChecksumAlgorithm = errors.New("unknown checksum algorithm")
+
+var (
+	checksumAlgorithmsMu sync.RWMutex
+	// checksumAlgorithms are the hashes of the algorithms of Checksums.Digests by name
+	checksumAlgorithms = map[string]func() hash.Hash{
+		"sha256": sha256.New,
+		"sha512": sha512.New,
+	}
+)
+
+// RegisterChecksumAlgorithm makes the digests of algorithm in Checksums.Digests verified
+// with the hash returned by constructor, replacing any hash registered before
+func RegisterChecksumAlgorithm(algorithm string, constructor func() hash.Hash) {
+	checksumAlgorithmsMu.Lock()
+	defer checksumAlgorithmsMu.Unlock()
+
+	checksumAlgorithms[strings.ToLower(algorithm)] = constructor
+}
+
+// checksumStrength ranks the checksum algorithms of lockfiles and package metadata
+var checksumStrength = map[string]int{"sha256": 1, "sha512": 2}
+
+// DecodeSha256 decodes a sha256 digest given as hex or base64, optionally prefixed with "sha256:"
+func DecodeSha256(value string) ([]byte, error) {
+	return decodeDigest(value, sha256Prefix, sha256.Size)
+}
+
+// DecodeSha512 decodes a sha512 digest given as hex or base64, optionally prefixed with "sha512:"
+func DecodeSha512(value string) ([]byte, error) {
+	return decodeDigest(value, sha512Prefix, sha512.Size)
+}
+
+func decodeDigest(value string, prefix string, size int) ([]byte, error) {
+	digest := strings.TrimSpace(value)
+
+	if len(digest) >= len(prefix) && strings.EqualFold(digest[:len(prefix)], prefix) {
+		digest = digest[len(prefix):]
+	}
+
+	if decoded, err := hex.DecodeString(digest); err == nil && len(decoded) == size {
+		return decoded, nil
+	}
+
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if decoded, err := encoding.DecodeString(digest); err == nil && len(decoded) == size {
+			return decoded, nil
+		}
+	}
+
+	return nil, fmt.Errorf("invalid %s checksum %q", strings.TrimSuffix(prefix, ":"), value)
+}
+
+// ChecksumsEqual compares two sha256 digests regardless of their encoding
+func ChecksumsEqual(a string, b string) (bool, error) {
+	decodedA, err := DecodeSha256(a)
+
+	if err != nil {
+		return false, err
+	}
+
+	decodedB, err := DecodeSha256(b)
+
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(decodedA, decodedB), nil
+}
+
+// VerifySha256 checks data against an expected sha256 digest in any supported encoding
+func VerifySha256(data []byte, expected string) error {
+	sum := sha256.Sum256(data)
+
+	equal, err := ChecksumsEqual(hex.EncodeToString(sum[:]), expected)
+
+	if err != nil {
+		return err
+	}
+
+	if !equal {
+		return fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, expected, hex.EncodeToString(sum[:]))
+	}
+
+	return nil
+}
+
+// VerifySha512 checks data against an expected sha512 digest in any supported encoding
+func VerifySha512(data []byte, expected string) error {
+	decoded, err := DecodeSha512(expected)
+
+	if err != nil {
+		return err
+	}
+
+	sum := sha512.Sum512(data)
+
+	if !bytes.Equal(sum[:], decoded) {
+		return fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, expected, hex.EncodeToString(sum[:]))
+	}
+
+	return nil
+}
+
+// VerifyDigest checks data against an expected digest of algorithm, given as hex or base64
+// and optionally prefixed with the algorithm name and a colon
+func VerifyDigest(data []byte, algorithm string, expected string) error {
+	checksumAlgorithmsMu.RLock()
+	constructor, ok := checksumAlgorithms[strings.ToLower(algorithm)]
+	checksumAlgorithmsMu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("%w %s", ErrUnknownChecksumAlgorithm, algorithm)
+	}
+
+	h := constructor()
+
+	decoded, err := decodeDigest(expected, algorithm+":", h.Size())
+
+	if err != nil {
+		return err
+	}
+
+	h.Write(data)
+	sum := h.Sum(nil)
+
+	if !bytes.Equal(sum, decoded) {
+		return fmt.Errorf("%w: expected %s %s, got %s", ErrChecksumMismatch, algorithm, expected, hex.EncodeToString(sum))
+	}
+
+	return nil
+}
+
+// VerifyDigests checks data against every digest of digests, by algorithm name
+func VerifyDigests(data []byte, digests map[string]string) error {
+	algorithms := make([]string, 0, len(digests))
+	for algorithm := range digests {
+		algorithms = append(algorithms, algorithm)
+	}
+	sort.Strings(algorithms)
+
+	for _, algorithm := range algorithms {
+		if err := VerifyDigest(data, algorithm, digests[algorithm]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// strength returns the rank of the strongest algorithm of c, 0 when it holds none
+func (c Checksums) strength() int {
+	if c.Sha512 != "" {
+		return checksumStrength["sha512"]
+	}
+
+	if c.Sha256 != "" {
+		return checksumStrength["sha256"]
+	}
+
+	return 0
+}
+
+// checkChecksumDowngrade fails when locked pins a stronger checksum algorithm than
+// the strongest archive checksum offered by the registry metadata
+func checkChecksumDowngrade(locked map[string]string, offered Checksums) error {
+	pinned := ""
+
+	for algorithm := range locked {
+		if checksumStrength[algorithm] > checksumStrength[pinned] {
+			pinned = algorithm
+		}
+	}
+
+	if pinned == "" || offered.strength() >= checksumStrength[pinned] {
+		return nil
+	}
+
+	return fmt.Errorf("%w: the lockfile pins %s, the registry does not offer it", ErrChecksumDowngrade, pinned)
+}
+
+// CanonicalChecksum returns the sha256 of a json document re-marshalled with sorted keys
+// and no insignificant whitespace, so equal content yields equal checksums regardless of formatting
+func CanonicalChecksum(data []byte) (string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var document any
+	if err := decoder.Decode(&document); err != nil {
+		return "", err
+	}
+
+	if decoder.More() {
+		return "", fmt.Errorf("invalid json: trailing data after document")
+	}
+
+	canonical := new(bytes.Buffer)
+	encoder := json.NewEncoder(canonical)
+	encoder.SetEscapeHTML(false)
+
+	if err := encoder.Encode(document); err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(bytes.TrimSuffix(canonical.Bytes(), []byte("\n")))
+
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,125 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"hash/fnv"
+	"testing"
+)
+
+func TestVerifySha256Encodings(t *testing.T) {
+	data := []byte("package archive")
+	sum := sha256.Sum256(data)
+
+	encodings := map[string]string{
+		"hex":             hex.EncodeToString(sum[:]),
+		"base64":          base64.StdEncoding.EncodeToString(sum[:]),
+		"prefixed hex":    "sha256:" + hex.EncodeToString(sum[:]),
+		"prefixed base64": "sha256:" + base64.StdEncoding.EncodeToString(sum[:]),
+	}
+
+	for name, checksum := range encodings {
+		t.Run(name, func(t *testing.T) {
+			if err := VerifySha256(data, checksum); err != nil {
+				t.Error(err)
+			}
+
+			if err := VerifySha256([]byte("tampered"), checksum); err == nil {
+				t.Error("expected checksum mismatch for tampered data")
+			}
+		})
+	}
+
+	if _, err := DecodeSha256("sha256:not-a-digest"); err == nil {
+		t.Error("expected error for malformed digest")
+	}
+}
+
+func TestCanonicalChecksum(t *testing.T) {
+	compact := []byte(`{"name":"lib","version":"1.0.0","dependencies":{"b":{"uri":"package://b@1.0.0"},"a":{"uri":"package://a@1.0.0"}}}`)
+	indented := []byte(`{
+  "version": "1.0.0",
+  "dependencies": {
+    "a": { "uri": "package://a@1.0.0" },
+    "b": { "uri": "package://b@1.0.0" }
+  },
+  "name": "lib"
+}
+`)
+
+	compactSum, err := CanonicalChecksum(compact)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	indentedSum, err := CanonicalChecksum(indented)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if compactSum != indentedSum {
+		t.Errorf("expected equal canonical checksums, got %s and %s", compactSum, indentedSum)
+	}
+
+	raw := (&Metadata{Source: compact}).RawChecksum()
+	if raw == (&Metadata{Source: indented}).RawChecksum() {
+		t.Error("expected raw checksums to reflect formatting")
+	}
+
+	changed, err := CanonicalChecksum([]byte(`{"name":"lib","version":"1.0.1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if changed == compactSum {
+		t.Error("expected different content to change the canonical checksum")
+	}
+
+	if _, err := CanonicalChecksum([]byte(`{"name":`)); err == nil {
+		t.Error("expected invalid json to be rejected")
+	}
+}
+
+func TestVerifyRegisteredChecksumAlgorithm(t *testing.T) {
+	RegisterChecksumAlgorithm("legacy-fnv", func() hash.Hash { return fnv.New64a() })
+
+	archive := []byte("legacy archive")
+	h := fnv.New64a()
+	h.Write(archive)
+	digest := hex.EncodeToString(h.Sum(nil))
+
+	reg := newTestRegistry(t)
+	sum := sha256.Sum256(archive)
+	path := "/legacy@1.0.0"
+	uri := "package://" + reg.host + path
+
+	reg.publish(t, path, Metadata{
+		Name:                "legacy",
+		PackageUri:          uri,
+		Version:             "1.0.0",
+		PackageZipUrl:       reg.server.URL + path + ".zip",
+		PackageZipChecksums: Checksums{Sha256: hex.EncodeToString(sum[:]), Digests: map[string]string{"legacy-fnv": "legacy-fnv:" + digest}},
+	}, archive)
+
+	r := newTestResolver(t)
+
+	resolved, err := r.Resolve(dependencySet(Dependency{Uri: uri, Name: "legacy"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Download(resolved); err != nil {
+		t.Fatalf("expected the archive to match its legacy digest, got %v", err)
+	}
+
+	if err := VerifyDigests([]byte("tampered"), map[string]string{"legacy-fnv": digest}); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected a checksum mismatch for tampered data, got %v", err)
+	}
+
+	if err := VerifyDigests(archive, map[string]string{"unregistered": digest}); !errors.Is(err, ErrUnknownChecksumAlgorithm) {
+		t.Errorf("expected an unregistered algorithm to be rejected, got %v", err)
+	}
+}
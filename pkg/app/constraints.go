@@ -0,0 +1,314 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// IndexSnapshot maps versionless package uris to the versions available at the time it was taken
+type IndexSnapshot map[string][]string
+
+// LoadIndexSnapshot reads an IndexSnapshot stored as json
+func LoadIndexSnapshot(path string) (IndexSnapshot, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot IndexSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// floatingTags are OCI tags moved to newer versions as they are published
+var floatingTags = []string{"latest"}
+
+func isFloatingTag(version string) bool {
+	return slices.Contains(floatingTags, version)
+}
+
+// isFloatingUri reports whether uri refers to a package by a floating tag instead of a version
+func isFloatingUri(uri string) bool {
+	_, version, err := SplitPackageUri(uri)
+
+	return err == nil && isFloatingTag(version)
+}
+
+// normalizeVersion strips the leading v some registries tag releases with,
+// so v1.2.3 and 1.2.3 compare and key identically
+func normalizeVersion(version string) string {
+	if len(version) > 1 && (version[0] == 'v' || version[0] == 'V') && version[1] >= '0' && version[1] <= '9' {
+		return version[1:]
+	}
+
+	return version
+}
+
+// parseVersion parses a package version, ignoring a leading v
+func parseVersion(version string) (*semver.Version, error) {
+	return semver.NewVersion(normalizeVersion(version))
+}
+
+// SplitPackageUri splits a package uri into its versionless base and version
+func SplitPackageUri(uri string) (string, string, error) {
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	path, version, found := strings.Cut(u.Path, "@")
+
+	if !found || version == "" {
+		return "", "", fmt.Errorf("package uri %s has no version", uri)
+	}
+
+	u.Path = path
+
+	return u.String(), version, nil
+}
+
+// ValidateConstraints reports packages whose direct requirements cannot be satisfied
+// together. An exact version is met by any later version of its major, the one
+// Deduplicate keeps, so only different majors and disjoint ranges conflict.
+func ValidateConstraints(dependencies map[string]Dependency) error {
+	requested := make(map[string]map[string][]string)
+
+	for _, dependency := range dependencies {
+		base, version, err := SplitPackageUri(dependency.Uri)
+
+		if err != nil {
+			return err
+		}
+
+		if _, ok := requested[base]; !ok {
+			requested[base] = make(map[string][]string)
+		}
+
+		requester := dependency.Name
+		if dependency.ProjectFileUri != "" {
+			requester = fmt.Sprintf("%s in %s", dependency.Name, dependency.ProjectFileUri)
+		}
+
+		version = normalizeVersion(version)
+		requested[base][version] = append(requested[base][version], requester)
+	}
+
+	var conflicts []string
+
+	for base, versions := range requested {
+		if len(versions) < 2 || compatibleVersions(versions) {
+			continue
+		}
+
+		var requests []string
+		for version, names := range versions {
+			sort.Strings(names)
+			requests = append(requests, fmt.Sprintf("%s (%s)", version, strings.Join(names, ", ")))
+		}
+		sort.Strings(requests)
+
+		conflicts = append(conflicts, fmt.Sprintf("%s requested as %s", base, strings.Join(requests, " and ")))
+	}
+
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	sort.Strings(conflicts)
+
+	return fmt.Errorf("conflicting version constraints: %s", strings.Join(conflicts, "; "))
+}
+
+// versionBound matches the versions a constraint is bounded by, like 1.2 in ^1.2
+var versionBound = regexp.MustCompile(`\d+(\.\d+){0,2}(-[0-9A-Za-z.-]+)?`)
+
+// compatibleVersions reports whether one version meets every requested version and
+// constraint. Ranges intersect at or right above one of their bounds, so those are the
+// only candidates tried.
+func compatibleVersions(requested map[string][]string) bool {
+	var checks []func(v *semver.Version) bool
+	candidates := []*semver.Version{semver.New(0, 0, 0, "", "")}
+
+	for version := range requested {
+		if exact, err := semver.StrictNewVersion(version); err == nil {
+			checks = append(checks, func(v *semver.Version) bool {
+				return v.Major() == exact.Major() && !v.LessThan(exact)
+			})
+			candidates = append(candidates, exact)
+			continue
+		}
+
+		constraint, err := semver.NewConstraint(version)
+
+		// floating tags and github release tags are not ordered
+		if err != nil {
+			return true
+		}
+
+		checks = append(checks, constraint.Check)
+
+		for _, bound := range versionBound.FindAllString(version, -1) {
+			if v, err := semver.NewVersion(bound); err == nil {
+				next := v.IncPatch()
+				candidates = append(candidates, v, &next)
+			}
+		}
+	}
+
+	for _, candidate := range candidates {
+		met := true
+
+		for _, check := range checks {
+			met = met && check(candidate)
+		}
+
+		if met {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolveVersion returns the dependency uri with a version constraint replaced by
+// the highest available version satisfying it, exact versions are returned as is
+func (r *Resolver) resolveVersion(dependency Dependency) (string, error) {
+	base, version, err := SplitPackageUri(dependency.Uri)
+
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := semver.StrictNewVersion(normalizeVersion(version)); err == nil {
+		return dependency.Uri, nil
+	}
+
+	// github uris reference release tags which are taken as is
+	if isGithubUri(dependency.Uri) {
+		return dependency.Uri, nil
+	}
+
+	if isFloatingTag(version) {
+		if !strings.HasSuffix(dependency.Name, ".oci") {
+			return "", fmt.Errorf("floating tag %s of %s is only supported for oci packages", version, base)
+		}
+
+		return dependency.Uri, nil
+	}
+
+	constraint, err := semver.NewConstraint(version)
+
+	if err != nil {
+		return "", fmt.Errorf("invalid version constraint %s in %s: %w", version, dependency.Uri, err)
+	}
+
+	available, err := r.availableVersions(base, dependency.Name)
+
+	if err != nil {
+		return "", err
+	}
+
+	var selected *semver.Version
+
+	for _, parsed := range available {
+		if r.satisfies(constraint, parsed) && (selected == nil || r.preferVersion(parsed, selected)) {
+			selected = parsed
+		}
+	}
+
+	if selected == nil {
+		return "", fmt.Errorf("no version of %s satisfies %s", base, version)
+	}
+
+	r.config.Logger.Info("Selected %s@%s for constraint %s", base, selected.Original(), version)
+
+	return fmt.Sprintf("%s@%s", base, selected.Original()), nil
+}
+
+// availableVersions returns the versions of base pinned by the index snapshot, or
+// else enumerated by the VersionLister of the resolver of the dependency
+func (r *Resolver) availableVersions(base string, dependencyName string) ([]*semver.Version, error) {
+	if versions, ok := r.snapshot[base]; ok {
+		return parseVersions(versions), nil
+	}
+
+	resolverType := HTTP
+	if strings.HasSuffix(dependencyName, ".oci") {
+		resolverType = OCI
+	}
+
+	lister, ok := r.versionListers[resolverType]
+
+	if !ok {
+		return nil, fmt.Errorf("unable to list versions of %s", base)
+	}
+
+	if plain, ok := lister.(plainVersionLister); ok && strings.Contains(dependencyName, ".plain") {
+		return plain.listPlainVersions(base)
+	}
+
+	return lister.ListVersions(base)
+}
+
+// satisfies reports whether v matches constraint. Pre-releases only match constraints
+// naming a pre-release, unless AppConfig.IncludePrereleases lets a pre-release match
+// the constraints its release matches.
+func (r *Resolver) satisfies(constraint *semver.Constraints, v *semver.Version) bool {
+	if constraint.Check(v) {
+		return true
+	}
+
+	if !r.config.IncludePrereleases || v.Prerelease() == "" {
+		return false
+	}
+
+	release, err := v.SetPrerelease("")
+
+	return err == nil && constraint.Check(&release)
+}
+
+// VersionComparator orders two versions of a package by preference. It returns a
+// positive number when a should be selected over b, a negative number when b should
+// be selected over a, and zero when neither is preferred.
+type VersionComparator func(a *semver.Version, b *semver.Version) int
+
+// WithVersionComparator replaces how a version is selected among the ones satisfying
+// a constraint, and among the versions of a package kept by Deduplicate. The highest
+// version wins by default.
+func WithVersionComparator(comparator VersionComparator) ResolverOption {
+	return func(r *Resolver) {
+		r.comparator = comparator
+	}
+}
+
+// preferVersion reports whether candidate should be selected over current. Stable
+// versions win over pre-releases unless AppConfig.IncludePrereleases is set, or a
+// VersionComparator decides otherwise.
+func (r *Resolver) preferVersion(candidate *semver.Version, current *semver.Version) bool {
+	if r.comparator != nil {
+		return r.comparator(candidate, current) > 0
+	}
+
+	if !r.config.IncludePrereleases {
+		candidateStable, currentStable := candidate.Prerelease() == "", current.Prerelease() == ""
+
+		if candidateStable != currentStable {
+			return candidateStable
+		}
+	}
+
+	return candidate.GreaterThan(current)
+}
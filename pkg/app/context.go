@@ -0,0 +1,88 @@
+package app
+
+import (
+	"context"
+
+	"hpkl.io/hpkl/pkg/logger"
+)
+
+// ResolveContext is Resolve prefixing every logged line with the correlation id of ctx,
+// set with logger.WithCorrelationID, so concurrent resolutions can be told apart
+func (r *Resolver) ResolveContext(ctx context.Context, dependencies map[string]Dependency) (map[string]*Metadata, error) {
+	return r.withContext(ctx).Resolve(dependencies)
+}
+
+// DownloadContext is Download prefixing every logged line with the correlation id of ctx
+func (r *Resolver) DownloadContext(ctx context.Context, dependencies map[string]*Metadata) (map[string]string, error) {
+	return r.withContext(ctx).Download(dependencies)
+}
+
+// withContext returns a view of r sharing its caches, logging with the correlation id
+// of ctx and aborting requests when ctx is cancelled
+func (r *Resolver) withContext(ctx context.Context) *Resolver {
+	config := *r.config
+	config.ctx = ctx
+	config.Logger = r.config.Logger.WithID(logger.CorrelationID(ctx))
+
+	return r.withConfig(&config)
+}
+
+// withConfig returns a view of r sharing its caches, with config applied to r and the
+// resolvers it delegates to
+func (r *Resolver) withConfig(config *AppConfig) *Resolver {
+	scoped := *r
+	scoped.config = config
+	scoped.ociResolver = r.ociResolver.withConfig(config)
+	scoped.httpResolver = r.httpResolver.withConfig(config)
+	scoped.githubResolver = r.githubResolver.withConfig(config)
+	scoped.grpcResolver = r.grpcResolver.withConfig(config)
+
+	if r.tarballResolver != nil {
+		scoped.tarballResolver = r.tarballResolver.withConfig(config)
+	}
+
+	scoped.versionListers = make(map[ResolverType]VersionLister, len(r.versionListers))
+
+	for resolverType, lister := range r.versionListers {
+		switch lister {
+		case VersionLister(r.ociResolver):
+			lister = scoped.ociResolver
+		case VersionLister(r.httpResolver):
+			lister = scoped.httpResolver
+		}
+
+		scoped.versionListers[resolverType] = lister
+	}
+
+	return &scoped
+}
+
+func (r *OciResolver) withConfig(config *AppConfig) *OciResolver {
+	scoped := *r
+	scoped.config = config
+	return &scoped
+}
+
+func (r *HttpResolver) withConfig(config *AppConfig) *HttpResolver {
+	scoped := *r
+	scoped.config = config
+	return &scoped
+}
+
+func (r *GithubResolver) withConfig(config *AppConfig) *GithubResolver {
+	scoped := *r
+	scoped.config = config
+	return &scoped
+}
+
+func (r *GrpcResolver) withConfig(config *AppConfig) *GrpcResolver {
+	scoped := *r
+	scoped.config = config
+	return &scoped
+}
+
+func (r *TarballResolver) withConfig(config *AppConfig) *TarballResolver {
+	scoped := *r
+	scoped.config = config
+	return &scoped
+}
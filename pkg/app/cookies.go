@@ -0,0 +1,35 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+)
+
+// newCookieJar returns the jar keeping the cookies set by registries, like the session
+// of a login portal, across metadata and archive requests. It is seeded with
+// AppConfig.Cookies.
+func newCookieJar(appConfig *AppConfig) (http.CookieJar, error) {
+	jar, err := cookiejar.New(nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for rawUrl, cookies := range appConfig.Cookies {
+		u, err := url.Parse(rawUrl)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid cookie url %s: %w", rawUrl, err)
+		}
+
+		if u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid cookie url %s: scheme and host are required", rawUrl)
+		}
+
+		jar.SetCookies(u, cookies)
+	}
+
+	return jar, nil
+}
@@ -0,0 +1,77 @@
+package app
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCookieJarKeepsPortalSession(t *testing.T) {
+	reg := newTestRegistry(t)
+	dep := reg.add(t, "lib", "1.0.0", []byte("lib"))
+
+	// the portal opens a session on the first request and requires it afterwards
+	var sessions int
+	reg.intercept = func(w http.ResponseWriter, req *http.Request) bool {
+		reg.mu.Lock()
+		first := sessions == 0
+		sessions++
+		reg.mu.Unlock()
+
+		if first {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "portal", Path: "/"})
+		} else if cookie, err := req.Cookie("session"); err != nil || cookie.Value != "portal" {
+			http.Error(w, "login required", http.StatusUnauthorized)
+			return false
+		}
+
+		return true
+	}
+
+	r := newTestResolver(t)
+
+	resolved, err := r.Resolve(dependencySet(dep))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Download(resolved); err != nil {
+		t.Fatalf("expected the session cookie to be sent with the archive request, got %v", err)
+	}
+}
+
+func TestCookieJarSeededFromConfig(t *testing.T) {
+	reg := newTestRegistry(t)
+	dep := reg.add(t, "lib", "1.0.0", []byte("lib"))
+
+	reg.authorize = func(req *http.Request) bool {
+		cookie, err := req.Cookie("session")
+		return err == nil && cookie.Value == "seeded"
+	}
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.Cookies = map[string][]*http.Cookie{
+			reg.server.URL: {{Name: "session", Value: "seeded"}},
+		}
+	})
+
+	resolved, err := r.Resolve(dependencySet(dep))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Download(resolved); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newTestResolver(t).Resolve(dependencySet(dep)); err == nil {
+		t.Error("expected the registry to reject requests without the seeded cookie")
+	}
+}
+
+func TestCookieJarRejectsInvalidUrl(t *testing.T) {
+	_, err := newCookieJar(&AppConfig{Cookies: map[string][]*http.Cookie{"registry.example.com": nil}})
+
+	if err == nil {
+		t.Error("expected a cookie url without scheme to be rejected")
+	}
+}
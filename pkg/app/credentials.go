@@ -0,0 +1,90 @@
+package app
+
+import (
+	"net/http"
+	"strings"
+)
+
+type (
+	// RegistryCredential authenticates the requests to http registries whose url,
+	// without scheme, starts with Prefix
+	RegistryCredential struct {
+		// Prefix is a host optionally followed by a path, like registry.example.com/team-a
+		Prefix   string
+		Username string
+		Password string
+		// Token is sent as a bearer token instead of Username and Password
+		Token string
+	}
+
+	// credentialTransport authenticates every request with the most specific
+	// credential matching its host and path
+	credentialTransport struct {
+		credentials []RegistryCredential
+		transport   http.RoundTripper
+	}
+)
+
+// newCredentialClient wraps the transport of httpClient to apply the AppConfig.Credentials
+func newCredentialClient(appConfig *AppConfig, httpClient *http.Client) *http.Client {
+	transport := httpClient.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	return &http.Client{
+		Transport:     &credentialTransport{credentials: appConfig.Credentials, transport: transport},
+		CheckRedirect: httpClient.CheckRedirect,
+		Jar:           httpClient.Jar,
+		Timeout:       httpClient.Timeout,
+	}
+}
+
+// matches reports whether the prefix of c covers host and path, on path segment boundaries
+func (c RegistryCredential) matches(host string, path string) bool {
+	prefixHost, prefixPath, _ := strings.Cut(strings.TrimSuffix(c.Prefix, "/"), "/")
+
+	if !strings.EqualFold(prefixHost, host) {
+		return false
+	}
+
+	if prefixPath == "" {
+		return true
+	}
+
+	path = strings.TrimPrefix(path, "/")
+
+	return path == prefixPath || strings.HasPrefix(path, prefixPath+"/")
+}
+
+// lookup returns the matching credential with the longest prefix
+func (t *credentialTransport) lookup(req *http.Request) (RegistryCredential, bool) {
+	var found RegistryCredential
+	ok := false
+
+	for _, credential := range t.credentials {
+		if credential.matches(req.URL.Host, req.URL.Path) && (!ok || len(credential.Prefix) > len(found.Prefix)) {
+			found = credential
+			ok = true
+		}
+	}
+
+	return found, ok
+}
+
+func (t *credentialTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	credential, ok := t.lookup(req)
+
+	if !ok {
+		return t.transport.RoundTrip(req)
+	}
+
+	if credential.Token != "" {
+		return t.transport.RoundTrip(withBearer(req, credential.Token))
+	}
+
+	authorized := req.Clone(req.Context())
+	authorized.SetBasicAuth(credential.Username, credential.Password)
+
+	return t.transport.RoundTrip(authorized)
+}
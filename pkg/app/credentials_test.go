@@ -0,0 +1,50 @@
+package app
+
+import (
+	"encoding/base64"
+	"net/http"
+	"path"
+	"testing"
+)
+
+func TestPathScopedCredentials(t *testing.T) {
+	reg := newTestRegistry(t)
+	teamA := reg.add(t, "team-a/lib", "1.0.0", []byte("a"))
+	teamAInternal := reg.add(t, "team-a/internal/lib", "1.0.0", []byte("internal"))
+	teamB := reg.add(t, "team-b/lib", "1.0.0", []byte("b"))
+
+	expected := map[string]string{
+		"/team-a/":          "Bearer token-a",
+		"/team-a/internal/": "Basic " + base64.StdEncoding.EncodeToString([]byte("internal:secret")),
+		"/team-b/":          "Bearer token-b",
+	}
+
+	var authorizations []string
+
+	reg.authorize = func(req *http.Request) bool {
+		authorization := req.Header.Get("Authorization")
+		authorizations = append(authorizations, req.URL.Path+" "+authorization)
+
+		return expected[path.Dir(req.URL.Path)+"/"] == authorization
+	}
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.Credentials = []RegistryCredential{
+			{Prefix: reg.host, Token: "host-token"},
+			{Prefix: reg.host + "/team-a", Token: "token-a"},
+			{Prefix: reg.host + "/team-a/internal", Username: "internal", Password: "secret"},
+			{Prefix: reg.host + "/team-b/", Token: "token-b"},
+			{Prefix: reg.host + "/team", Token: "not-a-segment"},
+		}
+	})
+
+	for _, dep := range []Dependency{
+		{Uri: teamA.Uri, Name: "a"},
+		{Uri: teamAInternal.Uri, Name: "internal"},
+		{Uri: teamB.Uri, Name: "b"},
+	} {
+		if _, err := r.Resolve(dependencySet(dep)); err != nil {
+			t.Errorf("expected %s to be resolved with its path scoped credential, got %s (requests: %v)", dep.Uri, err, authorizations)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package app
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidDependency is returned for dependencies that cannot be resolved as declared
+var ErrInvalidDependency = errors.New("invalid dependency")
+
+// dependencySchemes are the uri schemes a dependency can be resolved from
+var dependencySchemes = []string{"package", githubScheme, grpcScheme}
+
+// Normalize returns d with surrounding spaces trimmed, the host of its uri lowercased
+// and, when missing, a name derived from the last path segment of its uri
+func (d Dependency) Normalize() Dependency {
+	d.Uri = strings.TrimSpace(d.Uri)
+	d.Name = strings.TrimSpace(d.Name)
+
+	u, err := url.Parse(d.Uri)
+
+	if err != nil {
+		return d
+	}
+
+	if host := strings.ToLower(u.Host); host != u.Host {
+		u.Host = host
+		d.Uri = u.String()
+	}
+
+	if d.Name == "" {
+		name, _, _ := strings.Cut(path.Base(u.Path), "@")
+
+		if name != "." && name != "/" {
+			d.Name = name
+		}
+	}
+
+	return d
+}
+
+// Validate reports why d cannot be resolved: a missing name, an unparsable uri,
+// an unsupported scheme or a uri without host or version
+func (d Dependency) Validate() error {
+	if d.Uri == "" {
+		return fmt.Errorf("%w: missing uri", ErrInvalidDependency)
+	}
+
+	u, err := url.Parse(d.Uri)
+
+	if err != nil {
+		return fmt.Errorf("%w %s: %w", ErrInvalidDependency, d.Uri, err)
+	}
+
+	if u.Scheme == "" {
+		return fmt.Errorf("%w %s: missing scheme", ErrInvalidDependency, d.Uri)
+	}
+
+	if !slices.Contains(dependencySchemes, u.Scheme) {
+		return fmt.Errorf("%w %s: unsupported scheme %s", ErrInvalidDependency, d.Uri, u.Scheme)
+	}
+
+	if u.Host == "" {
+		return fmt.Errorf("%w %s: missing host", ErrInvalidDependency, d.Uri)
+	}
+
+	if _, _, err := SplitPackageUri(d.Uri); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidDependency, err)
+	}
+
+	if d.Name == "" {
+		return fmt.Errorf("%w %s: missing name", ErrInvalidDependency, d.Uri)
+	}
+
+	return nil
+}
+
+// normalizeDependencies normalizes every dependency, keyed by its normalized uri,
+// and reports all invalid dependencies at once
+func normalizeDependencies(dependencies map[string]Dependency) (map[string]Dependency, error) {
+	keys := make([]string, 0, len(dependencies))
+	for key := range dependencies {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	normalized := make(map[string]Dependency, len(dependencies))
+
+	var errs []error
+
+	for _, key := range keys {
+		dependency := dependencies[key].Normalize()
+
+		if err := dependency.Validate(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		normalized[dependency.Uri] = dependency
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	return normalized, nil
+}
+
+// ParseDependencyList reads a newline delimited list of package uris, each optionally
+// followed by a name and the plain keyword, fetching the package over plain http.
+// Blank lines and text after a # are ignored. Dependencies are keyed by uri, the
+// first occurrence of a uri wins.
+func ParseDependencyList(r io.Reader) (map[string]Dependency, error) {
+	dependencies := make(map[string]Dependency)
+	scanner := bufio.NewScanner(r)
+
+	var errs []error
+
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(text)
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		dependency := Dependency{Uri: fields[0]}
+		plainHttp := false
+
+		for _, field := range fields[1:] {
+			switch {
+			case field == "plain":
+				plainHttp = true
+			case dependency.Name == "":
+				dependency.Name = field
+			default:
+				errs = append(errs, fmt.Errorf("line %d: unexpected %s after name %s", line, field, dependency.Name))
+			}
+		}
+
+		dependency = dependency.Normalize()
+
+		if plainHttp && !strings.Contains(dependency.Name, ".plain") {
+			dependency.Name += ".plain"
+		}
+
+		if err := dependency.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", line, err))
+			continue
+		}
+
+		if _, ok := dependencies[dependency.Uri]; !ok {
+			dependencies[dependency.Uri] = dependency
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	return dependencies, nil
+}
@@ -0,0 +1,136 @@
+package app
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDependencyValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		dependency Dependency
+		expected   Dependency
+		err        string
+	}{
+		{
+			name:       "valid",
+			dependency: Dependency{Uri: "package://example.com/lib@1.0.0", Name: "lib.oci"},
+			expected:   Dependency{Uri: "package://example.com/lib@1.0.0", Name: "lib.oci"},
+		},
+		{
+			name:       "normalized",
+			dependency: Dependency{Uri: "  package://Example.COM/pkgs/lib@1.0.0 "},
+			expected:   Dependency{Uri: "package://example.com/pkgs/lib@1.0.0", Name: "lib"},
+		},
+		{
+			name:       "github",
+			dependency: Dependency{Uri: "github://owner/repo@v1.0.0"},
+			expected:   Dependency{Uri: "github://owner/repo@v1.0.0", Name: "repo"},
+		},
+		{
+			name:       "empty uri",
+			dependency: Dependency{Name: "lib"},
+			err:        "missing uri",
+		},
+		{
+			name:       "missing scheme",
+			dependency: Dependency{Uri: "example.com/lib@1.0.0", Name: "lib"},
+			err:        "missing scheme",
+		},
+		{
+			name:       "unsupported scheme",
+			dependency: Dependency{Uri: "https://example.com/lib@1.0.0", Name: "lib"},
+			err:        "unsupported scheme https",
+		},
+		{
+			name:       "missing host",
+			dependency: Dependency{Uri: "package:///lib@1.0.0", Name: "lib"},
+			err:        "missing host",
+		},
+		{
+			name:       "missing version",
+			dependency: Dependency{Uri: "package://example.com/lib", Name: "lib"},
+			err:        "has no version",
+		},
+		{
+			name:       "malformed uri",
+			dependency: Dependency{Uri: "package://example.com/%zz@1.0.0", Name: "lib"},
+			err:        "invalid URL escape",
+		},
+		{
+			name:       "missing name",
+			dependency: Dependency{Uri: "package://example.com/@1.0.0"},
+			err:        "missing name",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			normalized := test.dependency.Normalize()
+			err := normalized.Validate()
+
+			if test.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if normalized != test.expected {
+					t.Errorf("expected %+v, got %+v", test.expected, normalized)
+				}
+
+				return
+			}
+
+			if !errors.Is(err, ErrInvalidDependency) || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("expected an invalid dependency error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestResolveReportsInvalidDependencies(t *testing.T) {
+	r := newTestResolver(t)
+
+	_, err := r.Resolve(dependencySet(
+		Dependency{Uri: "example.com/lib@1.0.0", Name: "lib"},
+		Dependency{Uri: "package://example.com/other", Name: "other"},
+	))
+
+	if err == nil || !strings.Contains(err.Error(), "missing scheme") || !strings.Contains(err.Error(), "has no version") {
+		t.Errorf("expected both invalid dependencies to be reported, got %v", err)
+	}
+}
+
+func TestParseDependencyList(t *testing.T) {
+	input := `# packages used by the release script
+package://example.com/lib@1.0.0
+
+package://Example.com/pkgs/other@2.0.0 other.oci   # served by an oci registry
+  package://localhost:8080/local@0.1.0 plain
+package://example.com/lib@1.0.0 duplicate
+`
+
+	dependencies, err := ParseDependencyList(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]Dependency{
+		"package://example.com/lib@1.0.0":        {Uri: "package://example.com/lib@1.0.0", Name: "lib"},
+		"package://example.com/pkgs/other@2.0.0": {Uri: "package://example.com/pkgs/other@2.0.0", Name: "other.oci"},
+		"package://localhost:8080/local@0.1.0":   {Uri: "package://localhost:8080/local@0.1.0", Name: "local.plain"},
+	}
+
+	if diff := cmp.Diff(expected, dependencies); diff != "" {
+		t.Errorf(diff)
+	}
+
+	_, err = ParseDependencyList(strings.NewReader("package://example.com/lib@1.0.0\npackage://example.com/other\n"))
+
+	if !errors.Is(err, ErrInvalidDependency) || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected the invalid line to be reported, got %v", err)
+	}
+}
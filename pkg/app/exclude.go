@@ -0,0 +1,50 @@
+package app
+
+import (
+	"fmt"
+	"path"
+)
+
+// validateExcludes rejects malformed AppConfig.Exclude patterns
+func validateExcludes(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid exclude pattern %s: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// excluded reports whether one of uris matches an AppConfig.Exclude pattern, with or
+// without its version
+func (r *Resolver) excluded(uris ...string) bool {
+	for _, pattern := range r.config.Exclude {
+		for _, uri := range uris {
+			candidates := []string{uri}
+
+			if base, _, err := SplitPackageUri(uri); err == nil {
+				candidates = append(candidates, base)
+			}
+
+			for _, candidate := range candidates {
+				if ok, _ := path.Match(pattern, candidate); ok {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// warnExcluded logs the exclusion of the dependency uri of parent, which parent requires
+// unless a direct dependency provides the same package
+func (r *Resolver) warnExcluded(parent string, uri string, state *resolveState) {
+	if base, _, err := SplitPackageUri(uri); err == nil && state.roots[base] {
+		r.config.Logger.Info("Excluded %s required by %s, provided by a direct dependency", uri, parent)
+		return
+	}
+
+	r.config.Logger.Error("Excluded %s although %s requires it", uri, parent)
+}
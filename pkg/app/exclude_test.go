@@ -0,0 +1,73 @@
+package app
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"hpkl.io/hpkl/pkg/logger"
+)
+
+func TestResolveExcludesTransitiveDependencies(t *testing.T) {
+	reg := newTestRegistry(t)
+	shimDep := reg.add(t, "shim-dep", "1.0.0", []byte("shim-dep"))
+	shim := reg.add(t, "shim", "1.0.0", []byte("shim"), shimDep)
+	lib := reg.add(t, "lib", "1.0.0", []byte("lib"))
+	root := reg.add(t, "root", "1.0.0", []byte("root"), shim, lib)
+
+	errOut := new(bytes.Buffer)
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.Logger = logger.New(new(bytes.Buffer), errOut)
+		config.Exclude = []string{"package://" + reg.host + "/shim"}
+	})
+
+	resolved, err := r.Resolve(dependencySet(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dep := range []Dependency{root, lib} {
+		if _, ok := resolved[dep.Uri]; !ok {
+			t.Errorf("expected %s to be resolved", dep.Uri)
+		}
+	}
+
+	for _, dep := range []Dependency{shim, shimDep} {
+		if _, ok := resolved[dep.Uri]; ok {
+			t.Errorf("expected %s to be excluded", dep.Uri)
+		}
+	}
+
+	if count := reg.requestCount("/shim@1.0.0") + reg.requestCount("/shim-dep@1.0.0"); count != 0 {
+		t.Errorf("expected the excluded subtree not to be fetched, got %d requests", count)
+	}
+
+	if !strings.Contains(errOut.String(), "Excluded "+shim.Uri) {
+		t.Errorf("expected the exclusion of a required dependency to be reported, got %q", errOut.String())
+	}
+
+	replacement := reg.add(t, "shim", "2.0.0", []byte("shim"))
+
+	resolved, err = r.Resolve(dependencySet(root, replacement))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := resolved[replacement.Uri]; !ok {
+		t.Errorf("expected the direct dependency %s not to be excluded", replacement.Uri)
+	}
+
+	if _, ok := resolved[shim.Uri]; ok {
+		t.Errorf("expected the transitive %s to stay excluded", shim.Uri)
+	}
+}
+
+func TestResolveRejectsInvalidExclude(t *testing.T) {
+	config := newTestResolver(t).config
+	config.Exclude = []string{"package://example.com/[shim"}
+
+	if _, err := NewResolver(config); err == nil || !strings.Contains(err.Error(), "invalid exclude pattern") {
+		t.Errorf("expected the malformed pattern to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,234 @@
+package app
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// extractMarker is written into the destination directory after a successful
+// extraction and holds the sha256 of the archive that was extracted
+const extractMarker = ".hpkl-extracted"
+
+type (
+	// ExtractOption filters the entries written by Extract
+	ExtractOption func(*extractFilter)
+
+	// extractFilter selects archive entries by glob patterns, see ExtractInclude
+	extractFilter struct {
+		include []string
+		exclude []string
+	}
+)
+
+// ExtractInclude only writes the entries matching one of patterns, using the syntax of
+// path.Match. A pattern matches an entry when it matches its path or the path of one of
+// its parent directories, patterns without a slash match any segment of the path.
+func ExtractInclude(patterns ...string) ExtractOption {
+	return func(f *extractFilter) {
+		f.include = append(f.include, patterns...)
+	}
+}
+
+// ExtractExclude skips the entries matching one of patterns, it takes precedence
+// over ExtractInclude
+func ExtractExclude(patterns ...string) ExtractOption {
+	return func(f *extractFilter) {
+		f.exclude = append(f.exclude, patterns...)
+	}
+}
+
+// Extract unpacks the cached archive of m into destDir, preserving its structure.
+// Entries resolving outside of destDir are rejected before anything is written.
+// Extraction is skipped when destDir already holds the contents of the same archive
+// extracted with the same filter.
+func (r *Resolver) Extract(m *Metadata, destDir string, options ...ExtractOption) error {
+	filter := new(extractFilter)
+	for _, option := range options {
+		option(filter)
+	}
+
+	if err := filter.validate(); err != nil {
+		return err
+	}
+
+	archive, err := r.readArchive(m)
+
+	if err != nil {
+		return err
+	}
+
+	if m.PackageZipChecksums.Sha256 != "" {
+		if err := VerifySha256(archive, m.PackageZipChecksums.Sha256); err != nil {
+			return fmt.Errorf("%s: %w", m.PackageUri, err)
+		}
+	}
+
+	sum := sha256.Sum256(archive)
+	checksum := hex.EncodeToString(sum[:]) + filter.key()
+	markerPath := filepath.Join(destDir, extractMarker)
+
+	if marker, err := os.ReadFile(markerPath); err == nil && strings.TrimSpace(string(marker)) == checksum {
+		r.config.Logger.Info("Already extracted %s into %s", m.PackageUri, destDir)
+		return nil
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+
+	if err != nil {
+		return fmt.Errorf("invalid archive of %s: %w", m.PackageUri, err)
+	}
+
+	targets := make([]string, len(reader.File))
+
+	for i, file := range reader.File {
+		target, err := extractTarget(destDir, file)
+
+		if err != nil {
+			return fmt.Errorf("invalid archive of %s: %w", m.PackageUri, err)
+		}
+
+		targets[i] = target
+	}
+
+	r.config.Logger.Info("Extracting %s into %s", m.PackageUri, destDir)
+
+	for i, file := range reader.File {
+		if !filter.matches(file.Name) {
+			continue
+		}
+
+		if err := extractFile(file, targets[i]); err != nil {
+			return err
+		}
+	}
+
+	return os.WriteFile(markerPath, []byte(checksum), os.ModePerm)
+}
+
+// readArchive reads the archive of m from the resolver cache
+func (r *Resolver) readArchive(m *Metadata) ([]byte, error) {
+	archivePath, err := r.archivePath(m)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return os.ReadFile(archivePath)
+}
+
+// extractTarget returns the path file is extracted to, rejecting entries
+// that would escape destDir (zip-slip) and symbolic links
+func extractTarget(destDir string, file *zip.File) (string, error) {
+	if file.Mode()&os.ModeSymlink != 0 {
+		return "", fmt.Errorf("entry %s is a symbolic link", file.Name)
+	}
+
+	name := filepath.FromSlash(file.Name)
+
+	if filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("entry %s has an absolute path", file.Name)
+	}
+
+	target := filepath.Join(destDir, name)
+	rel, err := filepath.Rel(destDir, target)
+
+	if err != nil {
+		return "", err
+	}
+
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("entry %s escapes the destination directory", file.Name)
+	}
+
+	return target, nil
+}
+
+func extractFile(file *zip.File, target string) error {
+	if file.FileInfo().IsDir() {
+		return os.MkdirAll(target, os.ModePerm)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+
+	src, err := file.Open()
+
+	if err != nil {
+		return err
+	}
+
+	defer src.Close()
+
+	dst, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, file.Mode().Perm()|0o600)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+
+	return dst.Close()
+}
+
+func (f *extractFilter) validate() error {
+	for _, pattern := range slices.Concat(f.include, f.exclude) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid extract pattern %s: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// key identifies the filter in the extraction marker, empty without patterns
+func (f *extractFilter) key() string {
+	if len(f.include) == 0 && len(f.exclude) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(" include=%s exclude=%s", strings.Join(f.include, ","), strings.Join(f.exclude, ","))
+}
+
+// matches reports whether the entry name is written
+func (f *extractFilter) matches(name string) bool {
+	if matchesAny(f.exclude, name) {
+		return false
+	}
+
+	return len(f.include) == 0 || matchesAny(f.include, name)
+}
+
+func matchesAny(patterns []string, name string) bool {
+	name = strings.TrimSuffix(name, "/")
+
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(pattern, "/")
+		segment := !strings.Contains(pattern, "/")
+
+		for p := name; p != "." && p != "/"; p = path.Dir(p) {
+			candidate := p
+			if segment {
+				candidate = path.Base(p)
+			}
+
+			if ok, _ := path.Match(pattern, candidate); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,240 @@
+package app
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+
+	for name, content := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := f.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestExtract(t *testing.T) {
+	r := newTestResolver(t)
+	archive := zipArchive(t, map[string]string{
+		"PklProject":      "amends \"pkl:Project\"",
+		"lib/strings.pkl": "module strings",
+	})
+	seedCache(t, r.basePath, "example.com", "lib", "1.0.0", archive)
+
+	m := &Metadata{Name: "lib", Version: "1.0.0", PackageUri: "package://example.com/lib@1.0.0"}
+	dest := t.TempDir()
+
+	if err := r.Extract(m, dest); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dest, "lib", "strings.pkl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "module strings" {
+		t.Errorf("unexpected content of extracted module: %q", content)
+	}
+
+	modified := filepath.Join(dest, "PklProject")
+	if err := os.WriteFile(modified, []byte("modified"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Extract(m, dest); err != nil {
+		t.Fatal(err)
+	}
+
+	if content, _ := os.ReadFile(modified); string(content) != "modified" {
+		t.Errorf("expected extraction of an already extracted archive to be skipped")
+	}
+}
+
+func TestExtractRejectsZipSlip(t *testing.T) {
+	r := newTestResolver(t)
+	archive := zipArchive(t, map[string]string{
+		"good.pkl":          "module good",
+		"../../escaped.pkl": "module escaped",
+	})
+	seedCache(t, r.basePath, "example.com", "evil", "1.0.0", archive)
+
+	m := &Metadata{Name: "evil", Version: "1.0.0", PackageUri: "package://example.com/evil@1.0.0"}
+	root := t.TempDir()
+	dest := filepath.Join(root, "a", "b")
+
+	if err := r.Extract(m, dest); err == nil {
+		t.Fatal("expected archive with an entry escaping the destination to be rejected")
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "escaped.pkl")); !os.IsNotExist(err) {
+		t.Errorf("expected escaping entry not to be written, got %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dest, "good.pkl")); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be extracted from a rejected archive, got %v", err)
+	}
+}
+
+// countingWriter counts the response bytes sent by a test server
+type countingWriter struct {
+	http.ResponseWriter
+	mu    *sync.Mutex
+	count *int
+}
+
+func (w countingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	*w.count += len(p)
+	w.mu.Unlock()
+	return w.ResponseWriter.Write(p)
+}
+
+func TestExtractPathsWithRangeRequests(t *testing.T) {
+	large := make([]byte, 4<<20)
+	if _, err := rand.Read(large); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+
+	for name, content := range map[string][]byte{"lib/wanted.pkl": []byte("module wanted"), "assets/large.bin": large} {
+		f, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := f.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := buf.Bytes()
+
+	var mu sync.Mutex
+	served := 0
+
+	ranged := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.ServeContent(countingWriter{w, &mu, &served}, req, "package.zip", time.Time{}, bytes.NewReader(archive))
+	}))
+	t.Cleanup(ranged.Close)
+
+	r := newTestResolver(t)
+	m := &Metadata{Name: "big", Version: "1.0.0", PackageUri: "package://example.com/big@1.0.0", PackageZipUrl: ranged.URL + "/package.zip", ResolverType: HTTP}
+	dest := t.TempDir()
+
+	if err := r.ExtractPaths(m, dest, []string{"lib/wanted.pkl"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if content, err := os.ReadFile(filepath.Join(dest, "lib", "wanted.pkl")); err != nil || string(content) != "module wanted" {
+		t.Errorf("expected the selected entry to be extracted, got %q (%v)", content, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dest, "assets", "large.bin")); !os.IsNotExist(err) {
+		t.Error("expected entries not selected to be left out")
+	}
+
+	mu.Lock()
+	if served*10 > len(archive) {
+		t.Errorf("expected a fraction of the %d bytes archive to be transferred, got %d bytes", len(archive), served)
+	}
+	mu.Unlock()
+
+	if err := r.ExtractPaths(m, t.TempDir(), []string{"lib/missing.pkl"}); err == nil {
+		t.Error("expected a missing entry to be reported")
+	}
+
+	full := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write(archive)
+	}))
+	t.Cleanup(full.Close)
+
+	m.PackageZipUrl = full.URL + "/package.zip"
+
+	if err := r.ExtractPaths(m, t.TempDir(), []string{"lib/wanted.pkl"}); !errors.Is(err, ErrRangeUnsupported) {
+		t.Errorf("expected servers without range support to be reported, got %v", err)
+	}
+}
+
+func TestExtractWithFilter(t *testing.T) {
+	r := newTestResolver(t)
+	archive := zipArchive(t, map[string]string{
+		"PklProject":             "amends \"pkl:Project\"",
+		"README.md":              "readme",
+		"lib/strings.pkl":        "module strings",
+		"lib/tests/strings.pkl":  "module strings_test",
+		"docs/guide.md":          "guide",
+		"fixtures/data/one.json": "{}",
+	})
+	seedCache(t, r.basePath, "example.com", "lib", "1.0.0", archive)
+
+	m := &Metadata{Name: "lib", Version: "1.0.0", PackageUri: "package://example.com/lib@1.0.0"}
+	dest := t.TempDir()
+
+	if err := r.Extract(m, dest, ExtractExclude("tests", "*.md", "fixtures/data")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, kept := range []string{"PklProject", "lib/strings.pkl"} {
+		if _, err := os.Stat(filepath.Join(dest, kept)); err != nil {
+			t.Errorf("expected %s to be extracted: %s", kept, err)
+		}
+	}
+
+	for _, excluded := range []string{"README.md", "lib/tests/strings.pkl", "docs/guide.md", "fixtures/data/one.json"} {
+		if _, err := os.Stat(filepath.Join(dest, excluded)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected %s to be filtered out, got %v", excluded, err)
+		}
+	}
+
+	if err := r.Extract(m, dest); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dest, "README.md")); err != nil {
+		t.Errorf("expected extracting without filter not to be skipped: %s", err)
+	}
+
+	included := t.TempDir()
+
+	if err := r.Extract(m, included, ExtractInclude("lib/*.pkl")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(included, "PklProject")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected PklProject not to be included, got %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(included, "lib", "strings.pkl")); err != nil {
+		t.Errorf("expected lib/strings.pkl to be included: %s", err)
+	}
+}
@@ -0,0 +1,66 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// lockPollInterval is how often a package lock held by another process is retried
+const lockPollInterval = 50 * time.Millisecond
+
+// lockPackage takes an exclusive lock on the cache path of m, shared with the other
+// processes using the same cache directory, and returns the function releasing it.
+// The lock file lives next to the package directory so it never makes it look cached.
+// Waiting for the lock is given up when ctx is done or after AppConfig.ArchiveTimeout.
+func (r *Resolver) lockPackage(ctx context.Context, m *Metadata) (func(), error) {
+	dir, err := r.packageDir(m)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dir), os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(dir+".lock", os.O_CREATE|os.O_RDWR, 0o666)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if r.config.ArchiveTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.config.ArchiveTimeout)
+		defer cancel()
+	}
+
+	if err := lockFile(ctx, file); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return func() {
+		unlockFile(file)
+		file.Close()
+	}, nil
+}
+
+// lockFile polls tryLockFile until it holds the exclusive lock of file or ctx is done
+func lockFile(ctx context.Context, file *os.File) error {
+	for {
+		locked, err := tryLockFile(file)
+
+		if err != nil || locked {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !unix && !windows
+
+package app
+
+import (
+	"os"
+	"sync"
+)
+
+// lockedFiles serializes downloads within the process where file locks are not available
+var lockedFiles sync.Map
+
+func tryLockFile(file *os.File) (bool, error) {
+	mu, _ := lockedFiles.LoadOrStore(file.Name(), new(sync.Mutex))
+	return mu.(*sync.Mutex).TryLock(), nil
+}
+
+func unlockFile(file *os.File) error {
+	if mu, ok := lockedFiles.Load(file.Name()); ok {
+		mu.(*sync.Mutex).Unlock()
+	}
+	return nil
+}
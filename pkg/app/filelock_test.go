@@ -0,0 +1,138 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrentDownloadsShareTheCache(t *testing.T) {
+	reg := newTestRegistry(t)
+	archive := []byte("shared archive")
+	dep := reg.add(t, "shared", "1.0.0", archive)
+	reg.archiveDelay = 200 * time.Millisecond
+
+	cacheDir := t.TempDir()
+
+	// every resolver stands for a separate process sharing the cache directory
+	var wg sync.WaitGroup
+	paths := make([]string, 2)
+	errs := make([]error, 2)
+
+	for i := range paths {
+		r := newTestResolver(t, func(config *AppConfig) {
+			config.CacheDir = cacheDir
+		})
+
+		resolved, err := r.Resolve(dependencySet(dep))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			downloaded, err := r.Download(resolved)
+			paths[i], errs[i] = downloaded[dep.Uri], err
+		}(i)
+	}
+
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("download %d failed: %v", i, err)
+		}
+	}
+
+	if paths[0] != paths[1] {
+		t.Fatalf("expected both downloads to share the cache path, got %v", paths)
+	}
+
+	if data, err := os.ReadFile(paths[0]); err != nil || string(data) != string(archive) {
+		t.Errorf("expected the cached archive to be intact, got %q, %v", data, err)
+	}
+
+	if count := reg.requestCount("/shared@1.0.0.zip"); count != 1 {
+		t.Errorf("expected the second download to wait for the first and find it cached, got %d requests", count)
+	}
+}
+
+func TestPackageLockReleasedOnError(t *testing.T) {
+	reg := newTestRegistry(t)
+	archive := []byte("lib")
+	dep := reg.add(t, "lib", "1.0.0", archive)
+	reg.serve("/lib@1.0.0.zip", []byte("corrupted"))
+
+	r := newTestResolver(t)
+
+	resolved, err := r.Resolve(dependencySet(dep))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Download(resolved); err == nil {
+		t.Fatal("expected the corrupted archive to be rejected")
+	}
+
+	reg.serve("/lib@1.0.0.zip", archive)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.Download(resolved)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the lock of the failed download to be released")
+	}
+}
+
+func TestPackageLockWaitBoundedByArchiveTimeout(t *testing.T) {
+	reg := newTestRegistry(t)
+	dep := reg.add(t, "lib", "1.0.0", []byte("lib"))
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.ArchiveTimeout = 200 * time.Millisecond
+	})
+
+	resolved, err := r.Resolve(dependencySet(dep))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// another process holding the lock never releases it
+	unlock, err := r.lockPackage(context.Background(), resolved[dep.Uri])
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(unlock)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.Download(resolved)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected waiting for the lock to time out, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected waiting for the lock to be bounded by the archive timeout")
+	}
+
+	if count := reg.requestCount("/lib@1.0.0.zip"); count != 0 {
+		t.Errorf("expected the locked package not to be downloaded, got %d requests", count)
+	}
+}
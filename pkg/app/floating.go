@@ -0,0 +1,121 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// floatingMetaFile stores the last resolution of a floating uri in its cache directory,
+// it deliberately has no .json extension to stay out of the package listing
+const floatingMetaFile = "floating.meta"
+
+// now is replaced in tests to control the expiry of floating tag resolutions
+var now = time.Now
+
+// floatingEntry is a floating tag resolution persisted along with its expiry
+type floatingEntry struct {
+	ExpiresAt      time.Time       `json:"expiresAt"`
+	ManifestDigest string          `json:"manifestDigest,omitempty"`
+	Metadata       json.RawMessage `json:"metadata"`
+}
+
+// expired reports whether metadata resolved from a floating tag has outlived
+// AppConfig.FloatingTagTTL, metadata of pinned versions never expires
+func (m *Metadata) expired() bool {
+	return !m.ExpiresAt.IsZero() && !now().Before(m.ExpiresAt)
+}
+
+// floatingMetaPath returns where the resolution of the floating uri is stored
+func (r *Resolver) floatingMetaPath(uri string) (string, error) {
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(cacheDir(r.config.CacheNaming, r.basePath, u), floatingMetaFile), nil
+}
+
+// loadFloatingMetadata reads an unexpired resolution of the floating uri of dependency from disk
+func (r *Resolver) loadFloatingMetadata(dependency Dependency) (*Metadata, bool) {
+	path, err := r.floatingMetaPath(dependency.Uri)
+
+	if err != nil {
+		return nil, false
+	}
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, false
+	}
+
+	var entry floatingEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		r.config.Logger.Error("Ignoring floating tag cache %s: %s", path, err)
+		return nil, false
+	}
+
+	if !now().Before(entry.ExpiresAt) {
+		return nil, false
+	}
+
+	metadata, err := decodeMetadata(entry.Metadata, r.config.StrictMetadata)
+
+	if err != nil {
+		r.config.Logger.Error("Ignoring floating tag cache %s: %s", path, err)
+		return nil, false
+	}
+
+	sum := sha256.Sum256(entry.Metadata)
+
+	metadata.ResolverType = OCI
+	metadata.PlainHttp = strings.Contains(dependency.Name, ".plain")
+	metadata.Source = entry.Metadata
+	metadata.Checksum = hex.EncodeToString(sum[:])
+	metadata.ManifestDigest = entry.ManifestDigest
+	metadata.Requested = dependency.Uri
+	metadata.ExpiresAt = entry.ExpiresAt
+	nameDependencies(metadata)
+
+	return metadata, true
+}
+
+// storeFloatingMetadata sets the expiry of metadata resolved from the floating uri
+// and persists it so that later invocations reuse it until it expires
+func (r *Resolver) storeFloatingMetadata(uri string, metadata *Metadata) {
+	metadata.ExpiresAt = now().Add(r.config.FloatingTagTTL)
+
+	if r.config.FloatingTagTTL <= 0 {
+		return
+	}
+
+	path, err := r.floatingMetaPath(uri)
+
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	}
+
+	var data []byte
+	if err == nil {
+		data, err = json.Marshal(floatingEntry{
+			ExpiresAt:      metadata.ExpiresAt,
+			ManifestDigest: metadata.ManifestDigest,
+			Metadata:       metadata.Source,
+		})
+	}
+
+	if err == nil {
+		err = writeFile(path, data, os.ModePerm)
+	}
+
+	if err != nil {
+		r.config.Logger.Error("Unable to cache resolution of %s: %s", uri, err)
+	}
+}
@@ -0,0 +1,153 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	githubScheme     = "github"
+	githubApiUrl     = "https://api.github.com"
+	githubMetadata   = "metadata.json"
+	githubPackageZip = "package.zip"
+)
+
+type (
+	// GithubResolver resolves github://owner/repo@tag uris to the metadata.json and
+	// package.zip assets of the matching GitHub release
+	GithubResolver struct {
+		config *AppConfig
+		client *http.Client
+		apiUrl string
+	}
+
+	githubRelease struct {
+		TagName string               `json:"tag_name"`
+		Assets  []githubReleaseAsset `json:"assets"`
+	}
+
+	githubReleaseAsset struct {
+		Name   string `json:"name"`
+		Url    string `json:"url"`
+		Digest string `json:"digest"`
+	}
+)
+
+func NewGithubResolver(appConfig *AppConfig, httpClient *http.Client) *GithubResolver {
+	apiUrl := appConfig.GithubApiUrl
+	if apiUrl == "" {
+		apiUrl = githubApiUrl
+	}
+
+	return &GithubResolver{config: appConfig, client: httpClient, apiUrl: strings.TrimSuffix(apiUrl, "/")}
+}
+
+func isGithubUri(uri string) bool {
+	return strings.HasPrefix(uri, githubScheme+"://")
+}
+
+func (r *GithubResolver) ResolveMetadata(uri string, plainHttp bool) (*Metadata, error) {
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	repo, tag, found := strings.Cut(strings.TrimPrefix(u.Path, "/"), "@")
+
+	if u.Host == "" || !found || repo == "" || tag == "" || strings.Contains(repo, "/") {
+		return nil, fmt.Errorf("invalid github uri %s, expected github://owner/repo@tag", uri)
+	}
+
+	data, err := r.get(fmt.Sprintf("%s/repos/%s/%s/releases/tags/%s", r.apiUrl, u.Host, repo, url.PathEscape(tag)), "application/vnd.github+json")
+
+	if err != nil {
+		return nil, err
+	}
+
+	var release githubRelease
+	if err := json.Unmarshal(data, &release); err != nil {
+		return nil, err
+	}
+
+	assets := make(map[string]githubReleaseAsset, len(release.Assets))
+	for _, asset := range release.Assets {
+		assets[asset.Name] = asset
+	}
+
+	metadataAsset, ok := assets[githubMetadata]
+
+	if !ok {
+		return nil, fmt.Errorf("release %s of %s/%s has no %s asset", tag, u.Host, repo, githubMetadata)
+	}
+
+	packageAsset, ok := assets[githubPackageZip]
+
+	if !ok {
+		return nil, fmt.Errorf("release %s of %s/%s has no %s asset", tag, u.Host, repo, githubPackageZip)
+	}
+
+	source, err := r.get(metadataAsset.Url, "application/octet-stream")
+
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := decodeMetadata(source, r.config.StrictMetadata)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if metadata.PackageZipChecksums.Sha256 == "" && strings.HasPrefix(packageAsset.Digest, sha256Prefix) {
+		metadata.PackageZipChecksums.Sha256 = packageAsset.Digest
+	}
+
+	sum := sha256.Sum256(source)
+
+	metadata.PackageZipUrl = packageAsset.Url
+	metadata.ResolverType = GITHUB
+	metadata.Source = source
+	metadata.Checksum = hex.EncodeToString(sum[:])
+
+	return metadata, nil
+}
+
+func (r *GithubResolver) ResolveArchive(metadata *Metadata) ([]byte, error) {
+	return r.get(metadata.PackageZipUrl, "application/octet-stream")
+}
+
+// get performs an authenticated GitHub API request
+func (r *GithubResolver) get(resourceUrl string, accept string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, resourceUrl, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", accept)
+
+	if r.config.GithubToken != "" {
+		req.Header.Set("Authorization", "Bearer "+r.config.GithubToken)
+	}
+
+	resp, err := r.client.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Github get %s error status: %s", resourceUrl, resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGithubResolver(t *testing.T) {
+	archive := []byte("release zip")
+	sum := sha256.Sum256(archive)
+
+	metadata, err := json.Marshal(Metadata{
+		Name:       "lib",
+		PackageUri: "package://example.com/lib@1.2.3",
+		Version:    "1.2.3",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "Bad credentials", http.StatusUnauthorized)
+			return
+		}
+
+		switch req.URL.Path {
+		case "/repos/owner/repo/releases/tags/v1.2.3":
+			json.NewEncoder(w).Encode(githubRelease{
+				TagName: "v1.2.3",
+				Assets: []githubReleaseAsset{
+					{Name: githubMetadata, Url: server.URL + "/repos/owner/repo/releases/assets/1"},
+					{Name: githubPackageZip, Url: server.URL + "/repos/owner/repo/releases/assets/2", Digest: "sha256:" + hex.EncodeToString(sum[:])},
+				},
+			})
+		case "/repos/owner/repo/releases/assets/1":
+			w.Write(metadata)
+		case "/repos/owner/repo/releases/assets/2":
+			if req.Header.Get("Accept") != "application/octet-stream" {
+				http.Error(w, "expected asset download", http.StatusBadRequest)
+				return
+			}
+			w.Write(archive)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.GithubApiUrl = server.URL
+		config.GithubToken = "secret"
+	})
+
+	dep := Dependency{Uri: "github://owner/repo@v1.2.3", Name: "lib"}
+
+	resolved, err := r.Resolve(dependencySet(dep))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := resolved[dep.Uri]
+	if m == nil || m.ResolverType != GITHUB || m.Version != "1.2.3" {
+		t.Fatalf("unexpected metadata %+v", m)
+	}
+
+	if ok, err := ChecksumsEqual(m.PackageZipChecksums.Sha256, hex.EncodeToString(sum[:])); err != nil || !ok {
+		t.Errorf("expected archive checksum to be taken from the release asset, got %q", m.PackageZipChecksums.Sha256)
+	}
+
+	if _, err := r.Download(resolved); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewGithubResolver(&AppConfig{GithubApiUrl: server.URL}, server.Client()).ResolveMetadata(dep.Uri, false); err == nil {
+		t.Error("expected unauthenticated requests to fail")
+	}
+
+	if _, err := r.githubResolver.ResolveMetadata("github://owner/repo/nested@v1.2.3", false); err == nil {
+		t.Error("expected malformed github uri to be rejected")
+	}
+}
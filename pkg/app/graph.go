@@ -0,0 +1,53 @@
+package app
+
+// ReachableFrom returns the packages of an already resolved set that root depends
+// on transitively, root included. Dependencies redirected by floating tags or
+// replace directives are followed through the uris they were requested with.
+func (r *Resolver) ReachableFrom(root string, dependencies map[string]*Metadata) map[string]*Metadata {
+	index := aliasIndex(dependencies)
+
+	result := make(map[string]*Metadata)
+	pending := []string{root}
+
+	for len(pending) > 0 {
+		uri, ok := index[pending[0]]
+		pending = pending[1:]
+
+		if !ok {
+			continue
+		}
+
+		if _, seen := result[uri]; seen {
+			continue
+		}
+
+		metadata := dependencies[uri]
+		result[uri] = metadata
+
+		for _, dependency := range metadata.Dependencies {
+			pending = append(pending, dependency.Uri)
+		}
+	}
+
+	return result
+}
+
+// aliasIndex maps the uris of dependencies, and the floating or replaced uris they were
+// requested with, to their key in dependencies
+func aliasIndex(dependencies map[string]*Metadata) map[string]string {
+	index := make(map[string]string, len(dependencies))
+
+	for uri, metadata := range dependencies {
+		index[uri] = uri
+
+		for _, alias := range []string{metadata.Requested, metadata.Replaced} {
+			if alias != "" {
+				if _, ok := index[alias]; !ok {
+					index[alias] = uri
+				}
+			}
+		}
+	}
+
+	return index
+}
@@ -0,0 +1,272 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	grpcScheme = "grpc"
+	// grpcService is the Registry service of grpc_registry.proto
+	grpcService = "/hpkl.registry.v1.Registry/"
+	// grpcMaxMessageSize bounds the archives received from a registry
+	grpcMaxMessageSize = 64 << 20
+)
+
+type (
+	// GrpcResolver resolves grpc://host/path@version uris through the Registry
+	// service of grpc_registry.proto, reusing one connection per host
+	GrpcResolver struct {
+		config *AppConfig
+		// mu guards conns, both are shared with the resolvers scoped by ResolveContext
+		mu    *sync.Mutex
+		conns map[string]*grpc.ClientConn
+	}
+
+	// grpcMessage is a message of grpc_registry.proto, all of them hold a single
+	// string or bytes field numbered 1
+	grpcMessage struct {
+		value []byte
+	}
+
+	// grpcCodec encodes grpcMessage in the protobuf wire format
+	grpcCodec struct{}
+)
+
+func NewGrpcResolver(appConfig *AppConfig) *GrpcResolver {
+	return &GrpcResolver{config: appConfig, mu: new(sync.Mutex), conns: make(map[string]*grpc.ClientConn)}
+}
+
+func isGrpcUri(uri string) bool {
+	return strings.HasPrefix(uri, grpcScheme+"://")
+}
+
+func (r *GrpcResolver) ResolveMetadata(uri string, plainHttp bool) (*Metadata, error) {
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Host == "" || !strings.Contains(u.Path, "@") {
+		return nil, fmt.Errorf("invalid grpc uri %s, expected grpc://host/path@version", uri)
+	}
+
+	plain := r.config.PlainHttp || plainHttp
+	source, err := r.call(u.Host, plain, "GetMetadata", uri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := decodeMetadata(source, r.config.StrictMetadata)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(source)
+
+	// the archive is fetched through the registry that served the metadata
+	metadata.PackageZipUrl = uri
+	metadata.ResolverType = GRPC
+	metadata.PlainHttp = plain
+	metadata.Source = source
+	metadata.Checksum = hex.EncodeToString(sum[:])
+
+	return metadata, nil
+}
+
+func (r *GrpcResolver) ResolveArchive(metadata *Metadata) ([]byte, error) {
+	u, err := url.Parse(metadata.PackageZipUrl)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return r.call(u.Host, metadata.PlainHttp, "GetArchive", metadata.PackageZipUrl)
+}
+
+// Close closes the connections opened to registries
+func (r *GrpcResolver) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var errs []error
+	for host, conn := range r.conns {
+		errs = append(errs, conn.Close())
+		delete(r.conns, host)
+	}
+
+	return errors.Join(errs...)
+}
+
+// call invokes method of the registry at host with a request holding uri and
+// returns the bytes field of the response
+func (r *GrpcResolver) call(host string, plain bool, method string, uri string) ([]byte, error) {
+	conn, err := r.conn(host, plain)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := r.config.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	request := &grpcMessage{value: []byte(uri)}
+	response := &grpcMessage{}
+
+	err = conn.Invoke(ctx, grpcService+method, request, response, grpc.ForceCodec(grpcCodec{}))
+
+	if status.Code(err) == codes.NotFound {
+		return nil, fmt.Errorf("%w: grpc %s %s: %w", ErrPackageNotFound, method, uri, err)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("grpc %s %s: %w", method, uri, err)
+	}
+
+	return response.value, nil
+}
+
+// conn returns the connection to host, creating it on first use
+func (r *GrpcResolver) conn(host string, plain bool) (*grpc.ClientConn, error) {
+	key := host
+	if plain {
+		key = "plain+" + host
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if conn, ok := r.conns[key]; ok {
+		return conn, nil
+	}
+
+	creds, err := r.credentials(plain)
+
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := grpc.NewClient(host,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(grpcMaxMessageSize)))
+
+	if err != nil {
+		return nil, fmt.Errorf("grpc connection to %s: %w", host, err)
+	}
+
+	r.conns[key] = conn
+
+	return conn, nil
+}
+
+// credentials returns the transport credentials configured by the Grpc* fields of the AppConfig
+func (r *GrpcResolver) credentials(plain bool) (credentials.TransportCredentials, error) {
+	if plain {
+		return insecure.NewCredentials(), nil
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: r.config.GrpcServerName}
+
+	if r.config.GrpcCaFile != "" {
+		pem, err := os.ReadFile(r.config.GrpcCaFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		config.RootCAs = x509.NewCertPool()
+
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", r.config.GrpcCaFile)
+		}
+	}
+
+	if r.config.GrpcCertFile != "" || r.config.GrpcKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(r.config.GrpcCertFile, r.config.GrpcKeyFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return credentials.NewTLS(config), nil
+}
+
+func (grpcCodec) Name() string {
+	return "proto"
+}
+
+func (grpcCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(*grpcMessage)
+
+	if !ok {
+		return nil, fmt.Errorf("unsupported grpc message %T", v)
+	}
+
+	b := protowire.AppendTag(nil, 1, protowire.BytesType)
+	return protowire.AppendBytes(b, m.value), nil
+}
+
+func (grpcCodec) Unmarshal(data []byte, v any) error {
+	m, ok := v.(*grpcMessage)
+
+	if !ok {
+		return fmt.Errorf("unsupported grpc message %T", v)
+	}
+
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+
+		data = data[n:]
+
+		if num == 1 && typ == protowire.BytesType {
+			value, n := protowire.ConsumeBytes(data)
+
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+
+			m.value = value
+			data = data[n:]
+			continue
+		}
+
+		// unknown fields are skipped as protobuf decoders do
+		n = protowire.ConsumeFieldValue(num, typ, data)
+
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+
+		data = data[n:]
+	}
+
+	return nil
+}
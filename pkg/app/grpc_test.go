@@ -0,0 +1,141 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// testGrpcRegistry is an in-process Registry service of grpc_registry.proto
+type testGrpcRegistry struct {
+	host     string
+	mu       sync.Mutex
+	metadata map[string][]byte
+	archives map[string][]byte
+}
+
+func newTestGrpcRegistry(t *testing.T) *testGrpcRegistry {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reg := &testGrpcRegistry{
+		host:     listener.Addr().String(),
+		metadata: make(map[string][]byte),
+		archives: make(map[string][]byte),
+	}
+
+	server := grpc.NewServer(grpc.ForceServerCodec(grpcCodec{}))
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "hpkl.registry.v1.Registry",
+		HandlerType: (*any)(nil),
+		Methods: []grpc.MethodDesc{
+			{MethodName: "GetMetadata", Handler: reg.handler(reg.metadata)},
+			{MethodName: "GetArchive", Handler: reg.handler(reg.archives)},
+		},
+		Metadata: "grpc_registry.proto",
+	}, reg)
+
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	return reg
+}
+
+func (reg *testGrpcRegistry) handler(data map[string][]byte) func(any, context.Context, func(any) error, grpc.UnaryServerInterceptor) (any, error) {
+	return func(_ any, _ context.Context, decode func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+		request := &grpcMessage{}
+		if err := decode(request); err != nil {
+			return nil, err
+		}
+
+		reg.mu.Lock()
+		defer reg.mu.Unlock()
+
+		value, ok := data[string(request.value)]
+		if !ok {
+			return nil, status.Errorf(codes.NotFound, "%s not found", request.value)
+		}
+
+		return &grpcMessage{value: value}, nil
+	}
+}
+
+func (reg *testGrpcRegistry) add(t *testing.T, name string, version string, archive []byte) Dependency {
+	uri := fmt.Sprintf("grpc://%s/%s@%s", reg.host, name, version)
+	sum := sha256.Sum256(archive)
+
+	data, err := json.Marshal(Metadata{
+		Name:                name,
+		PackageUri:          fmt.Sprintf("package://%s/%s@%s", reg.host, name, version),
+		Version:             version,
+		PackageZipChecksums: Checksums{Sha256: hex.EncodeToString(sum[:])},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.metadata[uri] = data
+	reg.archives[uri] = archive
+
+	return Dependency{Uri: uri, Name: name}
+}
+
+func TestGrpcResolver(t *testing.T) {
+	reg := newTestGrpcRegistry(t)
+	lib := reg.add(t, "lib", "1.0.0", []byte("lib archive"))
+	other := reg.add(t, "other", "1.0.0", []byte("other archive"))
+
+	r := newTestResolver(t)
+
+	resolved, err := r.Resolve(dependencySet(lib, other))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metadata := resolved[lib.Uri]
+	if metadata == nil || metadata.ResolverType != GRPC || metadata.Checksum == "" {
+		t.Fatalf("unexpected metadata for %s: %+v", lib.Uri, metadata)
+	}
+
+	paths, err := r.Download(resolved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := os.ReadFile(paths[lib.Uri])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(archive) != "lib archive" {
+		t.Errorf("unexpected archive content %q", archive)
+	}
+
+	if conns := len(r.grpcResolver.conns); conns != 1 {
+		t.Errorf("expected a single connection to be reused, got %d", conns)
+	}
+
+	missing := Dependency{Uri: fmt.Sprintf("grpc://%s/missing@1.0.0", reg.host), Name: "missing"}
+	if _, err := r.Resolve(dependencySet(missing)); !errors.Is(err, ErrPackageNotFound) {
+		t.Errorf("expected ErrPackageNotFound, got %v", err)
+	}
+
+	if err := r.grpcResolver.Close(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,98 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// loadIndex fetches the bundled metadata index configured by AppConfig.MetadataIndexUrl.
+// The index is a json array of package metadata, entries must be byte for byte copies
+// of the published metadata files for the recorded checksums to match.
+func (r *HttpResolver) loadIndex() map[string]json.RawMessage {
+	resp, err := r.client.Get(r.config.MetadataIndexUrl)
+
+	if err == nil && resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		err = fmt.Errorf("Http get Error status: %s", resp.Status)
+	}
+
+	var entries []json.RawMessage
+
+	if err == nil {
+		defer resp.Body.Close()
+
+		var data []byte
+		if data, err = io.ReadAll(resp.Body); err == nil {
+			err = json.Unmarshal(data, &entries)
+		}
+	}
+
+	if err != nil {
+		r.config.Logger.Error("Unable to load metadata index %s, fetching packages individually: %s", r.config.MetadataIndexUrl, err)
+		return nil
+	}
+
+	index := make(map[string]json.RawMessage, len(entries))
+
+	for _, entry := range entries {
+		var header struct {
+			PackageUri string `json:"packageUri"`
+		}
+
+		if err := json.Unmarshal(entry, &header); err != nil || header.PackageUri == "" {
+			r.config.Logger.Error("Skipping invalid metadata index entry: %s", entry)
+			continue
+		}
+
+		index[header.PackageUri] = entry
+	}
+
+	return index
+}
+
+// lookupIndex returns the metadata of uri from the bundled index, it reports false
+// when no index is configured or it does not contain uri
+func (r *HttpResolver) lookupIndex(uri string, plainHttp bool) (*Metadata, bool, error) {
+	if r.config.MetadataIndexUrl == "" {
+		return nil, false, nil
+	}
+
+	entry, ok := r.index()[uri]
+
+	if !ok {
+		return nil, false, nil
+	}
+
+	metadata, err := decodeMetadata(entry, r.config.StrictMetadata)
+
+	if err != nil {
+		return nil, true, err
+	}
+
+	indexUrl, err := url.Parse(r.config.MetadataIndexUrl)
+
+	if err != nil {
+		return nil, true, err
+	}
+
+	zipUrl, err := url.Parse(metadata.PackageZipUrl)
+
+	if err != nil {
+		return nil, true, err
+	}
+
+	sum := sha256.Sum256(entry)
+
+	metadata.PackageZipUrl = indexUrl.ResolveReference(zipUrl).String()
+	metadata.ResolverType = HTTP
+	metadata.Source = entry
+	metadata.PlainHttp = plainHttp
+	metadata.Checksum = hex.EncodeToString(sum[:])
+
+	return metadata, true, nil
+}
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+type (
+	// PackageLicense is the license declared by a resolved package
+	PackageLicense struct {
+		Uri     string `json:"uri"`
+		License string `json:"license,omitempty"`
+		// Allowed is false for packages without license or with a license rejected
+		// by AppConfig.AllowedLicenses and DeniedLicenses
+		Allowed bool `json:"allowed"`
+	}
+
+	// LicenseReport aggregates the licenses of a resolved dependency set
+	LicenseReport struct {
+		// Packages are sorted by package uri
+		Packages []PackageLicense `json:"packages"`
+		// Licenses lists the package uris declaring each license
+		Licenses map[string][]string `json:"licenses"`
+		// Missing are the package uris declaring no license
+		Missing []string `json:"missing,omitempty"`
+		// Disallowed are the package uris declaring a license rejected by the policy
+		Disallowed []string `json:"disallowed,omitempty"`
+	}
+)
+
+// LicenseReport aggregates the licenses declared by the resolved packages, flagging the
+// packages without license and the ones whose license AppConfig.AllowedLicenses and
+// DeniedLicenses reject. Licenses are compared case-insensitively.
+func (r *Resolver) LicenseReport(resolved map[string]*Metadata) *LicenseReport {
+	report := &LicenseReport{Licenses: make(map[string][]string)}
+
+	for _, m := range resolved {
+		license := strings.TrimSpace(m.License)
+		pkg := PackageLicense{Uri: m.PackageUri, License: license}
+
+		switch {
+		case license == "":
+			report.Missing = append(report.Missing, m.PackageUri)
+		case !r.licenseAllowed(license):
+			report.Disallowed = append(report.Disallowed, m.PackageUri)
+		default:
+			pkg.Allowed = true
+		}
+
+		if license != "" {
+			report.Licenses[license] = append(report.Licenses[license], m.PackageUri)
+		}
+
+		report.Packages = append(report.Packages, pkg)
+	}
+
+	sort.Slice(report.Packages, func(i, j int) bool {
+		return report.Packages[i].Uri < report.Packages[j].Uri
+	})
+
+	for _, uris := range report.Licenses {
+		sort.Strings(uris)
+	}
+
+	sort.Strings(report.Missing)
+	sort.Strings(report.Disallowed)
+
+	return report
+}
+
+func (r *Resolver) licenseAllowed(license string) bool {
+	matches := func(candidate string) bool {
+		return strings.EqualFold(candidate, license)
+	}
+
+	if slices.ContainsFunc(r.config.DeniedLicenses, matches) {
+		return false
+	}
+
+	return len(r.config.AllowedLicenses) == 0 || slices.ContainsFunc(r.config.AllowedLicenses, matches)
+}
@@ -0,0 +1,52 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLicenseReport(t *testing.T) {
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.AllowedLicenses = []string{"Apache-2.0", "MIT", "GPL-3.0"}
+		config.DeniedLicenses = []string{"gpl-3.0"}
+		config.StrictMetadata = true
+	})
+
+	decoded, err := decodeMetadata([]byte(`{"name":"lib","packageUri":"package://example.com/lib@1.0.0","version":"1.0.0","license":"Apache-2.0"}`), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolved := map[string]*Metadata{
+		decoded.PackageUri:                  decoded,
+		"package://example.com/mit@1.0.0":   {PackageUri: "package://example.com/mit@1.0.0", License: "mit"},
+		"package://example.com/other@1.0.0": {PackageUri: "package://example.com/other@1.0.0", License: "Apache-2.0"},
+		"package://example.com/gpl@1.0.0":   {PackageUri: "package://example.com/gpl@1.0.0", License: "GPL-3.0"},
+		"package://example.com/bsd@1.0.0":   {PackageUri: "package://example.com/bsd@1.0.0", License: "BSD-3-Clause"},
+		"package://example.com/none@1.0.0":  {PackageUri: "package://example.com/none@1.0.0"},
+	}
+
+	expected := &LicenseReport{
+		Packages: []PackageLicense{
+			{Uri: "package://example.com/bsd@1.0.0", License: "BSD-3-Clause"},
+			{Uri: "package://example.com/gpl@1.0.0", License: "GPL-3.0"},
+			{Uri: "package://example.com/lib@1.0.0", License: "Apache-2.0", Allowed: true},
+			{Uri: "package://example.com/mit@1.0.0", License: "mit", Allowed: true},
+			{Uri: "package://example.com/none@1.0.0"},
+			{Uri: "package://example.com/other@1.0.0", License: "Apache-2.0", Allowed: true},
+		},
+		Licenses: map[string][]string{
+			"Apache-2.0":   {"package://example.com/lib@1.0.0", "package://example.com/other@1.0.0"},
+			"BSD-3-Clause": {"package://example.com/bsd@1.0.0"},
+			"GPL-3.0":      {"package://example.com/gpl@1.0.0"},
+			"mit":          {"package://example.com/mit@1.0.0"},
+		},
+		Missing:    []string{"package://example.com/none@1.0.0"},
+		Disallowed: []string{"package://example.com/bsd@1.0.0", "package://example.com/gpl@1.0.0"},
+	}
+
+	if diff := cmp.Diff(expected, r.LicenseReport(resolved)); diff != "" {
+		t.Errorf("unexpected license report (-expected +actual):\n%s", diff)
+	}
+}
@@ -0,0 +1,374 @@
+package app
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+const lockfileName = "PklProject.deps.json"
+
+// ErrLockfileStale is returned by CheckLockfile when the committed lockfile differs
+// from the one the declared dependencies resolve to
+var ErrLockfileStale = errors.New("lockfile is not up to date")
+
+// lockedResolvers names the resolver of each locked dependency
+var lockedResolvers = map[ResolverType]string{
+	OCI:     "oci",
+	HTTP:    "http",
+	GITHUB:  "github",
+	GRPC:    "grpc",
+	TARBALL: "tarball",
+}
+
+// Lockfile builds the remote entries of PklProject.deps.json for resolved packages.
+// Packages resolved from a floating tag are pinned to their concrete version and
+// keep the floating uri they were requested with.
+func (r *Resolver) Lockfile(resolved map[string]*Metadata) (*ProjectDependencies, error) {
+	lockfile := &ProjectDependencies{
+		SchemaVersion:        1,
+		ResolvedDependencies: make(map[string]*ResolvedDependency, len(resolved)),
+	}
+
+	for _, dep := range resolved {
+		mapUri, err := r.MajorVersionPackage(dep)
+
+		if err != nil {
+			return nil, err
+		}
+
+		packageUri, err := url.Parse(dep.PackageUri)
+
+		if err != nil {
+			return nil, err
+		}
+
+		packageUri.Scheme = "projectpackage"
+
+		locked := &ResolvedDependency{
+			DependencyType: "remote",
+			Uri:            packageUri.String(),
+			Checksums:      map[string]string{"sha256": dep.Checksum},
+			Requested:      dep.Requested,
+			Digest:         dep.ManifestDigest,
+			Dependencies:   declaredDependencies(dep),
+			Resolver:       lockedResolvers[dep.ResolverType],
+			PlainHttp:      dep.PlainHttp,
+		}
+
+		// pinning sha512 when the registry offers it lets a later downgrade to sha256 be detected
+		if dep.PackageZipChecksums.Sha512 != "" {
+			sum := sha512.Sum512(dep.Source)
+			locked.Checksums["sha512"] = hex.EncodeToString(sum[:])
+		}
+
+		if r.config.RecordProvenance {
+			locked.Source = dep.Registry
+			if locked.Source == "" {
+				locked.Source = packageUri.Host
+			}
+
+			if !dep.ResolvedAt.IsZero() {
+				locked.ResolvedAt = dep.ResolvedAt.UTC().Format(time.RFC3339)
+			}
+		}
+
+		lockfile.ResolvedDependencies[mapUri] = locked
+	}
+
+	return lockfile, nil
+}
+
+// declaredDependencies returns the sorted package uris m depends on
+func declaredDependencies(m *Metadata) []string {
+	var uris []string
+
+	for _, dependency := range m.Dependencies {
+		uris = append(uris, dependency.Uri)
+	}
+
+	sort.Strings(uris)
+
+	return slices.Compact(uris)
+}
+
+// VerifyDependencySets reports packages whose declared dependencies differ from the
+// ones recorded in lockfile, which happens when a version is republished with a
+// different dependency set
+func (r *Resolver) VerifyDependencySets(resolved map[string]*Metadata, lockfile *ProjectDependencies) error {
+	var errs []error
+
+	for _, dep := range resolved {
+		mapUri, err := r.MajorVersionPackage(dep)
+
+		if err != nil {
+			return err
+		}
+
+		locked, ok := lockfile.ResolvedDependencies[mapUri]
+
+		if !ok || locked.DependencyType != "remote" || strings.TrimPrefix(locked.Uri, "project") != dep.PackageUri {
+			continue
+		}
+
+		declared := declaredDependencies(dep)
+
+		var added, removed []string
+
+		for _, uri := range declared {
+			if !slices.Contains(locked.Dependencies, uri) {
+				added = append(added, uri)
+			}
+		}
+
+		for _, uri := range locked.Dependencies {
+			if !slices.Contains(declared, uri) {
+				removed = append(removed, uri)
+			}
+		}
+
+		if len(added) == 0 && len(removed) == 0 {
+			continue
+		}
+
+		r.config.Logger.Error("Dependencies of %s differ from the lockfile, added: %v removed: %v", dep.PackageUri, added, removed)
+		errs = append(errs, fmt.Errorf("dependencies of %s changed since locked: added %v, removed %v", dep.PackageUri, added, removed))
+	}
+
+	return errors.Join(errs...)
+}
+
+// CheckLockfile resolves the metadata of dependencies, without downloading any archive, and
+// reports how the remote entries of the lockfile they would produce differ from lockfile.
+// Provenance fields are not compared since they change on every resolution.
+func (r *Resolver) CheckLockfile(dependencies map[string]Dependency, lockfile *ProjectDependencies) error {
+	resolved, err := r.Resolve(dependencies)
+
+	if err != nil {
+		return err
+	}
+
+	resolved, err = r.Deduplicate(resolved, DedupHighestVersion)
+
+	if err != nil {
+		return err
+	}
+
+	expected, err := r.Lockfile(resolved)
+
+	if err != nil {
+		return err
+	}
+
+	committed := make(map[string]*ResolvedDependency, len(lockfile.ResolvedDependencies))
+	for mapUri, locked := range lockfile.ResolvedDependencies {
+		if locked.DependencyType == "remote" {
+			committed[mapUri] = locked
+		}
+	}
+
+	var diffs []string
+
+	for mapUri, locked := range expected.ResolvedDependencies {
+		actual, ok := committed[mapUri]
+
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("missing %s (%s)", mapUri, locked.Uri))
+			continue
+		}
+
+		for _, diff := range lockedDiff(locked, actual) {
+			diffs = append(diffs, fmt.Sprintf("%s %s", mapUri, diff))
+		}
+	}
+
+	for mapUri, locked := range committed {
+		if _, ok := expected.ResolvedDependencies[mapUri]; !ok {
+			diffs = append(diffs, fmt.Sprintf("unexpected %s (%s)", mapUri, locked.Uri))
+		}
+	}
+
+	if len(diffs) == 0 {
+		return nil
+	}
+
+	sort.Strings(diffs)
+
+	return fmt.Errorf("%w:\n  %s", ErrLockfileStale, strings.Join(diffs, "\n  "))
+}
+
+// lockedDiff describes the fields of the committed entry differing from the expected one
+func lockedDiff(expected *ResolvedDependency, committed *ResolvedDependency) []string {
+	var diffs []string
+
+	field := func(name string, expected string, committed string) {
+		if expected != committed {
+			diffs = append(diffs, fmt.Sprintf("%s: locked %q, resolves to %q", name, committed, expected))
+		}
+	}
+
+	field("uri", expected.Uri, committed.Uri)
+	field("requested", expected.Requested, committed.Requested)
+	field("resolver", expected.Resolver, committed.Resolver)
+	field("digest", expected.Digest, committed.Digest)
+	field("plainHttp", fmt.Sprint(expected.PlainHttp), fmt.Sprint(committed.PlainHttp))
+	field("dependencies", strings.Join(expected.Dependencies, ","), strings.Join(committed.Dependencies, ","))
+
+	// sha256 checksums are compared decoded, they may be locked prefixed, as hex or base64
+	if equal, err := ChecksumsEqual(expected.Checksums["sha256"], committed.Checksums["sha256"]); err != nil || !equal {
+		field("sha256", expected.Checksums["sha256"], committed.Checksums["sha256"])
+	}
+
+	field("sha512", expected.Checksums["sha512"], committed.Checksums["sha512"])
+
+	return diffs
+}
+
+// HydrateFromLockfile populates the cache with every remote package of lockfile without
+// evaluating a project. Metadata is fetched again and verified against the locked
+// checksums before the archives are downloaded.
+func (r *Resolver) HydrateFromLockfile(lockfile *ProjectDependencies) error {
+	resolved := make(map[string]*Metadata, len(lockfile.ResolvedDependencies))
+	var errs []error
+
+	for _, locked := range lockfile.ResolvedDependencies {
+		if locked.DependencyType != "remote" {
+			continue
+		}
+
+		dependency := lockedDependency(locked)
+
+		if err := r.checkPlainHttp(dependency); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		metadata, _, err := r.fetchMetadata(dependency)
+
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if checksum, ok := locked.Checksums["sha256"]; ok {
+			if equal, err := ChecksumsEqual(metadata.Checksum, checksum); err != nil || !equal {
+				errs = append(errs, fmt.Errorf("metadata checksum mismatch for %s: locked %s, got %s", dependency.Uri, checksum, metadata.Checksum))
+				continue
+			}
+		}
+
+		if checksum, ok := locked.Checksums["sha512"]; ok {
+			if err := VerifySha512(metadata.Source, checksum); err != nil {
+				errs = append(errs, fmt.Errorf("metadata %s: %w", dependency.Uri, err))
+				continue
+			}
+		}
+
+		if err := checkChecksumDowngrade(locked.Checksums, metadata.PackageZipChecksums); err != nil {
+			errs = append(errs, fmt.Errorf("dependency %s: %w", dependency.Uri, err))
+			continue
+		}
+
+		resolved[dependency.Uri] = metadata
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	_, err := r.Download(resolved)
+	return err
+}
+
+// lockedDependency rebuilds the dependency of a locked entry, its name carries the
+// .oci and .plain suffixes routing the dependency to the resolver it was locked with
+func lockedDependency(locked *ResolvedDependency) Dependency {
+	uri := strings.TrimPrefix(locked.Uri, "project")
+	name := path.Base(uri)
+
+	if i := strings.LastIndex(name, "@"); i > 0 {
+		name = name[:i]
+	}
+
+	if locked.PlainHttp {
+		name += ".plain"
+	}
+
+	if locked.Resolver == lockedResolvers[OCI] {
+		name += ".oci"
+	}
+
+	return Dependency{Uri: uri, Name: name}
+}
+
+// WriteLockfile stores lockfile in workingDir as PklProject.deps.json, or as
+// PklProject.deps.yaml or PklProject.deps.toml for the other formats. Every format
+// holds the fields of the json lockfile with keys in a deterministic order.
+func WriteLockfile(workingDir string, lockfile *ProjectDependencies, format LockfileFormat) error {
+	data, err := json.MarshalIndent(lockfile, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case LockfileJSON, "":
+	case LockfileYAML, LockfileTOML:
+		if data, err = convertLockfile(data, format); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported lockfile format %s", format)
+	}
+
+	return os.WriteFile(filepath.Join(workingDir, format.fileName()), data, os.ModePerm)
+}
+
+// ReadLockfile loads the lockfile of format stored in workingDir by WriteLockfile
+func ReadLockfile(workingDir string, format LockfileFormat) (*ProjectDependencies, error) {
+	data, err := os.ReadFile(filepath.Join(workingDir, format.fileName()))
+
+	if err != nil {
+		return nil, err
+	}
+
+	var document map[string]any
+
+	switch format {
+	case LockfileJSON, "":
+	case LockfileYAML:
+		err = yaml.Unmarshal(data, &document)
+	case LockfileTOML:
+		err = toml.Unmarshal(data, &document)
+	default:
+		return nil, fmt.Errorf("unsupported lockfile format %s", format)
+	}
+
+	if err == nil && document != nil {
+		data, err = json.Marshal(stringKeys(document))
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid lockfile %s: %w", format.fileName(), err)
+	}
+
+	var lockfile ProjectDependencies
+	if err := json.Unmarshal(data, &lockfile); err != nil {
+		return nil, fmt.Errorf("invalid lockfile %s: %w", format.fileName(), err)
+	}
+
+	return &lockfile, nil
+}
@@ -0,0 +1,101 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// LockfileFormat is the serialization of a lockfile written by WriteLockfile
+type LockfileFormat string
+
+const (
+	LockfileJSON LockfileFormat = "json"
+	LockfileYAML LockfileFormat = "yaml"
+	LockfileTOML LockfileFormat = "toml"
+)
+
+// fileName is the name of the lockfile stored in format
+func (f LockfileFormat) fileName() string {
+	if f == "" || f == LockfileJSON {
+		return lockfileName
+	}
+
+	return strings.TrimSuffix(lockfileName, ".json") + "." + string(f)
+}
+
+// convertLockfile converts the json lockfile data to format. The json is decoded
+// generically so that every format keeps the json field names and omitted fields.
+func convertLockfile(data []byte, format LockfileFormat) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var document any
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+
+	document = jsonNumbers(document)
+
+	if format == LockfileYAML {
+		return yaml.Marshal(document)
+	}
+
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(document); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// jsonNumbers replaces the json.Number values of a decoded json document by
+// int64 or float64 values the yaml and toml encoders write as numbers
+func jsonNumbers(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		for key, item := range v {
+			v[key] = jsonNumbers(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = jsonNumbers(item)
+		}
+	}
+
+	return value
+}
+
+// stringKeys converts the map[interface{}]interface{} values decoded by yaml into
+// map[string]any values encoding/json accepts
+func stringKeys(value any) any {
+	switch v := value.(type) {
+	case map[any]any:
+		result := make(map[string]any, len(v))
+		for key, item := range v {
+			result[fmt.Sprint(key)] = stringKeys(item)
+		}
+		return result
+	case map[string]any:
+		for key, item := range v {
+			v[key] = stringKeys(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = stringKeys(item)
+		}
+	}
+
+	return value
+}
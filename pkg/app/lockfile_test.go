@@ -0,0 +1,302 @@
+package app
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestVerifyDependencySets(t *testing.T) {
+	reg := newTestRegistry(t)
+	lib := reg.add(t, "lib", "1.0.0", []byte("zip"))
+	root := reg.add(t, "root", "1.0.0", []byte("zip"), lib)
+
+	r := newTestResolver(t)
+
+	resolved, err := r.Resolve(dependencySet(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lockfile, err := r.Lockfile(resolved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.VerifyDependencySets(resolved, lockfile); err != nil {
+		t.Fatalf("expected a freshly locked graph to verify, got %s", err)
+	}
+
+	extra := reg.add(t, "extra", "1.0.0", []byte("zip"))
+	reg.add(t, "lib", "1.0.0", []byte("zip"), extra)
+
+	republished, err := newTestResolver(t).Resolve(dependencySet(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.VerifyDependencySets(republished, lockfile)
+	if err == nil {
+		t.Fatal("expected the new transitive dependency to be reported")
+	}
+
+	if !strings.Contains(err.Error(), lib.Uri) || !strings.Contains(err.Error(), "added ["+extra.Uri+"]") {
+		t.Errorf("expected the addition of %s to %s to be reported, got %q", extra.Uri, lib.Uri, err)
+	}
+}
+
+func TestHydrateFromLockfile(t *testing.T) {
+	reg := newTestRegistry(t)
+	lib := reg.add(t, "lib", "1.0.0", []byte("lib"))
+	root := reg.add(t, "root", "1.0.0", []byte("root"), lib)
+
+	resolved, err := newTestResolver(t).Resolve(dependencySet(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lockfile, err := newTestResolver(t).Lockfile(resolved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lockfile.ResolvedDependencies["package://local"] = &ResolvedDependency{DependencyType: "local", Path: "../local"}
+
+	r := newTestResolver(t)
+
+	if err := r.HydrateFromLockfile(lockfile); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, metadata := range resolved {
+		exists, err := r.Exists(metadata)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !exists {
+			t.Errorf("expected %s to be hydrated into the cache", metadata.PackageUri)
+		}
+	}
+
+	for _, locked := range lockfile.ResolvedDependencies {
+		if locked.DependencyType == "remote" {
+			locked.Checksums["sha256"] = strings.Repeat("0", 64)
+		}
+	}
+
+	if err := newTestResolver(t).HydrateFromLockfile(lockfile); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected metadata not matching the lockfile to be rejected, got %v", err)
+	}
+}
+
+func TestLockfileProvenance(t *testing.T) {
+	resolvedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return resolvedAt }
+	t.Cleanup(func() { now = time.Now })
+
+	reg := newTestRegistry(t)
+	lib := reg.add(t, "lib", "1.0.0", []byte("zip"))
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.RecordProvenance = true
+	})
+
+	resolved, err := r.Resolve(dependencySet(lib))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lockfile, err := r.Lockfile(resolved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := WriteLockfile(dir, lockfile, LockfileJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, lockfileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var written ProjectDependencies
+	if err := json.Unmarshal(data, &written); err != nil {
+		t.Fatal(err)
+	}
+
+	locked := written.ResolvedDependencies["package://"+reg.host+"/lib@1"]
+	if locked == nil {
+		t.Fatalf("expected lib in the lockfile, got %s", data)
+	}
+
+	if locked.Source != reg.host || locked.ResolvedAt != "2024-05-01T12:00:00Z" {
+		t.Errorf("expected provenance %s at 2024-05-01T12:00:00Z, got %s at %s", reg.host, locked.Source, locked.ResolvedAt)
+	}
+
+	plain, err := newTestResolver(t).Lockfile(resolved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err = json.Marshal(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(data), "resolvedAt") || strings.Contains(string(data), `"source"`) {
+		t.Errorf("expected provenance to be omitted unless recorded, got %s", data)
+	}
+}
+
+func TestLockfileFormats(t *testing.T) {
+	reg := newTestRegistry(t)
+	leaf := reg.add(t, "leaf", "1.0.0", []byte("leaf"))
+	root := reg.add(t, "root", "1.0.0", []byte("root"), leaf)
+
+	r := newTestResolver(t)
+
+	resolved, err := r.Resolve(dependencySet(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lockfile, err := r.Lockfile(resolved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []LockfileFormat{LockfileJSON, LockfileYAML, LockfileTOML} {
+		t.Run(string(format), func(t *testing.T) {
+			dir := t.TempDir()
+
+			if err := WriteLockfile(dir, lockfile, format); err != nil {
+				t.Fatal(err)
+			}
+
+			first, err := os.ReadFile(filepath.Join(dir, format.fileName()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := WriteLockfile(dir, lockfile, format); err != nil {
+				t.Fatal(err)
+			}
+
+			second, err := os.ReadFile(filepath.Join(dir, format.fileName()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(first, second) {
+				t.Errorf("expected deterministic output, got:\n%s\nand:\n%s", first, second)
+			}
+
+			read, err := ReadLockfile(dir, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(lockfile, read); diff != "" {
+				t.Errorf("unexpected lockfile read back from %s (-written +read):\n%s", format, diff)
+			}
+		})
+	}
+}
+
+func TestHydrateRejectsChecksumDowngrade(t *testing.T) {
+	reg := newTestRegistry(t)
+	lib := reg.add(t, "lib", "1.0.0", []byte("lib"))
+
+	resolved, err := newTestResolver(t).Resolve(dependencySet(lib))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lockfile, err := newTestResolver(t).Lockfile(resolved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the lockfile pins sha512 while the registry metadata only offers sha256
+	sum := sha512.Sum512(resolved[lib.Uri].Source)
+	for _, locked := range lockfile.ResolvedDependencies {
+		locked.Checksums["sha512"] = hex.EncodeToString(sum[:])
+	}
+
+	if err := newTestResolver(t).HydrateFromLockfile(lockfile); !errors.Is(err, ErrChecksumDowngrade) {
+		t.Errorf("expected the checksum downgrade to be rejected, got %v", err)
+	}
+
+	pinned := map[string]string{"sha256": "a", "sha512": "b"}
+
+	if err := checkChecksumDowngrade(pinned, Checksums{Sha256: "a", Sha512: "b"}); err != nil {
+		t.Errorf("expected metadata offering sha512 to be accepted, got %v", err)
+	}
+
+	if err := checkChecksumDowngrade(map[string]string{"sha256": "a"}, Checksums{Sha256: "a"}); err != nil {
+		t.Errorf("expected a sha256 lockfile to accept sha256 metadata, got %v", err)
+	}
+}
+
+func TestCheckLockfile(t *testing.T) {
+	reg := newTestRegistry(t)
+	lib := reg.add(t, "lib", "1.0.0", []byte("lib"))
+	root := reg.add(t, "root", "1.0.0", []byte("root"), lib)
+
+	resolved, err := newTestResolver(t).Resolve(dependencySet(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lockfile, err := newTestResolver(t).Lockfile(resolved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lockfile.ResolvedDependencies["package://example.com/local@1"] = &ResolvedDependency{DependencyType: "local", Path: "../local"}
+
+	r := newTestResolver(t)
+
+	if err := r.CheckLockfile(dependencySet(root), lockfile); err != nil {
+		t.Fatalf("expected an up to date lockfile to pass, got %s", err)
+	}
+
+	extra := reg.add(t, "extra", "1.0.0", []byte("extra"))
+	reg.add(t, "lib", "1.0.0", []byte("lib"), extra)
+	newer := reg.add(t, "root", "2.0.0", []byte("root"), lib)
+
+	err = newTestResolver(t).CheckLockfile(dependencySet(newer), lockfile)
+
+	if !errors.Is(err, ErrLockfileStale) {
+		t.Fatalf("expected a stale lockfile to be reported, got %v", err)
+	}
+
+	for _, expected := range []string{
+		"missing package://" + reg.host + "/root@2",
+		"missing package://" + reg.host + "/extra@1",
+		"unexpected package://" + reg.host + "/root@1",
+		"package://" + reg.host + "/lib@1 dependencies",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q in %s", expected, err)
+		}
+	}
+
+	for _, m := range resolved {
+		if exists, _ := r.Exists(m); exists {
+			t.Errorf("expected no archive to be downloaded, found %s", m.PackageUri)
+		}
+	}
+}
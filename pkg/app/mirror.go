@@ -0,0 +1,173 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/apple/pkl-go/pkl"
+	"hpkl.io/hpkl/pkg/pklutils"
+	"hpkl.io/hpkl/pkg/registry"
+)
+
+// RegistryConfig is an OCI registry packages are mirrored to
+type RegistryConfig struct {
+	// Host of the registry, with an optional port
+	Host string
+	// Namespace is prepended to the repository of every mirrored package
+	Namespace string
+	// PlainHttp talks to the registry over plain http
+	PlainHttp bool
+}
+
+// Mirror pushes the metadata and archive of every package of dependencies to the
+// target registry, keeping their repository path. Archives are downloaded into the
+// cache first and packages already present in the target are skipped.
+func (r *Resolver) Mirror(dependencies map[string]*Metadata, target RegistryConfig) error {
+	if target.Host == "" {
+		return errors.New("mirror registry host is required")
+	}
+
+	client := r.ociResolver.client
+	if target.PlainHttp {
+		client = r.ociResolver.plainClient
+	}
+
+	archives, err := r.Download(dependencies)
+
+	if err != nil {
+		return err
+	}
+
+	uris := make([]string, 0, len(dependencies))
+	for uri := range dependencies {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+
+	var errs []error
+
+	for _, uri := range uris {
+		m := dependencies[uri]
+
+		mirrored, err := mirrorUri(m, target)
+
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		ref, err := pklutils.PklUriToRef(mirrored)
+
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		exists, err := client.Exists(ref)
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("mirror %s: %w", ref, err))
+			continue
+		}
+
+		if exists {
+			r.config.Logger.Info("Skipping %s, already mirrored to %s", uri, ref)
+			continue
+		}
+
+		r.config.Logger.Info("Mirroring %s to %s", uri, ref)
+
+		if err := mirrorPackage(client, archives[uri], ref, m, mirrored); err != nil {
+			errs = append(errs, fmt.Errorf("mirror %s to %s: %w", uri, ref, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// mirrorUri returns the package uri of m in the target registry
+func mirrorUri(m *Metadata, target RegistryConfig) (string, error) {
+	u, err := url.Parse(m.PackageUri)
+
+	if err != nil {
+		return "", fmt.Errorf("invalid package uri %s: %w", m.PackageUri, err)
+	}
+
+	u.Host = target.Host
+
+	if namespace := strings.Trim(target.Namespace, "/"); namespace != "" {
+		u.Path = "/" + namespace + u.Path
+	}
+
+	return u.String(), nil
+}
+
+// mirrorPackage pushes the cached archive of m to ref, with metadata naming the
+// mirrored uri as its packageUri so the package resolves from the mirror
+func mirrorPackage(client *registry.Client, archivePath string, ref string, m *Metadata, mirrored string) error {
+	data, err := os.ReadFile(strings.TrimSuffix(archivePath, ".zip") + ".json")
+
+	if err != nil {
+		return err
+	}
+
+	var metadata map[string]any
+
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return err
+	}
+
+	metadata["packageUri"] = mirrored
+
+	if data, err = json.Marshal(metadata); err != nil {
+		return err
+	}
+
+	metaFile, err := os.CreateTemp("", "hpkl-mirror-*.json")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(metaFile.Name())
+
+	_, err = metaFile.Write(data)
+
+	if closeErr := metaFile.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Push(archivePath, metaFile.Name(), ref, mirrorProject(m, mirrored), registry.PushOptStrictMode(false))
+
+	return err
+}
+
+// mirrorProject describes m, mirrored at uri, as the project the registry client annotates
+// pushed packages with
+func mirrorProject(m *Metadata, uri string) *pkl.Project {
+	baseUri := uri
+	if u, err := url.Parse(uri); err == nil {
+		u.Path, _, _ = strings.Cut(u.Path, "@")
+		baseUri = u.String()
+	}
+
+	return &pkl.Project{
+		Package: &pkl.ProjectPackage{
+			Name:          m.Name,
+			Version:       m.Version,
+			BaseUri:       baseUri,
+			PackageZipUrl: m.PackageZipUrl,
+			Authors:       m.Authors,
+			Uri:           uri,
+		},
+	}
+}
@@ -0,0 +1,55 @@
+package app
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMirror(t *testing.T) {
+	source := newTestOciRegistry(t)
+	leaf := source.add(t, "leaf", "1.0.0", []byte("leaf"), false)
+	root := source.add(t, "root", "1.0.0", []byte("root"), false, leaf)
+	target := newTestOciRegistry(t)
+
+	r := newTestResolver(t)
+
+	resolved, err := r.Resolve(dependencySet(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := RegistryConfig{Host: target.host, Namespace: "mirror", PlainHttp: true}
+
+	if err := r.Mirror(resolved, config); err != nil {
+		t.Fatal(err)
+	}
+
+	if pushes := target.requestCount("pushes"); pushes != 2 {
+		t.Fatalf("expected 2 packages to be pushed, got %d", pushes)
+	}
+
+	mirrored := Dependency{Uri: fmt.Sprintf("package://%s/mirror/pkgs/leaf@1.0.0", target.host), Name: "leaf.oci"}
+
+	mirror := newTestResolver(t)
+
+	fromMirror, err := mirror.Resolve(dependencySet(mirrored))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m := fromMirror[mirrored.Uri]; m == nil || m.PackageUri != mirrored.Uri {
+		t.Errorf("expected the mirrored metadata to name %s, got %v", mirrored.Uri, m)
+	}
+
+	if _, err := mirror.Download(fromMirror); err != nil {
+		t.Fatalf("expected the mirrored archive to be downloadable: %v", err)
+	}
+
+	if err := r.Mirror(resolved, config); err != nil {
+		t.Fatal(err)
+	}
+
+	if pushes := target.requestCount("pushes"); pushes != 2 {
+		t.Errorf("expected mirrored packages to be skipped, got %d pushes", pushes)
+	}
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"hpkl.io/hpkl/pkg/registry"
+)
+
+// writeOciLayout exports a package as an OCI image layout in dir, its manifest
+// annotated with refName
+func writeOciLayout(t *testing.T, dir string, refName string, metadata []byte, archive []byte) {
+	writeBlob := func(mediaType string, data []byte) ocispec.Descriptor {
+		d := digest.FromBytes(data)
+		path := filepath.Join(dir, "blobs", d.Algorithm().String(), d.Encoded())
+
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, data, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+
+		return ocispec.Descriptor{MediaType: mediaType, Digest: d, Size: int64(len(data))}
+	}
+
+	marshal := func(v any) []byte {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	manifest := writeBlob(ocispec.MediaTypeImageManifest, marshal(ocispec.Manifest{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    writeBlob(registry.ConfigMediaType, []byte("{}")),
+		Layers: []ocispec.Descriptor{
+			writeBlob(registry.PackageLayerMediaType, archive),
+			writeBlob(registry.MetadataMediaType, metadata),
+		},
+	}))
+	manifest.Annotations = map[string]string{ocispec.AnnotationRefName: refName}
+
+	if err := os.WriteFile(filepath.Join(dir, "index.json"), marshal(ocispec.Index{MediaType: ocispec.MediaTypeImageIndex, Manifests: []ocispec.Descriptor{manifest}}), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, ocispec.ImageLayoutFile), marshal(ocispec.ImageLayout{Version: ocispec.ImageLayoutVersion}), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolveFromOciLayout(t *testing.T) {
+	archive := []byte("layout archive")
+	metadata := tarballMetadata("lib", archive)
+	metadata.PackageUri = "package://registry.invalid/pkgs/lib@1.0.0"
+
+	source, err := json.Marshal(metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layout := t.TempDir()
+	writeOciLayout(t, layout, "1.0.0", source, archive)
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.OciLayout = "oci:" + layout
+	})
+
+	resolved, err := r.Resolve(dependencySet(Dependency{Uri: metadata.PackageUri, Name: "lib.oci"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, ok := resolved[metadata.PackageUri]
+	if !ok || m.ResolverType != OCI || m.ManifestDigest == "" {
+		t.Fatalf("expected %s to be resolved from the oci layout, got %+v", metadata.PackageUri, resolved)
+	}
+
+	paths, err := r.Download(resolved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(paths[metadata.PackageUri])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != string(archive) {
+		t.Errorf("unexpected archive %q", data)
+	}
+
+	missing := Dependency{Uri: "package://registry.invalid/pkgs/lib@2.0.0", Name: "lib.oci"}
+	if _, err := r.Resolve(dependencySet(missing)); err == nil {
+		t.Errorf("expected a version missing from the oci layout not to be resolved")
+	}
+}
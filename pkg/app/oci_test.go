@@ -0,0 +1,554 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"hpkl.io/hpkl/pkg/registry"
+)
+
+// testOciRegistry is a minimal OCI distribution registry serving hpkl packages
+type testOciRegistry struct {
+	server    *httptest.Server
+	host      string
+	mu        sync.Mutex
+	blobs     map[digest.Digest][]byte
+	tags      map[string]digest.Digest
+	referrers map[digest.Digest][]ocispec.Descriptor
+	requests  map[string]int
+	uploads   map[string][]byte
+	archives  map[digest.Digest]bool
+	// archiveDelay holds archive blob responses until it elapses or the request is cancelled
+	archiveDelay time.Duration
+	// noReferrers makes the registry answer 404 on the referrers API
+	noReferrers bool
+	// omitDigest leaves out the optional Docker-Content-Digest header
+	omitDigest bool
+}
+
+func newTestOciRegistry(t *testing.T) *testOciRegistry {
+	reg := &testOciRegistry{
+		blobs:     make(map[digest.Digest][]byte),
+		tags:      make(map[string]digest.Digest),
+		referrers: make(map[digest.Digest][]ocispec.Descriptor),
+		requests:  make(map[string]int),
+		uploads:   make(map[string][]byte),
+		archives:  make(map[digest.Digest]bool),
+	}
+
+	reg.server = httptest.NewServer(http.HandlerFunc(reg.serve))
+	t.Cleanup(reg.server.Close)
+
+	u, err := url.Parse(reg.server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.host = u.Host
+
+	return reg
+}
+
+func (reg *testOciRegistry) serve(w http.ResponseWriter, req *http.Request) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	path := req.URL.Path
+
+	if path == "/v2/" {
+		return
+	}
+
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		reg.receive(w, req)
+		return
+	}
+
+	for _, kind := range []string{"manifests", "blobs", "referrers"} {
+		i := strings.LastIndex(path, "/"+kind+"/")
+		if !strings.HasPrefix(path, "/v2/") || i < 0 {
+			continue
+		}
+
+		repo := path[len("/v2/"):i]
+		ref := path[i+len(kind)+2:]
+		reg.requests[kind]++
+		reg.requests[path]++
+
+		switch kind {
+		case "referrers":
+			if reg.noReferrers {
+				http.NotFound(w, req)
+				return
+			}
+
+			data, _ := json.Marshal(ocispec.Index{
+				Versioned: specs.Versioned{SchemaVersion: 2},
+				MediaType: ocispec.MediaTypeImageIndex,
+				Manifests: reg.referrers[digest.Digest(ref)],
+			})
+			w.Header().Set("Content-Type", ocispec.MediaTypeImageIndex)
+			w.Write(data)
+			return
+		case "manifests":
+			d, ok := reg.tags[repo+":"+ref]
+			if !ok {
+				d = digest.Digest(ref)
+			}
+			reg.writeBlob(w, req, d, ocispec.MediaTypeImageManifest)
+			return
+		default:
+			if delay := reg.archiveDelay; reg.archives[digest.Digest(ref)] && delay > 0 {
+				reg.mu.Unlock()
+				select {
+				case <-time.After(delay):
+				case <-req.Context().Done():
+				}
+				reg.mu.Lock()
+			}
+			reg.writeBlob(w, req, digest.Digest(ref), "application/octet-stream")
+			return
+		}
+	}
+
+	http.NotFound(w, req)
+}
+
+// receive handles blob uploads and manifest pushes
+func (reg *testOciRegistry) receive(w http.ResponseWriter, req *http.Request) {
+	path := req.URL.Path
+	data, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if i := strings.Index(path, "/blobs/uploads/"); i >= 0 {
+		switch req.Method {
+		case http.MethodPost:
+			location := fmt.Sprintf("/v2/%s/blobs/uploads/%d", path[len("/v2/"):i], len(reg.uploads)+1)
+			reg.uploads[location] = nil
+			w.Header().Set("Location", location)
+			w.WriteHeader(http.StatusAccepted)
+		case http.MethodPatch:
+			reg.uploads[path] = append(reg.uploads[path], data...)
+			w.Header().Set("Location", path)
+			w.WriteHeader(http.StatusAccepted)
+		case http.MethodPut:
+			data = append(reg.uploads[path], data...)
+			d := digest.Digest(req.URL.Query().Get("digest"))
+			if d != digest.FromBytes(data) {
+				http.Error(w, "digest mismatch", http.StatusBadRequest)
+				return
+			}
+			reg.blobs[d] = data
+			reg.requests["uploads"]++
+			if !reg.omitDigest {
+				w.Header().Set("Docker-Content-Digest", d.String())
+			}
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	i := strings.LastIndex(path, "/manifests/")
+	if req.Method != http.MethodPut || !strings.HasPrefix(path, "/v2/") || i < 0 {
+		http.NotFound(w, req)
+		return
+	}
+
+	repo := path[len("/v2/"):i]
+	ref := path[i+len("/manifests/"):]
+	d := digest.FromBytes(data)
+	reg.blobs[d] = data
+	if _, err := digest.Parse(ref); err != nil {
+		reg.tags[repo+":"+ref] = d
+	}
+	reg.requests["pushes"]++
+
+	if !reg.omitDigest {
+		w.Header().Set("Docker-Content-Digest", d.String())
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (reg *testOciRegistry) writeBlob(w http.ResponseWriter, req *http.Request, d digest.Digest, mediaType string) {
+	data, ok := reg.blobs[d]
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaType)
+	if !reg.omitDigest {
+		w.Header().Set("Docker-Content-Digest", d.String())
+	}
+	w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+
+	if req.Method != http.MethodHead {
+		w.Write(data)
+	}
+}
+
+func (reg *testOciRegistry) addBlob(mediaType string, data []byte) ocispec.Descriptor {
+	d := digest.FromBytes(data)
+	reg.blobs[d] = data
+	return ocispec.Descriptor{MediaType: mediaType, Digest: d, Size: int64(len(data))}
+}
+
+func (reg *testOciRegistry) addManifest(t *testing.T, manifest ocispec.Manifest) ocispec.Descriptor {
+	manifest.Versioned = specs.Versioned{SchemaVersion: 2}
+	manifest.MediaType = ocispec.MediaTypeImageManifest
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	descriptor := reg.addBlob(ocispec.MediaTypeImageManifest, data)
+	descriptor.ArtifactType = manifest.ArtifactType
+	return descriptor
+}
+
+// add publishes a package under repo, attaching the metadata as a referrer
+// instead of a manifest layer when asReferrer is set
+func (reg *testOciRegistry) add(t *testing.T, name string, version string, archive []byte, asReferrer bool, deps ...Dependency) Dependency {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	uri := fmt.Sprintf("package://%s/pkgs/%s@%s", reg.host, name, version)
+	metadata := Metadata{
+		Name:         name,
+		PackageUri:   uri,
+		Version:      version,
+		Dependencies: make(map[string]Dependency),
+	}
+
+	for _, dep := range deps {
+		metadata.Dependencies[dep.Name] = Dependency{Uri: dep.Uri}
+	}
+
+	metadataData, err := json.Marshal(metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := reg.addBlob(registry.ConfigMediaType, []byte("{}"))
+	archiveLayer := reg.addBlob(registry.PackageLayerMediaType, archive)
+	reg.archives[archiveLayer.Digest] = true
+	metadataLayer := reg.addBlob(registry.MetadataMediaType, metadataData)
+
+	layers := []ocispec.Descriptor{archiveLayer}
+	if !asReferrer {
+		layers = append(layers, metadataLayer)
+	}
+
+	subject := reg.addManifest(t, ocispec.Manifest{Config: config, Layers: layers})
+	reg.tags["pkgs/"+name+":"+version] = subject.Digest
+
+	if asReferrer {
+		referrer := reg.addManifest(t, ocispec.Manifest{
+			ArtifactType: registry.MetadataMediaType,
+			Config:       config,
+			Layers:       []ocispec.Descriptor{metadataLayer},
+			Subject:      &subject,
+		})
+		reg.referrers[subject.Digest] = append(reg.referrers[subject.Digest], referrer)
+	}
+
+	return Dependency{Uri: uri, Name: name + ".oci"}
+}
+
+func (reg *testOciRegistry) requestCount(kind string) int {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	return reg.requests[kind]
+}
+
+func TestOciResolveMetadataFromReferrers(t *testing.T) {
+	reg := newTestOciRegistry(t)
+	leaf := reg.add(t, "leaf", "1.0.0", []byte("leaf"), true)
+	root := reg.add(t, "root", "1.0.0", []byte("root"), true, leaf)
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.OciReferrers = true
+	})
+
+	resolved, err := r.Resolve(dependencySet(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resolved) != 2 {
+		t.Fatalf("expected 2 resolved packages, got %d", len(resolved))
+	}
+
+	if metadata := resolved[leaf.Uri]; metadata == nil || metadata.Name != "leaf" || metadata.ResolverType != OCI {
+		t.Errorf("unexpected metadata for leaf: %+v", metadata)
+	}
+
+	if reg.requestCount("referrers") != 2 {
+		t.Errorf("expected metadata to be fetched through referrers, got %d referrers requests", reg.requestCount("referrers"))
+	}
+}
+
+func TestOciReferrersFallback(t *testing.T) {
+	reg := newTestOciRegistry(t)
+	reg.noReferrers = true
+	leaf := reg.add(t, "leaf", "1.0.0", []byte("leaf"), false)
+	root := reg.add(t, "root", "1.0.0", []byte("root"), false, leaf)
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.OciReferrers = true
+	})
+
+	resolved, err := r.Resolve(dependencySet(root))
+	if err != nil {
+		t.Fatalf("expected resolution to fall back to manifest layers, got %v", err)
+	}
+
+	if metadata := resolved[leaf.Uri]; metadata == nil || metadata.Name != "leaf" || metadata.ManifestDigest == "" {
+		t.Errorf("expected leaf to be resolved from its manifest, got %+v", metadata)
+	}
+
+	if count := reg.requestCount("referrers"); count != 1 {
+		t.Errorf("expected the referrers API to be probed once per host, got %d requests", count)
+	}
+}
+
+func TestOciReferrerDigestMismatch(t *testing.T) {
+	reg := newTestOciRegistry(t)
+	reg.omitDigest = true
+	leaf := reg.add(t, "leaf", "1.0.0", []byte("leaf"), true)
+
+	reg.mu.Lock()
+	for d, data := range reg.blobs {
+		if bytes.HasPrefix(data, []byte(`{"name":"leaf"`)) {
+			reg.blobs[d] = bytes.Replace(data, []byte(`"leaf"`), []byte(`"evil"`), 1)
+		}
+	}
+	reg.mu.Unlock()
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.OciReferrers = true
+	})
+
+	if _, err := r.Resolve(dependencySet(leaf)); err == nil || !strings.Contains(err.Error(), "digest mismatch") {
+		t.Errorf("expected the tampered metadata to be rejected, got %v", err)
+	}
+}
+
+func TestOciDownloadAbortsOnChecksumMismatch(t *testing.T) {
+	slow := newTestOciRegistry(t)
+	slow.archiveDelay = 3 * time.Second
+	first := slow.add(t, "first", "1.0.0", []byte("first"), false)
+
+	fast := newTestRegistry(t)
+	broken := fast.add(t, "broken", "1.0.0", []byte("broken"))
+	fast.serve("/broken@1.0.0.zip", []byte("corrupted"))
+
+	r := newTestResolver(t)
+
+	resolved, err := r.Resolve(dependencySet(first, broken))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	_, err = r.Download(resolved)
+	elapsed := time.Since(start)
+
+	if !errors.Is(err, ErrChecksumMismatch) || strings.Contains(err.Error(), first.Uri) {
+		t.Fatalf("expected only the checksum mismatch of %s to be reported, got %v", broken.Uri, err)
+	}
+
+	if elapsed >= slow.archiveDelay {
+		t.Errorf("expected the oci pull in flight to be cancelled, Download took %s", elapsed)
+	}
+
+	if exists, err := r.Exists(resolved[first.Uri]); err != nil || exists {
+		t.Errorf("expected the cancelled pull of %s not to be cached, got %v", first.Uri, err)
+	}
+}
+
+func TestOciResolveLatestTag(t *testing.T) {
+	reg := newTestOciRegistry(t)
+	reg.add(t, "lib", "1.1.0", []byte("old"), false)
+	concrete := reg.add(t, "lib", "1.2.0", []byte("new"), false)
+	reg.tags["pkgs/lib:latest"] = reg.tags["pkgs/lib:1.2.0"]
+
+	floating := Dependency{Uri: fmt.Sprintf("package://%s/pkgs/lib@latest", reg.host), Name: "lib.oci"}
+
+	r := newTestResolver(t)
+
+	resolved, err := r.Resolve(dependencySet(floating))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metadata, ok := resolved[concrete.Uri]
+	if !ok {
+		t.Fatalf("expected %s to be resolved to %s, got %v", floating.Uri, concrete.Uri, resolved)
+	}
+
+	lockfile, err := r.Lockfile(resolved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := lockfile.ResolvedDependencies[fmt.Sprintf("package://%s/pkgs/lib@1", reg.host)]
+	if entry == nil {
+		t.Fatalf("expected a lockfile entry for lib, got %v", lockfile.ResolvedDependencies)
+	}
+
+	if expected := fmt.Sprintf("projectpackage://%s/pkgs/lib@1.2.0", reg.host); entry.Uri != expected {
+		t.Errorf("expected lockfile to pin %s, got %s", expected, entry.Uri)
+	}
+
+	if entry.Requested != floating.Uri {
+		t.Errorf("expected lockfile to remember %s, got %s", floating.Uri, entry.Requested)
+	}
+
+	if expected := reg.tags["pkgs/lib:1.2.0"].String(); entry.Digest != expected || metadata.ManifestDigest != expected {
+		t.Errorf("expected lockfile to record digest %s, got %s", expected, entry.Digest)
+	}
+}
+
+func TestPing(t *testing.T) {
+	reg := newTestOciRegistry(t)
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	downHost := strings.TrimPrefix(down.URL, "http://")
+	down.Close()
+
+	r := newTestResolver(t)
+
+	if err := r.Ping([]string{reg.host}); err != nil {
+		t.Errorf("expected %s to be reachable, got %s", reg.host, err)
+	}
+
+	err := r.Ping([]string{reg.host, downHost})
+	if err == nil {
+		t.Fatalf("expected %s to be reported as unreachable", downHost)
+	}
+
+	if !strings.Contains(err.Error(), "registry "+downHost+":") || strings.Contains(err.Error(), "registry "+reg.host+":") {
+		t.Errorf("expected only %s to be reported, got %q", downHost, err)
+	}
+}
+
+func TestMetadataOnly(t *testing.T) {
+	reg := newTestRegistry(t)
+	httpLeaf := reg.add(t, "leaf", "1.0.0", []byte("leaf"))
+
+	ociReg := newTestOciRegistry(t)
+	ociLeaf := ociReg.add(t, "leaf", "1.0.0", []byte("oci leaf"), false)
+	ociRoot := ociReg.add(t, "root", "1.0.0", []byte("oci root"), false, ociLeaf)
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.MetadataOnly = true
+	})
+
+	resolved, err := r.Resolve(dependencySet(httpLeaf, ociRoot))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deduplicated, err := r.Deduplicate(resolved, DedupHighestVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Lockfile(deduplicated); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Download(deduplicated); !errors.Is(err, ErrMetadataOnly) {
+		t.Errorf("expected Download to be refused, got %v", err)
+	}
+
+	if count := reg.requestCount("/leaf@1.0.0.zip"); count != 0 {
+		t.Errorf("expected no http archive request, got %d", count)
+	}
+
+	for name, archive := range map[string]string{"leaf": "oci leaf", "root": "oci root"} {
+		path := fmt.Sprintf("/v2/pkgs/%s/blobs/%s", name, digest.FromString(archive))
+
+		if count := ociReg.requestCount(path); count != 0 {
+			t.Errorf("expected no oci archive request for %s, got %d", name, count)
+		}
+	}
+}
+
+func TestFloatingTagTTL(t *testing.T) {
+	reg := newTestOciRegistry(t)
+	reg.add(t, "lib", "1.0.0", []byte("old"), false)
+	reg.add(t, "lib", "1.1.0", []byte("new"), false)
+	reg.tags["pkgs/lib:latest"] = reg.tags["pkgs/lib:1.0.0"]
+
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+	t.Cleanup(func() { now = time.Now })
+
+	cacheDir := t.TempDir()
+	floating := Dependency{Uri: fmt.Sprintf("package://%s/pkgs/lib@latest", reg.host), Name: "lib.oci"}
+
+	resolve := func() (string, ResolutionSource) {
+		r := newTestResolver(t, func(config *AppConfig) {
+			config.CacheDir = cacheDir
+			config.FloatingTagTTL = time.Hour
+		})
+
+		resolved, sources, err := r.ResolveWithSources(dependencySet(floating))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for uri, metadata := range resolved {
+			return metadata.Version, sources[uri]
+		}
+
+		t.Fatal("expected latest to be resolved")
+		return "", NetworkFetch
+	}
+
+	manifestRequests := func() int {
+		return reg.requestCount("/v2/pkgs/lib/manifests/latest")
+	}
+
+	if version, source := resolve(); version != "1.0.0" || source != NetworkFetch {
+		t.Errorf("expected 1.0.0 from the registry, got %s from %d", version, source)
+	}
+
+	fetched := manifestRequests()
+
+	reg.mu.Lock()
+	reg.tags["pkgs/lib:latest"] = reg.tags["pkgs/lib:1.1.0"]
+	reg.mu.Unlock()
+
+	clock = clock.Add(30 * time.Minute)
+
+	if version, source := resolve(); version != "1.0.0" || source != DiskCache || manifestRequests() != fetched {
+		t.Errorf("expected the cached resolution before the TTL expired, got %s from %d", version, source)
+	}
+
+	clock = clock.Add(time.Hour)
+
+	if version, source := resolve(); version != "1.1.0" || source != NetworkFetch || manifestRequests() == fetched {
+		t.Errorf("expected latest to be re-fetched after the TTL expired, got %s from %d", version, source)
+	}
+}
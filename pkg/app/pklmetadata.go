@@ -0,0 +1,26 @@
+package app
+
+import (
+	"context"
+	"mime"
+	"path"
+	"slices"
+
+	"hpkl.io/hpkl/pkg/pklutils"
+)
+
+// pklMetadataTypes are the content types of metadata published as a pkl module
+var pklMetadataTypes = []string{"application/x-pkl", "text/x-pkl"}
+
+// evaluatePkl renders a pkl module as json, replaced in tests to avoid running pkl
+var evaluatePkl func(ctx context.Context, text string) ([]byte, error) = pklutils.EvaluateJson
+
+// isPklMetadata reports whether metadata served with contentType from urlPath is a
+// pkl module rather than json
+func isPklMetadata(contentType string, urlPath string) bool {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && slices.Contains(pklMetadataTypes, mediaType) {
+		return true
+	}
+
+	return path.Ext(urlPath) == ".pkl"
+}
@@ -0,0 +1,131 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestResolvePklMetadata(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/metadata.pkl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evaluated := false
+	evaluate := evaluatePkl
+	t.Cleanup(func() { evaluatePkl = evaluate })
+
+	// the json metadata.pkl evaluates to, so the test does not need pkl installed
+	evaluatePkl = func(ctx context.Context, text string) ([]byte, error) {
+		if text != string(fixture) {
+			t.Errorf("unexpected module evaluated:\n%s", text)
+		}
+		evaluated = true
+		return []byte(`{
+  "name": "fixture",
+  "packageUri": "package://example.com/fixture@1.0.0",
+  "version": "1.0.0",
+  "packageZipUrl": "fixture@1.0.0.zip",
+  "packageZipChecksums": {
+    "sha256": "f16d05ec6b29248d2c61adb1e9263f78e4f7bace1b955014a2d17872cfe4064d"
+  },
+  "authors": [
+    "hpkl"
+  ],
+  "dependencies": {},
+  "license": "Apache-2.0"
+}`), nil
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/fixture@1.0.0":
+			w.Header().Set("Content-Type", "application/x-pkl")
+			w.Write(fixture)
+		case "/fixture@1.0.0.zip":
+			w.Write([]byte("fixture"))
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	r := newTestResolver(t)
+	uri := "package://" + strings.TrimPrefix(server.URL, "http://") + "/fixture@1.0.0"
+
+	resolved, err := r.Resolve(dependencySet(Dependency{Uri: uri, Name: "fixture"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !evaluated {
+		t.Fatal("expected the pkl metadata to be evaluated")
+	}
+
+	if len(resolved) != 1 {
+		t.Fatalf("expected a single package, got %v", resolved)
+	}
+
+	for _, m := range resolved {
+		got := Metadata{
+			Name:                m.Name,
+			PackageUri:          m.PackageUri,
+			Version:             m.Version,
+			PackageZipUrl:       m.PackageZipUrl,
+			PackageZipChecksums: m.PackageZipChecksums,
+			Authors:             m.Authors,
+			License:             m.License,
+		}
+
+		want := Metadata{
+			Name:                "fixture",
+			PackageUri:          "package://example.com/fixture@1.0.0",
+			Version:             "1.0.0",
+			PackageZipUrl:       server.URL + "/fixture@1.0.0.zip",
+			PackageZipChecksums: Checksums{Sha256: "f16d05ec6b29248d2c61adb1e9263f78e4f7bace1b955014a2d17872cfe4064d"},
+			Authors:             []string{"hpkl"},
+			License:             "Apache-2.0",
+		}
+
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("unexpected metadata (-want +got):\n%s", diff)
+		}
+
+		if _, err := decodeMetadata(m.Source, true); err != nil {
+			t.Errorf("expected the evaluated json to be cached, got %v", err)
+		}
+	}
+
+	paths, err := r.Download(resolved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(paths) != 1 {
+		t.Errorf("expected the archive to be downloaded, got %v", paths)
+	}
+}
+
+func TestIsPklMetadata(t *testing.T) {
+	for _, tc := range []struct {
+		contentType string
+		path        string
+		expected    bool
+	}{
+		{"application/x-pkl", "/pkg@1.0.0", true},
+		{"text/x-pkl; charset=utf-8", "/pkg@1.0.0", true},
+		{"application/json", "/pkg@1.0.0.pkl", true},
+		{"application/json", "/pkg@1.0.0", false},
+		{"", "/pkg@1.0.0", false},
+	} {
+		if got := isPklMetadata(tc.contentType, tc.path); got != tc.expected {
+			t.Errorf("isPklMetadata(%q, %q) = %v, expected %v", tc.contentType, tc.path, got, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package app
+
+import "sort"
+
+type (
+	// ResolutionPlan describes a resolved dependency set for other tools, unlike the
+	// lockfile it is a snapshot of the resolution rather than a pin file
+	ResolutionPlan struct {
+		// Packages are sorted by package uri
+		Packages []PlannedPackage `json:"packages"`
+	}
+
+	// PlannedPackage is a resolved package of a ResolutionPlan
+	PlannedPackage struct {
+		Uri     string `json:"uri"`
+		Name    string `json:"name"`
+		Version string `json:"version"`
+		// Resolver is the protocol the package was resolved with, named like in the lockfile
+		Resolver string `json:"resolver"`
+		// Checksum is the sha256 of the package metadata
+		Checksum string `json:"checksum"`
+		// ArchiveChecksum is the sha256 of the package archive announced by the metadata
+		ArchiveChecksum string `json:"archiveChecksum,omitempty"`
+		// Cached is set when the archive is already in the cache and Download will not fetch it
+		Cached bool `json:"cached"`
+		// Dependencies are the sorted package uris the package directly depends on
+		Dependencies []string `json:"dependencies"`
+	}
+)
+
+// Plan describes every package of resolved, which Resolve returned
+func (r *Resolver) Plan(resolved map[string]*Metadata) (*ResolutionPlan, error) {
+	plan := &ResolutionPlan{Packages: make([]PlannedPackage, 0, len(resolved))}
+
+	for uri, m := range resolved {
+		cached, err := r.Exists(m)
+
+		if err != nil {
+			return nil, err
+		}
+
+		dependencies := declaredDependencies(m)
+		if dependencies == nil {
+			dependencies = []string{}
+		}
+
+		plan.Packages = append(plan.Packages, PlannedPackage{
+			Uri:             uri,
+			Name:            m.Name,
+			Version:         m.Version,
+			Resolver:        lockedResolvers[m.ResolverType],
+			Checksum:        m.Checksum,
+			ArchiveChecksum: m.PackageZipChecksums.Sha256,
+			Cached:          cached,
+			Dependencies:    dependencies,
+		})
+	}
+
+	sort.Slice(plan.Packages, func(i, j int) bool {
+		return plan.Packages[i].Uri < plan.Packages[j].Uri
+	})
+
+	return plan, nil
+}
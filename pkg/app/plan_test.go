@@ -0,0 +1,69 @@
+package app
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestResolutionPlan(t *testing.T) {
+	reg := newTestRegistry(t)
+	leaf := reg.add(t, "leaf", "1.0.0", []byte("leaf"))
+	root := reg.add(t, "root", "2.0.0", []byte("root"), leaf)
+
+	r := newTestResolver(t)
+
+	resolved, err := r.Resolve(dependencySet(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Download(map[string]*Metadata{leaf.Uri: resolved[leaf.Uri]}); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := r.Plan(resolved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var actual map[string]any
+	if err := json.Unmarshal(data, &actual); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]any{
+		"packages": []any{
+			map[string]any{
+				"uri":             leaf.Uri,
+				"name":            "leaf",
+				"version":         "1.0.0",
+				"resolver":        "http",
+				"checksum":        resolved[leaf.Uri].Checksum,
+				"archiveChecksum": resolved[leaf.Uri].PackageZipChecksums.Sha256,
+				"cached":          true,
+				"dependencies":    []any{},
+			},
+			map[string]any{
+				"uri":             root.Uri,
+				"name":            "root",
+				"version":         "2.0.0",
+				"resolver":        "http",
+				"checksum":        resolved[root.Uri].Checksum,
+				"archiveChecksum": resolved[root.Uri].PackageZipChecksums.Sha256,
+				"cached":          false,
+				"dependencies":    []any{leaf.Uri},
+			},
+		},
+	}
+
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Errorf("unexpected plan (-expected +actual):\n%s", diff)
+	}
+}
@@ -0,0 +1,86 @@
+package app
+
+import (
+	"context"
+	"maps"
+	"path/filepath"
+
+	"github.com/apple/pkl-go/pkl"
+	"hpkl.io/hpkl/pkg/pklutils"
+)
+
+// loadProject evaluates a PklProject file, replaced in tests to avoid running pkl
+var loadProject func(ctx context.Context, path string) (*pkl.Project, error) = pklutils.LoadProject
+
+// CollectRemoteDependencies returns the remote dependencies of a project, including
+// the ones declared by its local dependencies, keyed by package uri
+func CollectRemoteDependencies(dependecies *pkl.ProjectDependencies) map[string]Dependency {
+	result := make(map[string]Dependency)
+
+	if dependecies == nil {
+		return result
+	}
+
+	for _, dep := range dependecies.LocalDependencies {
+		if dep == nil || dep.Dependencies == nil {
+			continue
+		}
+
+		remote := dep.Dependencies.RemoteDependencies
+
+		for n, remoteDep := range remote {
+			result[remoteDep.PackageUri] = Dependency{Uri: remoteDep.PackageUri, Name: n, Checksums: declaredChecksums(remoteDep.Checksums)}
+		}
+
+		for _, localDep := range dep.Dependencies.LocalDependencies {
+			inner := CollectRemoteDependencies(localDep.Dependencies)
+			maps.Copy(result, inner)
+		}
+	}
+
+	for n, dep := range dependecies.RemoteDependencies {
+		result[dep.PackageUri] = Dependency{Uri: dep.PackageUri, Name: n, Checksums: declaredChecksums(dep.Checksums)}
+	}
+
+	return result
+}
+
+// declaredChecksums converts the checksums declared on a project dependency
+func declaredChecksums(checksums *pkl.Checksums) *Checksums {
+	if checksums == nil || checksums.Sha256 == "" {
+		return nil
+	}
+
+	return &Checksums{Sha256: checksums.Sha256}
+}
+
+// ResolveWorkspace resolves the union of the remote dependencies of every project
+// in projectDirs and deduplicates them across all projects
+func (r *Resolver) ResolveWorkspace(projectDirs []string) (map[string]*Metadata, error) {
+	dependencies := make(map[string]Dependency)
+
+	for _, dir := range projectDirs {
+		projectFile := filepath.Join(dir, "PklProject")
+		project, err := loadProject(r.config.ctx, projectFile)
+
+		if err != nil {
+			r.config.Logger.Error("Project file path: %s", projectFile)
+			return nil, err
+		}
+
+		for uri, dependency := range CollectRemoteDependencies(project.Dependencies()) {
+			if _, ok := dependencies[uri]; !ok {
+				dependency.ProjectFileUri = projectFile
+				dependencies[uri] = dependency
+			}
+		}
+	}
+
+	resolved, err := r.Resolve(dependencies)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Deduplicate(resolved, DedupHighestVersion)
+}
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/apple/pkl-go/pkl"
+	"hpkl.io/hpkl/pkg/pklutils"
+)
+
+// stubProjects makes loadProject return projects depending on the given packages
+func stubProjects(t *testing.T, projects map[string][]Dependency) {
+	loadProject = func(_ context.Context, path string) (*pkl.Project, error) {
+		deps, ok := projects[filepath.Dir(path)]
+		if !ok {
+			return nil, fmt.Errorf("no project at %s", path)
+		}
+
+		raw := make(map[string]any)
+		for _, dep := range deps {
+			raw[dep.Name] = &pkl.ProjectRemoteDependency{PackageUri: dep.Uri}
+		}
+
+		return &pkl.Project{ProjectFileUri: "file://" + path, RawDependencies: raw}, nil
+	}
+	t.Cleanup(func() { loadProject = pklutils.LoadProject })
+}
+
+func TestResolveWorkspace(t *testing.T) {
+	reg := newTestRegistry(t)
+	common := reg.add(t, "common", "1.0.0", []byte("zip"))
+	first := reg.add(t, "first", "1.0.0", []byte("zip"), common)
+	second := reg.add(t, "second", "1.0.0", []byte("zip"))
+
+	stubProjects(t, map[string][]Dependency{
+		"/ws/first":  {first, common},
+		"/ws/second": {second, common},
+	})
+
+	r := newTestResolver(t)
+
+	resolved, err := r.ResolveWorkspace([]string{"/ws/first", "/ws/second"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dep := range []Dependency{common, first, second} {
+		if _, ok := resolved[dep.Uri]; !ok {
+			t.Errorf("expected %s to be resolved", dep.Uri)
+		}
+	}
+
+	if len(resolved) != 3 {
+		t.Errorf("expected 3 packages, got %d", len(resolved))
+	}
+
+	if count := reg.requestCount("/common@1.0.0"); count != 1 {
+		t.Errorf("expected shared dependency to be fetched once, got %d", count)
+	}
+}
+
+func TestResolveWorkspaceConflictingPins(t *testing.T) {
+	reg := newTestRegistry(t)
+	common := reg.add(t, "common", "1.0.0", []byte("zip"))
+	newer := reg.add(t, "common", "2.0.0", []byte("zip"))
+
+	stubProjects(t, map[string][]Dependency{
+		"/ws/first":  {common},
+		"/ws/second": {newer},
+	})
+
+	r := newTestResolver(t)
+
+	_, err := r.ResolveWorkspace([]string{"/ws/first", "/ws/second"})
+	if err == nil {
+		t.Fatal("expected conflicting pins to be reported")
+	}
+
+	for _, project := range []string{"/ws/first/PklProject", "/ws/second/PklProject"} {
+		if !strings.Contains(err.Error(), project) {
+			t.Errorf("expected error to name %s, got %q", project, err.Error())
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package app
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// HttpProtocol selects the http version negotiated with registries over https
+type HttpProtocol int
+
+const (
+	// HttpProtocolAuto negotiates http/2 when the registry offers it, http/1.1 otherwise
+	HttpProtocolAuto HttpProtocol = iota
+	// HttpProtocolHttp1 never negotiates http/2
+	HttpProtocolHttp1
+	// HttpProtocolHttp2 fails requests to https registries that do not negotiate http/2,
+	// plain http requests keep using http/1.1
+	HttpProtocolHttp2
+)
+
+// ErrHttp2Required is returned with HttpProtocolHttp2 when a registry negotiated an older protocol
+var ErrHttp2Required = errors.New("registry did not negotiate http/2")
+
+// http2Transport rejects the https responses not served over http/2
+type http2Transport struct {
+	transport http.RoundTripper
+}
+
+// withProtocol configures transport for protocol and returns the round tripper enforcing it
+func withProtocol(protocol HttpProtocol, transport *http.Transport) http.RoundTripper {
+	switch protocol {
+	case HttpProtocolHttp1:
+		transport.ForceAttemptHTTP2 = false
+		// a non-nil empty map disables http/2
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+		return transport
+	case HttpProtocolHttp2:
+		transport.ForceAttemptHTTP2 = true
+		return &http2Transport{transport: transport}
+	default:
+		return transport
+	}
+}
+
+func (t *http2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.transport.RoundTrip(req)
+
+	if err != nil || req.URL.Scheme != "https" || resp.ProtoMajor == 2 {
+		return resp, err
+	}
+
+	resp.Body.Close()
+	return nil, fmt.Errorf("%w: %s answered with %s", ErrHttp2Required, req.URL.Host, resp.Proto)
+}
@@ -0,0 +1,62 @@
+package app
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHttpProtocol(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(req.Proto))
+	})
+
+	h2 := httptest.NewUnstartedServer(handler)
+	h2.EnableHTTP2 = true
+	h2.StartTLS()
+	t.Cleanup(h2.Close)
+
+	h1 := httptest.NewTLSServer(handler)
+	t.Cleanup(h1.Close)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(h2.Certificate())
+	pool.AddCert(h1.Certificate())
+
+	client := func(protocol HttpProtocol) *http.Client {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+		return &http.Client{Transport: withProtocol(protocol, transport)}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		protocol HttpProtocol
+		server   *httptest.Server
+		expected int
+	}{
+		{"auto negotiates http/2", HttpProtocolAuto, h2, 2},
+		{"auto falls back to http/1.1", HttpProtocolAuto, h1, 1},
+		{"http1 disables http/2", HttpProtocolHttp1, h2, 1},
+		{"http2 uses http/2", HttpProtocolHttp2, h2, 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := client(tc.protocol).Get(tc.server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.ProtoMajor != tc.expected {
+				t.Errorf("expected HTTP/%d, got %s", tc.expected, resp.Proto)
+			}
+		})
+	}
+
+	if _, err := client(HttpProtocolHttp2).Get(h1.URL); !errors.Is(err, ErrHttp2Required) {
+		t.Errorf("expected http/1.1 to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// ErrQuotaExceeded is returned when a resolution or download exceeds AppConfig.MaxPackages
+// or AppConfig.MaxDownloadBytes, the error names the limit hit
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+type (
+	// downloadQuota counts the archive bytes fetched by a single Download
+	downloadQuota struct {
+		limit int64
+		used  atomic.Int64
+	}
+
+	// quotaReader fails once more than remaining bytes are read
+	quotaReader struct {
+		reader    io.Reader
+		remaining int64
+		limit     int64
+	}
+
+	// downloadQuotaKey carries the downloadQuota of a Download in the context of its fetches
+	downloadQuotaKey struct{}
+)
+
+// add counts n fetched bytes, failing once more than AppConfig.MaxDownloadBytes were fetched
+func (q *downloadQuota) add(n int) error {
+	if q.limit <= 0 {
+		return nil
+	}
+
+	if used := q.used.Add(int64(n)); used > q.limit {
+		return fmt.Errorf("%w: MaxDownloadBytes of %d bytes, %d bytes downloaded", ErrQuotaExceeded, q.limit, used)
+	}
+
+	return nil
+}
+
+// limitReader returns reader failing beyond the bytes left in the quota, so an oversized
+// archive is rejected while it is read instead of once it is buffered whole. A nil
+// quota or one without limit leaves reader as is.
+func (q *downloadQuota) limitReader(reader io.Reader) io.Reader {
+	if q == nil || q.limit <= 0 {
+		return reader
+	}
+
+	return &quotaReader{reader: reader, remaining: q.limit - q.used.Load(), limit: q.limit}
+}
+
+func (r *quotaReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.remaining -= int64(n)
+
+	if r.remaining < 0 {
+		return n, fmt.Errorf("%w: MaxDownloadBytes of %d bytes", ErrQuotaExceeded, r.limit)
+	}
+
+	return n, err
+}
+
+// withDownloadQuota returns ctx carrying quota to the resolvers fetching the archives
+func withDownloadQuota(ctx context.Context, quota *downloadQuota) context.Context {
+	return context.WithValue(ctx, downloadQuotaKey{}, quota)
+}
+
+// downloadQuotaFrom returns the quota carried by ctx, nil when there is none
+func downloadQuotaFrom(ctx context.Context) *downloadQuota {
+	quota, _ := ctx.Value(downloadQuotaKey{}).(*downloadQuota)
+	return quota
+}
+
+// checkPackageQuota fails when count packages exceed AppConfig.MaxPackages
+func (r *Resolver) checkPackageQuota(count int) error {
+	if limit := r.config.MaxPackages; limit > 0 && count > limit {
+		return fmt.Errorf("%w: MaxPackages of %d packages", ErrQuotaExceeded, limit)
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMaxPackagesQuota(t *testing.T) {
+	reg := newTestRegistry(t)
+	leaf := reg.add(t, "leaf", "1.0.0", []byte("leaf"))
+	lib := reg.add(t, "lib", "1.0.0", []byte("lib"), leaf)
+	app := reg.add(t, "app", "1.0.0", []byte("app"), lib)
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.MaxPackages = 2
+	})
+
+	_, err := r.Resolve(dependencySet(app))
+	if !errors.Is(err, ErrQuotaExceeded) || !strings.Contains(err.Error(), "MaxPackages") {
+		t.Fatalf("expected the package quota to be exceeded, got %v", err)
+	}
+
+	r.config.MaxPackages = 0
+
+	resolved, err := r.Resolve(dependencySet(app))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.config.MaxPackages = 2
+
+	_, err = r.Download(resolved)
+	if !errors.Is(err, ErrQuotaExceeded) || !strings.Contains(err.Error(), "MaxPackages") {
+		t.Errorf("expected the download to exceed the package quota, got %v", err)
+	}
+
+	if count := reg.requestCount("/leaf@1.0.0.zip"); count != 0 {
+		t.Errorf("expected no archive to be fetched, got %d requests", count)
+	}
+}
+
+func TestMaxDownloadBytesQuota(t *testing.T) {
+	reg := newTestRegistry(t)
+	first := reg.add(t, "first", "1.0.0", []byte("0123456789"))
+	second := reg.add(t, "second", "1.0.0", []byte("0123456789"))
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.MaxDownloadBytes = 15
+	})
+
+	resolved, err := r.Resolve(dependencySet(first, second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = r.Download(resolved)
+	if !errors.Is(err, ErrQuotaExceeded) || !strings.Contains(err.Error(), "MaxDownloadBytes") {
+		t.Fatalf("expected the download quota to be exceeded, got %v", err)
+	}
+
+	r.config.MaxDownloadBytes = 20
+
+	if _, err := r.Download(resolved); err != nil {
+		t.Errorf("expected the quota to be counted per download, got %v", err)
+	}
+}
+
+func TestMaxDownloadBytesStopsOversizedArchive(t *testing.T) {
+	reg := newTestRegistry(t)
+	dep := reg.add(t, "lib", "1.0.0", []byte("lib"))
+
+	// the archive streams far more than the quota, the download must stop reading it early
+	const streamed = 256 << 20
+	var written atomic.Int64
+	reg.intercept = func(w http.ResponseWriter, req *http.Request) bool {
+		if req.URL.Path != "/lib@1.0.0.zip" {
+			return true
+		}
+
+		chunk := bytes.Repeat([]byte("x"), 64<<10)
+		for written.Load() < streamed {
+			n, err := w.Write(chunk)
+			written.Add(int64(n))
+
+			if err != nil {
+				break
+			}
+		}
+
+		return false
+	}
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.MaxDownloadBytes = 1 << 10
+	})
+
+	resolved, err := r.Resolve(dependencySet(dep))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = r.Download(resolved)
+	if !errors.Is(err, ErrQuotaExceeded) || !strings.Contains(err.Error(), "MaxDownloadBytes") {
+		t.Fatalf("expected the download quota to be exceeded, got %v", err)
+	}
+
+	if n := written.Load(); n >= streamed {
+		t.Errorf("expected the archive to be abandoned once over the quota, %d bytes were sent", n)
+	}
+}
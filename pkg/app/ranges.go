@@ -0,0 +1,157 @@
+package app
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrRangeUnsupported is returned by ExtractPaths when the archive server does not
+// answer range requests, the full archive has to be downloaded instead
+var ErrRangeUnsupported = errors.New("archive server does not support range requests")
+
+// rangeReader reads a remote archive through http range requests
+type rangeReader struct {
+	client *http.Client
+	url    string
+	size   int64
+}
+
+// ExtractPaths extracts the entries of the archive of m listed in paths into destDir
+// without downloading the whole archive. The zip central directory and the selected
+// entries are fetched with range requests. As the archive is never complete, its
+// checksum cannot be verified, entries are only checked against their zip CRC-32.
+func (r *Resolver) ExtractPaths(m *Metadata, destDir string, paths []string) error {
+	if m.ResolverType != HTTP {
+		return fmt.Errorf("partial extraction of %s: %w", m.PackageUri, ErrRangeUnsupported)
+	}
+
+	if err := r.checkPlainArchive(m); err != nil {
+		return err
+	}
+
+	reader, err := newRangeReader(r.httpResolver.client, m.PackageZipUrl)
+
+	if err != nil {
+		return fmt.Errorf("partial extraction of %s: %w", m.PackageUri, err)
+	}
+
+	archive, err := zip.NewReader(reader, reader.size)
+
+	if err != nil {
+		return fmt.Errorf("invalid archive of %s: %w", m.PackageUri, err)
+	}
+
+	var selected []*zip.File
+	targets := make(map[*zip.File]string)
+
+	for _, file := range archive.File {
+		if !slices.Contains(paths, strings.TrimSuffix(file.Name, "/")) {
+			continue
+		}
+
+		target, err := extractTarget(destDir, file)
+
+		if err != nil {
+			return fmt.Errorf("invalid archive of %s: %w", m.PackageUri, err)
+		}
+
+		selected = append(selected, file)
+		targets[file] = target
+	}
+
+	for _, path := range paths {
+		if !slices.ContainsFunc(selected, func(file *zip.File) bool { return strings.TrimSuffix(file.Name, "/") == path }) {
+			return fmt.Errorf("archive of %s has no entry %s", m.PackageUri, path)
+		}
+	}
+
+	r.config.Logger.Info("Extracting %d entries of %s into %s", len(selected), m.PackageUri, destDir)
+
+	for _, file := range selected {
+		if err := extractFile(file, targets[file]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newRangeReader probes url with a single byte range request to learn the archive size
+func newRangeReader(client *http.Client, url string) (*rangeReader, error) {
+	reader := &rangeReader{client: client, url: url}
+	resp, err := reader.get(0, 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body.Close()
+
+	_, total, found := strings.Cut(resp.Header.Get("Content-Range"), "/")
+	size, err := strconv.ParseInt(total, 10, 64)
+
+	if !found || err != nil {
+		return nil, fmt.Errorf("%w: invalid Content-Range %q", ErrRangeUnsupported, resp.Header.Get("Content-Range"))
+	}
+
+	reader.size = size
+
+	return reader, nil
+}
+
+func (r *rangeReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.size {
+		return 0, io.EOF
+	}
+
+	end := min(off+int64(len(p)), r.size) - 1
+	resp, err := r.get(off, end)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer resp.Body.Close()
+
+	n, err := io.ReadFull(resp.Body, p[:end-off+1])
+
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+
+	return n, err
+}
+
+func (r *rangeReader) get(start int64, end int64) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, r.url, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+
+	resp, err := r.client.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusOK {
+			return nil, ErrRangeUnsupported
+		}
+
+		return nil, fmt.Errorf("Http get %s error status: %s", r.url, resp.Status)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,58 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// RedirectPolicy controls which redirects to another host http registries may answer with
+type RedirectPolicy int
+
+const (
+	// RedirectAllowAll follows redirects to any host
+	RedirectAllowAll RedirectPolicy = iota
+	// RedirectSameHost rejects redirects to another host, which may be a dependency confusion
+	RedirectSameHost
+	// RedirectAllowlist follows redirects to another host only when listed in AppConfig.RedirectHosts
+	RedirectAllowlist
+)
+
+// maxRedirects is the limit of redirects followed for a request, the one of the http package
+const maxRedirects = 10
+
+// ErrCrossHostRedirect is returned when a registry redirects to a host the RedirectPolicy rejects
+var ErrCrossHostRedirect = errors.New("cross host redirect rejected")
+
+// withRedirectPolicy returns httpClient enforcing the AppConfig.RedirectPolicy
+func withRedirectPolicy(appConfig *AppConfig, httpClient *http.Client) *http.Client {
+	if appConfig.RedirectPolicy == RedirectAllowAll {
+		return httpClient
+	}
+
+	client := *httpClient
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+
+		origin := via[0].URL
+
+		if req.URL.Host == origin.Host || redirectAllowed(appConfig, req) {
+			return nil
+		}
+
+		return fmt.Errorf("%w: %s to %s", ErrCrossHostRedirect, origin.Host, req.URL.Host)
+	}
+
+	return &client
+}
+
+func redirectAllowed(appConfig *AppConfig, req *http.Request) bool {
+	if appConfig.RedirectPolicy != RedirectAllowlist {
+		return false
+	}
+
+	return slices.Contains(appConfig.RedirectHosts, req.URL.Host) || slices.Contains(appConfig.RedirectHosts, req.URL.Hostname())
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestRedirectPolicy(t *testing.T) {
+	reg := newTestRegistry(t)
+	reg.add(t, "lib", "1.0.0", []byte("lib"))
+
+	redirecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Redirect(w, req, reg.server.URL+req.URL.Path, http.StatusFound)
+	}))
+	t.Cleanup(redirecting.Close)
+
+	u, err := url.Parse(redirecting.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uri := "package://" + u.Host + "/lib@1.0.0"
+
+	tests := []struct {
+		name     string
+		policy   RedirectPolicy
+		hosts    []string
+		rejected bool
+	}{
+		{name: "allow all", policy: RedirectAllowAll},
+		{name: "same host", policy: RedirectSameHost, rejected: true},
+		{name: "allowlisted", policy: RedirectAllowlist, hosts: []string{reg.host}},
+		{name: "not allowlisted", policy: RedirectAllowlist, hosts: []string{"cdn.example.com"}, rejected: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newTestResolver(t, func(config *AppConfig) {
+				config.RedirectPolicy = test.policy
+				config.RedirectHosts = test.hosts
+			})
+
+			metadata, err := r.httpResolver.ResolveMetadata(uri, true)
+
+			if test.rejected {
+				if !errors.Is(err, ErrCrossHostRedirect) {
+					t.Errorf("expected the redirect to %s to be rejected, got %v", reg.host, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if metadata.RedirectedHost != reg.host {
+				t.Errorf("expected the redirected host %s to be recorded, got %q", reg.host, metadata.RedirectedHost)
+			}
+		})
+	}
+}
+
+func TestRedirectedRelativeArchiveUrl(t *testing.T) {
+	reg := newTestRegistry(t)
+	reg.publish(t, "/pkgs/lib@1.0.0", Metadata{Name: "lib", Version: "1.0.0", PackageZipUrl: "./lib@1.0.0.zip"}, []byte("lib"))
+
+	// only the metadata is redirected, the archive is served by reg alone
+	redirecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/pkgs/lib@1.0.0" {
+			http.NotFound(w, req)
+			return
+		}
+		http.Redirect(w, req, reg.server.URL+req.URL.Path, http.StatusFound)
+	}))
+	t.Cleanup(redirecting.Close)
+
+	u, err := url.Parse(redirecting.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newTestResolver(t)
+
+	metadata, err := r.httpResolver.ResolveMetadata("package://"+u.Host+"/pkgs/lib@1.0.0", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := reg.server.URL + "/pkgs/lib@1.0.0.zip"; metadata.PackageZipUrl != expected {
+		t.Errorf("expected the archive url to be relative to the redirected metadata %s, got %s", expected, metadata.PackageZipUrl)
+	}
+
+	archive, err := r.httpResolver.ResolveArchive(metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(archive) != "lib" {
+		t.Errorf("expected archive %q, got %q", "lib", archive)
+	}
+}
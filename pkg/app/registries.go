@@ -0,0 +1,81 @@
+package app
+
+import (
+	"errors"
+	"net/url"
+	"slices"
+)
+
+// ErrPackageNotFound is returned by resolvers when a registry does not hold the requested package
+var ErrPackageNotFound = errors.New("package not found")
+
+// registryCandidates returns the uris uri is resolved from, in order. When the host of uri
+// is one of AppConfig.Registries, the package is looked up on every registry of the list.
+func (r *Resolver) registryCandidates(uri string) []string {
+	if len(r.config.Registries) == 0 || isGithubUri(uri) {
+		return []string{uri}
+	}
+
+	u, err := url.Parse(uri)
+
+	if err != nil || !slices.Contains(r.config.Registries, u.Host) {
+		return []string{uri}
+	}
+
+	candidates := make([]string, 0, len(r.config.Registries))
+
+	for _, host := range r.config.Registries {
+		candidate := *u
+		candidate.Host = host
+		candidates = append(candidates, candidate.String())
+	}
+
+	return candidates
+}
+
+// resolveFromRegistries resolves the metadata of uri from the first registry holding it,
+// only a missing package falls back to the next registry
+func (r *Resolver) resolveFromRegistries(resolver DependencyResolver, uri string, plainHttp bool) (*Metadata, error) {
+	var notFound []error
+
+	for _, candidate := range r.registryCandidates(uri) {
+		metadata, err := resolver.ResolveMetadata(candidate, plainHttp)
+
+		if err == nil {
+			if u, err := url.Parse(candidate); err == nil {
+				metadata.Registry = u.Host
+			}
+
+			if candidate != uri {
+				r.config.Logger.Info("Resolved %s from fallback registry %s", uri, metadata.Registry)
+				metadata.advise(AdvisoryRegistryFallback, "resolved from fallback registry %s", metadata.Registry)
+			}
+
+			return metadata, nil
+		}
+
+		if !errors.Is(err, ErrPackageNotFound) {
+			return nil, err
+		}
+
+		notFound = append(notFound, err)
+	}
+
+	return nil, errors.Join(notFound...)
+}
+
+// registryUri returns the package uri on the registry that served the metadata
+func (m *Metadata) registryUri() string {
+	if m.Registry == "" {
+		return m.PackageUri
+	}
+
+	u, err := url.Parse(m.PackageUri)
+
+	if err != nil || u.Host == m.Registry {
+		return m.PackageUri
+	}
+
+	u.Host = m.Registry
+	return u.String()
+}
@@ -0,0 +1,180 @@
+package app
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Repair fixes the cache entries reported by Audit and the incomplete ones, whose
+// metadata is cached without archive. Their metadata is resolved again and their
+// archive downloaded again, healthy entries are left untouched. Entries are looked up
+// with the resolver they were stored with, like the dependencies of a lockfile.
+func (r *Resolver) Repair() error {
+	findings, err := r.Audit()
+
+	if err != nil {
+		return err
+	}
+
+	broken := make(map[string]string, len(findings))
+	for _, finding := range findings {
+		broken[finding.Uri] = filepath.Dir(finding.Path)
+	}
+
+	incomplete, err := r.listIncomplete()
+
+	if err != nil {
+		return err
+	}
+
+	for uri, dir := range incomplete {
+		broken[uri] = dir
+	}
+
+	uris := make([]string, 0, len(broken))
+	for uri := range broken {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+
+	resolved := make(map[string]*Metadata, len(broken))
+	var errs []error
+
+	for _, uri := range uris {
+		r.config.Logger.Info("Repairing %s", uri)
+
+		dependency := cachedDependency(broken[uri], uri)
+
+		if err := r.evict(broken[uri]); err != nil {
+			errs = append(errs, fmt.Errorf("repair of %s: %w", uri, err))
+			continue
+		}
+
+		metadata, _, err := r.fetchMetadata(dependency)
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("repair of %s: %w", uri, err))
+			continue
+		}
+
+		resolved[uri] = metadata
+	}
+
+	if len(resolved) > 0 {
+		if _, err := r.Download(resolved); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// listIncomplete returns the directory of every cached package whose metadata is
+// stored without archive, by package uri
+func (r *Resolver) listIncomplete() (map[string]string, error) {
+	incomplete := make(map[string]string)
+
+	if _, err := os.Stat(r.basePath); errors.Is(err, os.ErrNotExist) {
+		return incomplete, nil
+	}
+
+	err := filepath.WalkDir(r.basePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".json") {
+			return nil
+		}
+
+		if _, err := os.Stat(strings.TrimSuffix(path, ".json") + ".zip"); !errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		metadata, err := readMetadataFile(path)
+
+		if err != nil || metadata.PackageUri == "" {
+			r.config.Logger.Error("Skipping cache entry %s: %v", path, err)
+			return nil
+		}
+
+		incomplete[metadata.PackageUri] = filepath.Dir(path)
+		return nil
+	})
+
+	return incomplete, err
+}
+
+// evict removes the cached package stored in dir along with the blob its archive
+// was linked to, which shares a corrupted content
+func (r *Resolver) evict(dir string) error {
+	metaPath := filepath.Join(dir, filepath.Base(dir)+".json")
+
+	if metadata, err := readMetadataFile(metaPath); err == nil && metadata.PackageZipChecksums.Sha256 != "" {
+		if digest, err := DecodeSha256(metadata.PackageZipChecksums.Sha256); err == nil {
+			blobPath := filepath.Join(r.basePath, blobsDir, "sha256", hex.EncodeToString(digest)+".zip")
+
+			if err := os.Remove(blobPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+
+	return os.RemoveAll(dir)
+}
+
+// storeCachedResolver records next to the package stored in dir the resolver m was
+// resolved with, so the package can be resolved again once its cache entry is evicted
+func storeCachedResolver(dir string, m *Metadata) error {
+	data, err := json.Marshal(ResolvedDependency{
+		DependencyType: "remote",
+		Uri:            m.PackageUri,
+		Resolver:       lockedResolvers[m.ResolverType],
+		PlainHttp:      m.PlainHttp,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return writeFile(filepath.Join(dir, filepath.Base(dir)+".resolver"), data, os.ModePerm)
+}
+
+// cachedDependency returns the dependency resolving uri with the resolver recorded by
+// storeCachedResolver in dir, or without resolver suffix for entries stored without it
+func cachedDependency(dir string, uri string) Dependency {
+	data, err := os.ReadFile(filepath.Join(dir, filepath.Base(dir)+".resolver"))
+
+	if err != nil {
+		return Dependency{Uri: uri}.Normalize()
+	}
+
+	var locked ResolvedDependency
+	if err := json.Unmarshal(data, &locked); err != nil || locked.Uri != uri {
+		return Dependency{Uri: uri}.Normalize()
+	}
+
+	return lockedDependency(&locked)
+}
+
+func readMetadataFile(path string) (*Metadata, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata Metadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, err
+	}
+
+	return &metadata, nil
+}
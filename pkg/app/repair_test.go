@@ -0,0 +1,113 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRepair(t *testing.T) {
+	reg := newTestRegistry(t)
+	healthy := reg.add(t, "healthy", "1.0.0", []byte("healthy"))
+	corrupted := reg.add(t, "corrupted", "1.0.0", []byte("corrupted"))
+	incomplete := reg.add(t, "incomplete", "1.0.0", []byte("incomplete"))
+
+	r := newTestResolver(t)
+
+	resolved, err := r.Resolve(dependencySet(healthy, corrupted, incomplete))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := r.Download(resolved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(paths[corrupted.Uri], []byte("tampered"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(paths[incomplete.Uri]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Repair(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]int{"/healthy@1.0.0.zip": 1, "/corrupted@1.0.0.zip": 2, "/incomplete@1.0.0.zip": 2}
+
+	for path, count := range expected {
+		if actual := reg.requestCount(path); actual != count {
+			t.Errorf("expected %d requests of %s, got %d", count, path, actual)
+		}
+	}
+
+	for uri, path := range paths {
+		archive, err := os.ReadFile(path)
+		if err != nil {
+			t.Errorf("expected the archive of %s to be cached: %s", uri, err)
+			continue
+		}
+
+		if name := filepath.Base(filepath.Dir(path)); string(archive)+"@1.0.0" != name {
+			t.Errorf("unexpected archive of %s: %q", uri, archive)
+		}
+	}
+
+	findings, err := r.Audit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(findings) != 0 {
+		t.Errorf("expected the repaired cache to pass the audit, got %+v", findings)
+	}
+}
+
+func TestRepairOciPackage(t *testing.T) {
+	reg := newTestOciRegistry(t)
+	dep := reg.add(t, "lib", "1.0.0", []byte("lib"), false)
+
+	cacheDir := t.TempDir()
+	configure := func(config *AppConfig) {
+		config.CacheDir = cacheDir
+	}
+
+	r := newTestResolver(t, configure)
+
+	resolved, err := r.Resolve(dependencySet(dep))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := r.Download(resolved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(paths[dep.Uri]); err != nil {
+		t.Fatal(err)
+	}
+
+	// a new process knows the package from the cache directory alone
+	repairing := newTestResolver(t, configure)
+
+	if err := repairing.Repair(); err != nil {
+		t.Fatal(err)
+	}
+
+	if archive, err := os.ReadFile(paths[dep.Uri]); err != nil || string(archive) != "lib" {
+		t.Errorf("expected the archive to be pulled from the oci registry again, got %q, %v", archive, err)
+	}
+
+	findings, err := repairing.Audit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(findings) != 0 {
+		t.Errorf("expected the repaired cache to pass the audit, got %+v", findings)
+	}
+}
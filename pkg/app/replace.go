@@ -0,0 +1,84 @@
+package app
+
+import (
+	"maps"
+	"strings"
+)
+
+// replaceDependency applies the AppConfig.Replace directive matching dependency, if any.
+// Directives are keyed by a full package uri or a versionless one and point to either
+// another package uri or just another version of the same package.
+func (r *Resolver) replaceDependency(dependency Dependency) (Dependency, bool) {
+	if len(r.config.Replace) == 0 {
+		return dependency, false
+	}
+
+	base, _, err := SplitPackageUri(dependency.Uri)
+
+	if err != nil {
+		return dependency, false
+	}
+
+	target, ok := r.config.Replace[dependency.Uri]
+
+	if !ok {
+		target, ok = r.config.Replace[base]
+	}
+
+	if !ok {
+		return dependency, false
+	}
+
+	if !strings.Contains(target, "://") {
+		target = base + "@" + target
+	}
+
+	if target == dependency.Uri {
+		return dependency, false
+	}
+
+	r.config.Logger.Info("Replacing %s with %s", dependency.Uri, target)
+
+	dependency.Uri = target
+
+	return dependency, true
+}
+
+// PreviewReplace reports the resolved packages the replace directives, applied on top of
+// AppConfig.Replace, would change in the graph of dependencies. Both resolutions use a
+// scratch memory cache, archives are never downloaded and the configuration is unchanged.
+func (r *Resolver) PreviewReplace(dependencies map[string]Dependency, replaces map[string]string) (UpgradeReport, error) {
+	before, err := r.previewResolver(r.config.Replace).Resolve(dependencies)
+
+	if err != nil {
+		return UpgradeReport{}, err
+	}
+
+	replace := maps.Clone(r.config.Replace)
+	if replace == nil {
+		replace = make(map[string]string, len(replaces))
+	}
+	maps.Copy(replace, replaces)
+
+	after, err := r.previewResolver(replace).Resolve(dependencies)
+
+	if err != nil {
+		return UpgradeReport{}, err
+	}
+
+	return r.UpgradeSummary(before, after), nil
+}
+
+// previewResolver returns a view of r applying the replace directives, with its own
+// memory cache and closures so previews never leak into regular resolutions
+func (r *Resolver) previewResolver(replace map[string]string) *Resolver {
+	config := *r.config
+	config.Replace = replace
+	config.MetadataOnly = true
+
+	scoped := r.withConfig(&config)
+	scoped.cache = newMetadataCache(r.config.CacheMaxEntries)
+	scoped.closures = newDependencyClosures(r.config.CacheMaxEntries)
+
+	return scoped
+}
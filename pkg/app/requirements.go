@@ -0,0 +1,126 @@
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// RequirementsFile declares the dependencies of directories without a PklProject
+const RequirementsFile = "hpkl.deps"
+
+// ParseRequirements reads dependencies declared one per line as uri @version, optionally
+// followed by the sha256 of the archive, as in
+//
+//	# comment
+//	package://example.com/lib @1.2.3 sha256:4f1b... # pinned archive
+//
+// The name of each dependency is the last segment of its uri. The result is keyed by
+// versioned package uri like the dependencies given to Resolve.
+func ParseRequirements(r io.Reader) (map[string]Dependency, error) {
+	dependencies := make(map[string]Dependency)
+	scanner := bufio.NewScanner(r)
+	line := 0
+
+	for scanner.Scan() {
+		line++
+
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(text)
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		dependency, err := parseRequirement(fields)
+
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if _, ok := dependencies[dependency.Uri]; ok {
+			return nil, fmt.Errorf("line %d: %s is declared twice", line, dependency.Uri)
+		}
+
+		dependencies[dependency.Uri] = dependency
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return dependencies, nil
+}
+
+// parseRequirement parses the fields of a requirement line, uri @version [sha256:digest]
+func parseRequirement(fields []string) (Dependency, error) {
+	uri, rest := fields[0], fields[1:]
+
+	if len(rest) > 0 && strings.HasPrefix(rest[0], "@") {
+		uri += rest[0]
+		rest = rest[1:]
+	}
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return Dependency{}, err
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return Dependency{}, fmt.Errorf("invalid package uri %s", uri)
+	}
+
+	base, _, err := SplitPackageUri(uri)
+
+	if err != nil {
+		return Dependency{}, err
+	}
+
+	baseUrl, err := url.Parse(base)
+
+	if err != nil {
+		return Dependency{}, err
+	}
+
+	dependency := Dependency{Uri: uri, Name: path.Base(baseUrl.Path)}
+
+	if len(rest) > 0 {
+		checksum := rest[0]
+		rest = rest[1:]
+
+		if !strings.HasPrefix(strings.ToLower(checksum), sha256Prefix) {
+			return Dependency{}, fmt.Errorf("unsupported checksum %s of %s, expected sha256:<digest>", checksum, uri)
+		}
+
+		if _, err := DecodeSha256(checksum); err != nil {
+			return Dependency{}, err
+		}
+
+		dependency.Checksums = &Checksums{Sha256: checksum}
+	}
+
+	if len(rest) > 0 {
+		return Dependency{}, fmt.Errorf("unexpected %q after %s", strings.Join(rest, " "), uri)
+	}
+
+	return dependency, nil
+}
+
+// LoadRequirements parses the RequirementsFile of workingDir
+func LoadRequirements(workingDir string) (map[string]Dependency, error) {
+	file, err := os.Open(filepath.Join(workingDir, RequirementsFile))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	return ParseRequirements(file)
+}
@@ -0,0 +1,92 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseRequirements(t *testing.T) {
+	sum := sha256.Sum256([]byte("lib"))
+	checksum := "sha256:" + hex.EncodeToString(sum[:])
+
+	requirements := strings.Join([]string{
+		"# dependencies of the docs",
+		"",
+		"package://example.com/org/lib @1.2.3 " + checksum + " # pinned",
+		"   ",
+		"package://example.com/org/tool@2.0.0",
+	}, "\n")
+
+	actual, err := ParseRequirements(strings.NewReader(requirements))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]Dependency{
+		"package://example.com/org/lib@1.2.3":  {Uri: "package://example.com/org/lib@1.2.3", Name: "lib", Checksums: &Checksums{Sha256: checksum}},
+		"package://example.com/org/tool@2.0.0": {Uri: "package://example.com/org/tool@2.0.0", Name: "tool"},
+	}
+
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Errorf("unexpected requirements (-expected +actual):\n%s", diff)
+	}
+
+	for _, invalid := range []string{
+		"package://example.com/lib",
+		"package://example.com/lib @1.0.0 md5:abcd",
+		"package://example.com/lib @1.0.0 sha256:abcd",
+		"package://example.com/lib @1.0.0 sha256:" + hex.EncodeToString(sum[:]) + " extra",
+		"package://example.com/lib @1.0.0\npackage://example.com/lib @1.0.0",
+	} {
+		if _, err := ParseRequirements(strings.NewReader(invalid)); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestResolveRequirements(t *testing.T) {
+	reg := newTestRegistry(t)
+	leaf := reg.add(t, "leaf", "1.0.0", []byte("leaf"))
+	reg.add(t, "lib", "1.0.0", []byte("lib"), leaf)
+	reg.add(t, "tampered", "1.0.0", []byte("tampered"))
+
+	sum := sha256.Sum256([]byte("lib"))
+	other := sha256.Sum256([]byte("other"))
+
+	dir := t.TempDir()
+	requirements := fmt.Sprintf("# resolved without a PklProject\npackage://%[1]s/lib @1.0.0 sha256:%[2]s\n\npackage://%[1]s/tampered @1.0.0 sha256:%[3]s # wrong\n",
+		reg.host, hex.EncodeToString(sum[:]), hex.EncodeToString(other[:]))
+
+	if err := os.WriteFile(filepath.Join(dir, RequirementsFile), []byte(requirements), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	dependencies, err := LoadRequirements(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newTestResolver(t)
+
+	resolved, err := r.Resolve(dependencies)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := resolved[leaf.Uri]; !ok || len(resolved) != 3 {
+		t.Errorf("expected the requirements and their dependencies to be resolved, got %v", resolved)
+	}
+
+	_, err = r.Download(resolved)
+	if !errors.Is(err, ErrChecksumMismatch) || !strings.Contains(err.Error(), "tampered") {
+		t.Errorf("expected the archive not matching its requirement checksum to be rejected, got %v", err)
+	}
+}
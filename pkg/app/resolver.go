@@ -1,6 +1,8 @@
 package app
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
@@ -11,9 +13,11 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/Masterminds/semver/v3"
 	"hpkl.io/hpkl/pkg/pklutils"
 	"hpkl.io/hpkl/pkg/registry"
 )
@@ -23,6 +27,10 @@ type (
 
 	Checksums struct {
 		Sha256 string `json:"sha256"`
+		Sha512 string `json:"sha512,omitempty"`
+		// Digests holds checksums of other algorithms by name, verified with the hash
+		// registered by RegisterChecksumAlgorithm
+		Digests map[string]string `json:"digests,omitempty"`
 	}
 
 	Dependency struct {
@@ -40,40 +48,110 @@ type (
 		PackageZipChecksums Checksums             `json:"packageZipChecksums"`
 		Authors             []string              `json:"authors"`
 		Dependencies        map[string]Dependency `json:"dependencies"`
+		License             string                `json:"license,omitempty"`
 		ResolverType        ResolverType          `json:"-"`
 		PlainHttp           bool                  `json:"-"`
 		Checksum            string                `json:"-"`
 		Source              []byte                `json:"-"`
+		ManifestDigest      string                `json:"-"`
+		// Requested holds the floating uri, like pkg@latest, this package was resolved from
+		Requested string `json:"-"`
+		// Replaced holds the uri a replace directive redirected to this package
+		Replaced string `json:"-"`
+		// ExpiresAt is when metadata resolved from a floating uri becomes stale
+		ExpiresAt time.Time `json:"-"`
+		// Registry is the host of the registry that served the metadata
+		Registry string `json:"-"`
+		// RedirectedHost is the host an http registry redirected the metadata request to
+		RedirectedHost string `json:"-"`
+		// ResolvedAt is when the metadata was fetched or loaded from the cache directory
+		ResolvedAt time.Time `json:"-"`
+		// DeclaredChecksums are the archive checksums declared by the project, enforced
+		// by Download regardless of the registry metadata
+		DeclaredChecksums *Checksums `json:"-"`
+		// Advisories are the non-ideal paths taken to resolve this package, see Advisories
+		Advisories []Advisory `json:"-"`
 	}
 
 	Resolver struct {
-		ociResolver  *OciResolver
-		httpResolver *HttpResolver
-		basePath     string
-		cache        map[string]*Metadata
-		config       *AppConfig
+		ociResolver    *OciResolver
+		httpResolver   *HttpResolver
+		githubResolver *GithubResolver
+		grpcResolver   *GrpcResolver
+		basePath       string
+		cache          *metadataCache
+		snapshot       IndexSnapshot
+		versionListers map[ResolverType]VersionLister
+		closures       *dependencyClosures
+		trust          *trustStore
+		config         *AppConfig
+		// blobMu serializes writes to the content addressed archive store, it is
+		// shared with the resolvers scoped by ResolveContext and DownloadContext
+		blobMu *sync.Mutex
+		stats  *resolverCounters
+		// tarballResolver serves every package when AppConfig.RegistryTarball is set
+		tarballResolver *TarballResolver
+		timings         *Timings
+		// tiers are the package base paths of the cache tiers read after basePath
+		tiers []string
+		// comparator replaces the default version precedence when set, see WithVersionComparator
+		comparator VersionComparator
 	}
 
+	// ResolverOption allows overriding settings derived from the AppConfig
+	ResolverOption func(*Resolver)
+
 	DependencyResolver interface {
 		ResolveMetadata(uri string, plainHttp bool) (*Metadata, error)
 		ResolveArchive(metadata *Metadata) ([]byte, error)
 	}
 
+	// archiveContextResolver is implemented by the resolvers able to abort an archive
+	// download when its context is cancelled
+	archiveContextResolver interface {
+		ResolveArchiveContext(ctx context.Context, metadata *Metadata) ([]byte, error)
+	}
+
 	OciResolver struct {
 		client      *registry.Client
 		plainClient *registry.Client
 		config      *AppConfig
+		// layout serves every package instead of the registries when AppConfig.OciLayout is set
+		layout *registry.Layout
+		// noReferrers holds the hosts found not to support the referrers API, their
+		// metadata is read from the manifest layer without probing them again. It is
+		// shared with the resolvers scoped by ResolveContext.
+		noReferrers *sync.Map
 	}
 
 	HttpResolver struct {
 		config    *AppConfig
+		client    *http.Client
 		plainHttp bool
+		// index loads the metadata of the bundled index by package uri once, it is
+		// shared with the resolvers scoped by ResolveContext
+		index func() map[string]json.RawMessage
 	}
 
 	ResolvedDependency struct {
 		DependencyType string            `json:"type"`
-		Uri            string            `json:"uri"`
-		Checksums      map[string]string `json:"checksums"`
+		Uri            string            `json:"uri,omitempty"`
+		Path           string            `json:"path,omitempty"`
+		Checksums      map[string]string `json:"checksums,omitempty"`
+		// Requested is the floating uri the dependency was declared with, if any
+		Requested string `json:"requested,omitempty"`
+		// Digest is the manifest digest of OCI packages
+		Digest string `json:"digest,omitempty"`
+		// Dependencies are the package uris the dependency declared when it was locked
+		Dependencies []string `json:"dependencies,omitempty"`
+		// Resolver is the protocol the dependency was resolved with: oci, http, github, grpc or tarball
+		Resolver string `json:"resolver,omitempty"`
+		// PlainHttp is set when the dependency was resolved over plain http
+		PlainHttp bool `json:"plainHttp,omitempty"`
+		// Source is the registry host that served the dependency, recorded with AppConfig.RecordProvenance
+		Source string `json:"source,omitempty"`
+		// ResolvedAt is when the dependency was resolved, in RFC 3339, recorded with AppConfig.RecordProvenance
+		ResolvedAt string `json:"resolvedAt,omitempty"`
 	}
 
 	ProjectDependencies struct {
@@ -85,30 +163,156 @@ type (
 const (
 	OCI ResolverType = iota
 	HTTP
+	GITHUB
+	GRPC
+	TARBALL
+)
+
+// ResolutionSource tells where the metadata of a resolved package came from
+type ResolutionSource int
+
+const (
+	// NetworkFetch metadata was fetched from the registry
+	NetworkFetch ResolutionSource = iota
+	// CacheHit metadata was found in the in-memory cache
+	CacheHit
+	// DiskCache metadata was read from a package stored in the cache directory
+	DiskCache
 )
 
-func NewResolver(appConfig *AppConfig) (*Resolver, error) {
-	oci, err := NewOciResolver(appConfig)
+// ErrMetadataOnly is returned by Download when AppConfig.MetadataOnly forbids fetching archives
+var ErrMetadataOnly = errors.New("archive downloads are disabled in metadata only mode")
+
+// ErrResolveDepthExceeded is returned by Resolve when a dependency chain is longer than AppConfig.MaxResolveDepth
+var ErrResolveDepthExceeded = errors.New("maximum dependency depth exceeded")
+
+// defaultMaxResolveDepth is used when AppConfig.MaxResolveDepth is not set
+const defaultMaxResolveDepth = 64
+
+// defaultDownloadConcurrency is used when AppConfig.DownloadConcurrency is not set
+const defaultDownloadConcurrency = 8
+
+// writeFile is replaced in tests to simulate failing writes
+var writeFile = os.WriteFile
+
+// WithBasePath overrides the package cache path derived from AppConfig.CacheDir
+func WithBasePath(basePath string) ResolverOption {
+	return func(r *Resolver) {
+		r.basePath = basePath
+	}
+}
+
+// WithIndexSnapshot pins the available package versions used to resolve version constraints
+func WithIndexSnapshot(snapshot IndexSnapshot) ResolverOption {
+	return func(r *Resolver) {
+		r.snapshot = snapshot
+	}
+}
+
+func NewResolver(appConfig *AppConfig, options ...ResolverOption) (*Resolver, error) {
+	if err := checkTokenConfig(appConfig); err != nil {
+		return nil, err
+	}
+
+	httpClient, err := newHttpClient(appConfig)
 
 	if err != nil {
 		return nil, err
 	}
 
-	http := NewHttpResolver(appConfig)
+	oci, err := NewOciResolver(appConfig, httpClient)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &Resolver{
-		ociResolver:  oci,
-		httpResolver: http,
-		basePath:     filepath.Join(appConfig.CacheDir, "package-2"),
-		config:       appConfig,
-		cache:        make(map[string]*Metadata),
-	}, nil
+	http := NewHttpResolver(appConfig, httpClient)
+
+	cacheEntries := appConfig.CacheMaxEntries
+	if appConfig.DisableMemoryCache {
+		cacheEntries = -1
+	}
+
+	resolver := &Resolver{
+		ociResolver:    oci,
+		httpResolver:   http,
+		githubResolver: NewGithubResolver(appConfig, httpClient),
+		grpcResolver:   NewGrpcResolver(appConfig),
+		basePath:       filepath.Join(appConfig.CacheDir, "package-2"),
+		config:         appConfig,
+		cache:          newMetadataCache(cacheEntries),
+		closures:       newDependencyClosures(cacheEntries),
+		blobMu:         new(sync.Mutex),
+		stats:          new(resolverCounters),
+		versionListers: map[ResolverType]VersionLister{OCI: oci, HTTP: http},
+	}
+
+	if appConfig.SignatureMode != SignatureOff {
+		resolver.trust, err = loadTrustStore(appConfig.TrustedKeys)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := validateExcludes(appConfig.Exclude); err != nil {
+		return nil, err
+	}
+
+	for host, scheme := range appConfig.ArchiveSchemes {
+		if scheme != "http" && scheme != "https" {
+			return nil, fmt.Errorf("invalid archive scheme %s for host %s, expected http or https", scheme, host)
+		}
+	}
+
+	if appConfig.RegistryTarball != "" {
+		resolver.tarballResolver = NewTarballResolver(appConfig)
+	}
+
+	if len(appConfig.CacheTiers) > 0 {
+		if resolver.basePath, resolver.tiers, err = cacheTiers(appConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, option := range options {
+		option(resolver)
+	}
+
+	if err := checkCacheDir(resolver.basePath); err != nil {
+		return nil, err
+	}
+
+	return resolver, nil
+}
+
+// checkCacheDir creates the cache directory if needed and verifies it is writable,
+// so a misconfigured cache fails at startup rather than in the middle of a download
+func checkCacheDir(dir string) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf("invalid cache directory %s: %w", dir, err)
+	}
+
+	probe, err := os.CreateTemp(dir, ".write-check-*")
+
+	if err != nil {
+		return fmt.Errorf("cache directory %s is not writable: %w", dir, err)
+	}
+
+	probe.Close()
+
+	return os.Remove(probe.Name())
 }
 
+type DedupMode int
+
+const (
+	// DedupHighestVersion keeps only the highest version within each major version
+	DedupHighestVersion DedupMode = iota
+	// DedupNone keeps every resolved version side by side
+	DedupNone
+)
+
 func (r *Resolver) MajorVersionPackage(metadata *Metadata) (string, error) {
 
 	baseUri, err := url.Parse(metadata.PackageUri)
@@ -119,9 +323,14 @@ func (r *Resolver) MajorVersionPackage(metadata *Metadata) (string, error) {
 
 	mapUri := *baseUri
 	mapUri.Scheme = "package"
-	mapUri.Path = strings.Replace(mapUri.Path, fmt.Sprintf("@%s", metadata.Version), "", 1)
+	mapUri.Path, _, _ = strings.Cut(mapUri.Path, "@")
+
+	versionParsed, err := parseVersion(metadata.Version)
+
+	if err != nil {
+		return "", fmt.Errorf("invalid version %s of %s: %w", metadata.Version, metadata.PackageUri, err)
+	}
 
-	versionParsed := semver.MustParse(metadata.Version)
 	majorVersion := fmt.Sprintf("@%x", versionParsed.Major())
 	mapUri.Path += majorVersion
 
@@ -129,7 +338,16 @@ func (r *Resolver) MajorVersionPackage(metadata *Metadata) (string, error) {
 
 }
 
-func (r *Resolver) Deduplicate(dependecies map[string]*Metadata) (map[string]*Metadata, error) {
+// Deduplicate collapses the resolved packages according to mode, keying the result by package uri
+func (r *Resolver) Deduplicate(dependecies map[string]*Metadata, mode DedupMode) (map[string]*Metadata, error) {
+	if mode == DedupNone {
+		result := make(map[string]*Metadata, len(dependecies))
+		for _, dep := range dependecies {
+			result[dep.PackageUri] = dep
+		}
+		return result, nil
+	}
+
 	versioned := make(map[string]*Metadata)
 
 	for _, dep := range dependecies {
@@ -138,13 +356,10 @@ func (r *Resolver) Deduplicate(dependecies map[string]*Metadata) (map[string]*Me
 			exists, ok := versioned[depVersion]
 			if !ok {
 				versioned[depVersion] = dep
-			} else {
-				verDep := semver.MustParse(dep.Version)
-				verExists := semver.MustParse(exists.Version)
-
-				if verDep.GreaterThan(verExists) {
-					versioned[depVersion] = dep
-				}
+			} else if supersedes, err := r.supersedes(dep, exists); err != nil {
+				return nil, err
+			} else if supersedes {
+				versioned[depVersion] = dep
 			}
 		} else {
 			return nil, err
@@ -159,277 +374,1368 @@ func (r *Resolver) Deduplicate(dependecies map[string]*Metadata) (map[string]*Me
 	return result, nil
 }
 
+// supersedes reports whether Deduplicate keeps dep over exists, another version of the
+// same package and major version
+func (r *Resolver) supersedes(dep *Metadata, exists *Metadata) (bool, error) {
+	verDep, err := parseVersion(dep.Version)
+	if err != nil {
+		return false, err
+	}
+
+	verExists, err := parseVersion(exists.Version)
+	if err != nil {
+		return false, err
+	}
+
+	// versions differing only by build metadata share the same precedence,
+	// the highest uri is kept so the choice does not depend on map order
+	return r.preferVersion(verDep, verExists) || (!r.preferVersion(verExists, verDep) && dep.PackageUri > exists.PackageUri), nil
+}
+
+// resolvedUri returns the concrete uri of the package when it was requested by the floating uri
+func (m *Metadata) resolvedUri(uri string) string {
+	if m.Requested != "" && m.Requested == uri && m.PackageUri != "" {
+		return m.PackageUri
+	}
+
+	return uri
+}
+
 func (r *Resolver) Resolve(dependencies map[string]Dependency) (map[string]*Metadata, error) {
-	logger := r.config.Logger
-	result := make(map[string]*Metadata)
+	result, _, err := r.ResolveWithSources(dependencies)
 
-	for _, dependency := range dependencies {
-		metadata, ok := r.cache[dependency.Uri]
-		dependencyName := dependency.Name
-		if !ok {
-			var resolver DependencyResolver
-
-			if strings.HasSuffix(dependencyName, ".oci") {
-				logger.Info("Resolving: %s as %+v proto: oci", dependencyName, dependency)
-				resolver = r.ociResolver
-			} else {
-				logger.Info("Resolving: %s as %+v proto: http", dependencyName, dependency)
-				resolver = r.httpResolver
-			}
+	return result, err
+}
 
-			plain := strings.Contains(dependencyName, ".plain")
+// ResolveWithSources resolves dependencies like Resolve and additionally reports
+// for every package uri where its metadata was found
+func (r *Resolver) ResolveWithSources(dependencies map[string]Dependency) (map[string]*Metadata, map[string]ResolutionSource, error) {
+	result := make(map[string]*Metadata)
+	sources := make(map[string]ResolutionSource)
 
-			metadata, err := resolver.ResolveMetadata(dependency.Uri, plain)
+	err := r.walk(dependencies, false, func(uri string, metadata *Metadata, source ResolutionSource) error {
+		result[uri] = metadata
+		sources[uri] = source
+		return nil
+	})
 
-			if err != nil {
-				logger.Error("Metadata resolving error: %s - %+v", dependencyName, dependency)
-				return nil, err
-			}
+	if err != nil {
+		return nil, nil, err
+	}
 
-			for metadataName, metadataDep := range metadata.Dependencies {
-				metadataDep.Name = metadataName
-				metadata.Dependencies[metadataName] = metadataDep
-			}
+	return result, sources, nil
+}
 
-			r.cache[dependency.Uri] = metadata
-			result[dependency.Uri] = metadata
+// ResolveStream resolves dependencies like Resolve but hands each package to callback
+// as soon as its metadata is resolved instead of collecting the whole graph.
+// An error returned by callback stops the resolution and is returned as is.
+func (r *Resolver) ResolveStream(dependencies map[string]Dependency, callback func(*Metadata) error) error {
+	return r.walk(dependencies, false, func(_ string, metadata *Metadata, _ ResolutionSource) error {
+		return callback(metadata)
+	})
+}
 
-			if len(metadata.Dependencies) > 0 {
-				subs, err := r.Resolve(metadata.Dependencies)
+// ResolveDirect resolves the metadata of dependencies only, without walking the
+// dependencies they declare
+func (r *Resolver) ResolveDirect(dependencies map[string]Dependency) (map[string]*Metadata, error) {
+	result := make(map[string]*Metadata)
 
-				if err != nil {
-					return nil, err
-				}
+	err := r.walk(dependencies, true, func(uri string, metadata *Metadata, _ ResolutionSource) error {
+		result[uri] = metadata
+		return nil
+	})
 
-				for u, d := range subs {
-					result[u] = d
-				}
-			}
-		} else {
-			result[dependency.Uri] = metadata
-		}
+	if err != nil {
+		return nil, err
 	}
+
 	return result, nil
 }
 
-func (r *Resolver) Exists(metadata *Metadata) (bool, error) {
-	baseUri, err := url.Parse(metadata.PackageUri)
+// resolveState is the bookkeeping of a single walk over the dependency graph
+type resolveState struct {
+	// visited makes cycles terminate even when the memory cache evicts entries
+	visited map[string]bool
+	// edges maps package uris to the concrete uris of their dependencies, "" holds the roots
+	edges map[string][]string
+	// chain holds the uris of the packages leading to the dependencies being resolved
+	chain []string
+	// direct stops the walk at the given dependencies
+	direct bool
+	visit  func(string, *Metadata, ResolutionSource) error
+	// roots holds the versionless uris of the given dependencies
+	roots map[string]bool
+	// declared holds the checksums declared for the given dependencies, by package uri
+	declared map[string]*Checksums
+	// replaced holds the uri a replace directive redirected, by the package uri it resolved to
+	replaced map[string]string
+}
 
-	if err != nil {
-		return false, err
+// annotate returns metadata of uri with the declared checksums and the replacement of this
+// walk applied. They are set on a copy since metadata is shared through the memory cache
+// with other resolutions, which neither declared nor replaced the same dependencies.
+func (s *resolveState) annotate(uri string, metadata *Metadata) *Metadata {
+	declared, isDeclared := s.declared[uri]
+	requested, isReplaced := s.replaced[uri]
+
+	if !isDeclared && !isReplaced {
+		return metadata
 	}
 
-	basePath := pklutils.PklGetRelativePath(r.basePath, baseUri)
+	annotated := *metadata
+	annotated.Advisories = slices.Clone(metadata.Advisories)
 
-	if _, err := os.Stat(basePath); errors.Is(err, os.ErrNotExist) {
-		return false, nil
-	} else {
-		return true, nil
+	if isDeclared {
+		annotated.DeclaredChecksums = declared
+	}
+
+	if isReplaced {
+		annotated.Replaced = requested
+		annotated.adviseReplaced(requested)
 	}
 
+	return &annotated
 }
 
-func (r *Resolver) Download(dependencies map[string]*Metadata) error {
+func (r *Resolver) walk(dependencies map[string]Dependency, direct bool, visit func(string, *Metadata, ResolutionSource) error) error {
+	dependencies, err := normalizeDependencies(dependencies)
+
+	if err != nil {
+		return err
+	}
+
+	if err := ValidateConstraints(dependencies); err != nil {
+		return err
+	}
+
+	if r.config.MaxPackages > 0 {
+		count, inner := 0, visit
+
+		visit = func(uri string, metadata *Metadata, source ResolutionSource) error {
+			count++
+
+			if count > r.config.MaxPackages {
+				return fmt.Errorf("resolving %s: %w", uri, r.checkPackageQuota(count))
+			}
+
+			return inner(uri, metadata, source)
+		}
+	}
+
+	state := &resolveState{
+		visited:  make(map[string]bool),
+		edges:    make(map[string][]string),
+		direct:   direct,
+		visit:    visit,
+		roots:    make(map[string]bool, len(dependencies)),
+		declared: make(map[string]*Checksums),
+		replaced: make(map[string]string),
+	}
+
+	for _, dependency := range dependencies {
+		if base, _, err := SplitPackageUri(dependency.Uri); err == nil {
+			state.roots[base] = true
+		}
+
+		if dependency.Checksums != nil && dependency.Checksums.Sha256 != "" {
+			state.declared[dependency.Uri] = dependency.Checksums
+		}
+	}
+
+	if err := r.resolve(dependencies, "", state); err != nil {
+		return err
+	}
+
+	// the closures of a direct walk are incomplete
+	if !direct {
+		r.recordClosures(state)
+	}
+
+	return nil
+}
 
+// resolve walks dependencies of parent depth first calling visit once per package uri
+func (r *Resolver) resolve(dependencies map[string]Dependency, parent string, state *resolveState) error {
 	logger := r.config.Logger
 
-	for u, m := range dependencies {
-		e, err := r.Exists(m)
+	for _, dependency := range dependencies {
+		requested := dependency.Uri
+		dependency, replaced := r.replaceDependency(dependency)
+
+		// excluded transitive dependencies are skipped along with their subtree
+		if parent != "" && r.excluded(requested, dependency.Uri) {
+			r.warnExcluded(parent, requested, state)
+			continue
+		}
+
+		if err := r.checkPlainHttp(dependency); err != nil {
+			return err
+		}
+
+		uri, err := r.resolveVersion(dependency)
 
 		if err != nil {
 			return err
 		}
+		dependency.Uri = uri
+		state.edges[parent] = append(state.edges[parent], uri)
 
-		if !e {
-			var resolver DependencyResolver
+		if replaced {
+			state.replaced[uri] = requested
 
-			if m.ResolverType == OCI {
-				logger.Info("Downloading %s proto: oci", u)
-				resolver = r.ociResolver
-			} else {
-				logger.Info("Downloading %s proto: http", u)
-				resolver = r.httpResolver
+			if parent == "" && dependency.Checksums != nil && dependency.Checksums.Sha256 != "" {
+				state.declared[uri] = dependency.Checksums
 			}
+		}
 
-			bytes, err := resolver.ResolveArchive(m)
+		if state.visited[dependency.Uri] {
+			continue
+		}
 
-			if err != nil {
+		if !state.direct {
+			if ok, err := r.visitClosure(dependency.Uri, state); err != nil {
 				return err
+			} else if ok {
+				continue
 			}
+		}
 
-			baseUri, err := url.Parse(u)
+		if err := r.checkDepth(dependency.Uri, state); err != nil {
+			return err
+		}
 
-			if err != nil {
-				return err
-			}
+		state.visited[dependency.Uri] = true
 
-			basePath := pklutils.PklGetRelativePath(r.basePath, baseUri)
-			err = os.MkdirAll(basePath, os.ModePerm)
+		metadata, source, err := r.fetchMetadata(dependency)
 
-			if err != nil {
-				return err
-			}
+		if err != nil {
+			return err
+		}
 
-			metaPath := filepath.Join(basePath, fmt.Sprintf("%s@%s.json", m.Name, m.Version))
-			archivePath := filepath.Join(basePath, fmt.Sprintf("%s@%s.zip", m.Name, m.Version))
+		resolvedUri := metadata.resolvedUri(dependency.Uri)
 
-			if err != nil {
-				return err
+		if resolvedUri != dependency.Uri {
+			logger.Info("Resolved floating %s to %s", dependency.Uri, resolvedUri)
+
+			if state.visited[resolvedUri] {
+				continue
 			}
 
-			err = os.WriteFile(metaPath, m.Source, os.ModePerm)
+			state.visited[resolvedUri] = true
+		}
 
-			if err != nil {
-				return err
-			}
+		if err := state.visit(resolvedUri, state.annotate(dependency.Uri, metadata), source); err != nil {
+			return err
+		}
 
-			err = os.WriteFile(archivePath, bytes, os.ModePerm)
+		if len(metadata.Dependencies) > 0 && !state.direct {
+			state.chain = append(state.chain, dependency.Uri)
+			err := r.resolve(metadata.Dependencies, dependency.Uri, state)
+			state.chain = state.chain[:len(state.chain)-1]
 
 			if err != nil {
 				return err
 			}
 		}
 	}
-
 	return nil
 }
 
-func NewOciResolver(appConfig *AppConfig) (*OciResolver, error) {
-	var client, err = registry.NewClient(registry.WithPlainHttp(appConfig.PlainHttp))
-	if err != nil {
-		return nil, err
+// checkDepth fails when resolving uri below the current chain exceeds AppConfig.MaxResolveDepth
+func (r *Resolver) checkDepth(uri string, state *resolveState) error {
+	maxDepth := r.config.MaxResolveDepth
+	if maxDepth <= 0 {
+		maxDepth = defaultMaxResolveDepth
 	}
 
-	plainClient, err := registry.NewClient(registry.WithPlainHttp(true))
-
-	if err != nil {
-		return nil, err
+	if len(state.chain) < maxDepth {
+		return nil
 	}
 
-	return &OciResolver{client: client, plainClient: plainClient, config: appConfig}, nil
+	chain := append(slices.Clone(state.chain), uri)
+
+	return fmt.Errorf("%w (%d): %s", ErrResolveDepthExceeded, maxDepth, strings.Join(chain, " -> "))
 }
 
-func (r *OciResolver) ResolveMetadata(uri string, plainHttp bool) (*Metadata, error) {
-	ref, err := pklutils.PklUriToRef(uri)
+// fetchMetadata looks up the metadata of dependency and updates the resolver counters
+func (r *Resolver) fetchMetadata(dependency Dependency) (*Metadata, ResolutionSource, error) {
+	start := r.timings.start()
+	metadata, source, err := r.lookupMetadata(dependency)
 
-	if err != nil {
-		return nil, err
+	if err == nil {
+		r.timings.record(metadata.PackageUri, start, metadataTiming)
 	}
 
-	client := r.client
-	if plainHttp {
-		client = r.plainClient
+	switch {
+	case err != nil:
+		r.stats.errors.Add(1)
+	case source == NetworkFetch:
+		r.stats.fetched(len(metadata.Source))
+	default:
+		r.stats.cacheHits.Add(1)
 	}
 
-	result, err := client.Pull(ref, registry.PullOptWithPackage(false))
+	return metadata, source, err
+}
 
-	if err != nil {
-		return nil, err
+// lookupMetadata returns the metadata of dependency from the memory cache, the disk
+// cache or the registry, in that order, along with where it was found
+func (r *Resolver) lookupMetadata(dependency Dependency) (*Metadata, ResolutionSource, error) {
+	if metadata, ok := r.cache.Get(dependency.Uri); ok {
+		return metadata, CacheHit, nil
 	}
 
-	hasher := sha256.New()
-	hasher.Write(result.Metadata.Data)
+	floating := isFloatingUri(dependency.Uri)
 
-	var metadata *Metadata
-	if err := json.Unmarshal(result.Metadata.Data, &metadata); err != nil {
-		return nil, err
+	var cached *Metadata
+	var ok bool
+
+	if floating {
+		cached, ok = r.loadFloatingMetadata(dependency)
+	} else {
+		cached, ok = r.loadCachedMetadata(dependency)
 	}
 
-	metadata.ResolverType = OCI
-	metadata.Source = result.Metadata.Data
-	metadata.Checksum = hex.EncodeToString(hasher.Sum(nil))
+	if ok {
+		cached.ResolvedAt = now()
 
-	return metadata, nil
-}
+		if err := r.applyChecksumMode(cached); err != nil {
+			return nil, DiskCache, fmt.Errorf("dependency %s (%s): %w", dependency.Name, dependency.Uri, err)
+		}
 
-func (r *OciResolver) ResolveArchive(metadata *Metadata) ([]byte, error) {
-	ref, err := pklutils.PklUriToRef(metadata.PackageUri)
+		r.cache.Put(dependency.Uri, cached)
+		return cached, DiskCache, nil
+	}
+
+	logger := r.config.Logger
+	dependencyName := dependency.Name
+
+	var resolver DependencyResolver
+
+	if r.tarballResolver != nil {
+		logger.Debug("Resolving: %s as %+v proto: tarball", dependencyName, dependency)
+		resolver = r.tarballResolver
+	} else if isGithubUri(dependency.Uri) {
+		logger.Debug("Resolving: %s as %+v proto: github", dependencyName, dependency)
+		resolver = r.githubResolver
+	} else if isGrpcUri(dependency.Uri) {
+		logger.Debug("Resolving: %s as %+v proto: grpc", dependencyName, dependency)
+		resolver = r.grpcResolver
+	} else if strings.HasSuffix(dependencyName, ".oci") {
+		logger.Debug("Resolving: %s as %+v proto: oci", dependencyName, dependency)
+		resolver = r.ociResolver
+	} else {
+		logger.Debug("Resolving: %s as %+v proto: http", dependencyName, dependency)
+		resolver = r.httpResolver
+	}
+
+	plain := strings.Contains(dependencyName, ".plain")
+
+	metadata, err := r.resolveFromRegistries(resolver, dependency.Uri, plain)
 
 	if err != nil {
-		return nil, err
+		logger.Error("Metadata resolving error: %s - %+v", dependencyName, dependency)
+		return nil, NetworkFetch, fmt.Errorf("dependency %s (%s): %w", dependencyName, dependency.Uri, err)
 	}
 
-	client := r.client
-	if metadata.PlainHttp {
-		client = r.plainClient
+	if err := r.applyChecksumMode(metadata); err != nil {
+		return nil, NetworkFetch, fmt.Errorf("dependency %s (%s): %w", dependencyName, dependency.Uri, err)
 	}
 
-	result, err := client.Pull(ref, registry.PullOptWithPackage(true))
+	metadata.ResolvedAt = now()
 
-	if err != nil {
-		return nil, err
+	nameDependencies(metadata)
+
+	if floating {
+		metadata.Requested = dependency.Uri
+		r.storeFloatingMetadata(dependency.Uri, metadata)
 	}
 
-	return result.Archive.Data, nil
-}
+	r.cache.Put(dependency.Uri, metadata)
 
-func NewHttpResolver(appConfig *AppConfig) *HttpResolver {
-	return &HttpResolver{plainHttp: appConfig.PlainHttp, config: appConfig}
+	return metadata, NetworkFetch, nil
 }
 
-func (r *HttpResolver) ResolveMetadata(uri string, plainHttp bool) (*Metadata, error) {
+// applyChecksumMode replaces the raw checksum of metadata by its canonical checksum
+// when AppConfig.CanonicalChecksum is set
+func (r *Resolver) applyChecksumMode(metadata *Metadata) error {
+	if !r.config.CanonicalChecksum {
+		return nil
+	}
 
-	u, err := url.Parse(uri)
-	logger := r.config.Logger
+	checksum, err := CanonicalChecksum(metadata.Source)
 
 	if err != nil {
-		logger.Error("Parsing error %s", uri)
-		return nil, err
-	}
-
-	if r.plainHttp || plainHttp {
-		u.Scheme = "http"
-	} else {
-		u.Scheme = "https"
+		return err
 	}
 
-	// u.Path = u.Path + ".json"
+	metadata.Checksum = checksum
+	return nil
+}
 
-	resp, err := http.Get(u.String())
+// RawChecksum returns the sha256 of the metadata bytes as served by the registry
+func (m *Metadata) RawChecksum() string {
+	sum := sha256.Sum256(m.Source)
+	return hex.EncodeToString(sum[:])
+}
 
-	if err != nil {
-		logger.Error("Http get error %s", u.String())
-		return nil, err
+// nameDependencies copies the keys of the dependencies map into the dependency names.
+// Leaf packages may omit dependencies entirely, their map is initialized empty.
+func nameDependencies(metadata *Metadata) {
+	if metadata.Dependencies == nil {
+		metadata.Dependencies = make(map[string]Dependency)
+		return
 	}
 
-	if resp.StatusCode > 300 {
-		return nil, fmt.Errorf("Http get Error status: %s", resp.Status)
+	for metadataName, metadataDep := range metadata.Dependencies {
+		metadataDep.Name = metadataName
+		metadata.Dependencies[metadataName] = metadataDep
 	}
+}
 
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
-
-	hasher := sha256.New()
-	hasher.Write(body)
+// visitClosure visits the dependency closure of uri recorded by an earlier Resolve call
+// without walking it again. It reports false when no closure is known for uri or
+// part of it has been evicted from the memory cache, which drops the closure.
+func (r *Resolver) visitClosure(uri string, state *resolveState) (bool, error) {
+	closure, ok := r.closures.get(uri)
 
-	if err != nil {
-		return nil, err
+	if !ok {
+		return false, nil
 	}
 
-	var metadata *Metadata
-	if err := json.Unmarshal(body, &metadata); err != nil {
-		logger.Error("Json unmarshal error: %s", body)
-		return nil, err
+	resolved := make([]*Metadata, len(closure.members))
+
+	for i, member := range closure.members {
+		metadata, ok := r.cache.Get(member)
+
+		if !ok {
+			r.closures.remove(uri)
+			return false, nil
+		}
+
+		resolved[i] = metadata
+	}
+
+	for i, member := range closure.members {
+		if member != uri {
+			state.edges[uri] = append(state.edges[uri], member)
+		}
+
+		if requested, ok := closure.replaced[member]; ok {
+			state.replaced[member] = requested
+		}
+
+		resolvedUri := resolved[i].resolvedUri(member)
+
+		if state.visited[member] || state.visited[resolvedUri] {
+			continue
+		}
+
+		state.visited[member] = true
+		state.visited[resolvedUri] = true
+		r.stats.cacheHits.Add(1)
+
+		if err := state.visit(resolvedUri, state.annotate(member, resolved[i]), CacheHit); err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+// recordClosures remembers the transitive closure of every top level dependency of a
+// completed walk so that repeated Resolve calls can skip subtrees already resolved
+func (r *Resolver) recordClosures(state *resolveState) {
+	for _, root := range state.edges[""] {
+		if _, ok := r.closures.get(root); ok {
+			continue
+		}
+
+		seen := map[string]bool{root: true}
+		closure := []string{root}
+		replaced := make(map[string]string)
+
+		for i := 0; i < len(closure); i++ {
+			if requested, ok := state.replaced[closure[i]]; ok {
+				replaced[closure[i]] = requested
+			}
+
+			for _, child := range state.edges[closure[i]] {
+				if !seen[child] {
+					seen[child] = true
+					closure = append(closure, child)
+				}
+			}
+		}
+
+		r.closures.add(root, closure, replaced)
+	}
+}
+
+// packageDir returns the cache directory of the package described by m
+func (r *Resolver) packageDir(m *Metadata) (string, error) {
+	baseUri, err := url.Parse(m.PackageUri)
+
+	if err != nil {
+		return "", err
+	}
+
+	return cacheDir(r.config.CacheNaming, r.basePath, baseUri), nil
+}
+
+// archivePath returns the cache path of the archive of the package described by m
+func (r *Resolver) archivePath(m *Metadata) (string, error) {
+	dir, err := r.packageDir(m)
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, filepath.Base(dir)+".zip"), nil
+}
+
+func (r *Resolver) Exists(metadata *Metadata) (bool, error) {
+	basePath, err := r.packageDir(metadata)
+
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := os.Stat(basePath); errors.Is(err, os.ErrNotExist) {
+		u, err := url.Parse(metadata.PackageUri)
+
+		if err != nil {
+			return false, nil
+		}
+
+		_, ok := r.tierDir(u)
+		return ok, nil
+	} else {
+		return true, nil
+	}
+
+}
+
+// Download fetches the archives of dependencies missing from the cache in parallel,
+// bounded by AppConfig.DownloadConcurrency overall and DownloadConcurrencyPerHost per registry host.
+// It returns the cache path of the archive of every package, downloaded or already cached.
+// Once a download or its verification failed, the downloads in flight are cancelled and
+// no other is started, unless AppConfig.ContinueOnError is set, in which case every
+// package is attempted and the paths of the successful ones are returned along with the
+// errors of the others.
+func (r *Resolver) Download(dependencies map[string]*Metadata) (map[string]string, error) {
+	if r.config.MetadataOnly {
+		return nil, ErrMetadataOnly
+	}
+
+	if err := r.checkPackageQuota(len(dependencies)); err != nil {
+		return nil, err
+	}
+
+	pool := r.newDownloadPool()
+
+	for u, m := range dependencies {
+		pool.schedule(u, m)
+	}
+
+	return pool.wait()
+}
+
+// downloadPool runs the downloads of Download within the concurrency limits of AppConfig
+type downloadPool struct {
+	r      *Resolver
+	ctx    context.Context
+	cancel context.CancelFunc
+	quota  *downloadQuota
+	global chan struct{}
+	hosts  map[string]chan struct{}
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	errs   []error
+	failed bool
+	paths  map[string]string
+	// jobs cancel the download of each scheduled package uri
+	jobs map[string]context.CancelFunc
+	// withdrawn holds the package uris whose download is no longer wanted
+	withdrawn map[string]bool
+	// stored holds the package uris stored in the cache by this pool
+	stored map[string]bool
+}
+
+func (r *Resolver) newDownloadPool() *downloadPool {
+	parent := r.config.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+
+	concurrency := r.config.DownloadConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultDownloadConcurrency
+	}
+
+	return &downloadPool{
+		r:         r,
+		ctx:       ctx,
+		cancel:    cancel,
+		quota:     &downloadQuota{limit: r.config.MaxDownloadBytes},
+		global:    make(chan struct{}, concurrency),
+		hosts:     make(map[string]chan struct{}),
+		paths:     make(map[string]string),
+		jobs:      make(map[string]context.CancelFunc),
+		withdrawn: make(map[string]bool),
+		stored:    make(map[string]bool),
+	}
+}
+
+// schedule starts the download of the archive of m unless it is already scheduled, it is
+// not safe to call concurrently
+func (p *downloadPool) schedule(u string, m *Metadata) {
+	r := p.r
+
+	p.mu.Lock()
+	_, scheduled := p.jobs[u]
+	scheduled = scheduled && !p.withdrawn[u]
+	p.mu.Unlock()
+
+	if scheduled {
+		return
+	}
+
+	var host chan struct{}
+
+	if perHost := r.config.DownloadConcurrencyPerHost; perHost > 0 {
+		parsed, err := url.Parse(u)
+
+		if err != nil {
+			p.mu.Lock()
+			p.errs = append(p.errs, err)
+			p.failed = true
+			p.mu.Unlock()
+			return
+		}
+
+		if host = p.hosts[parsed.Host]; host == nil {
+			host = make(chan struct{}, perHost)
+			p.hosts[parsed.Host] = host
+		}
+	}
+
+	ctx, cancel := context.WithCancel(p.ctx)
+
+	p.mu.Lock()
+	p.jobs[u] = cancel
+	delete(p.withdrawn, u)
+	p.mu.Unlock()
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer cancel()
+
+		if host != nil {
+			host <- struct{}{}
+			defer func() { <-host }()
+		}
+
+		p.global <- struct{}{}
+		defer func() { <-p.global }()
+
+		p.mu.Lock()
+		abort := (p.failed && !r.config.ContinueOnError) || p.withdrawn[u]
+		p.mu.Unlock()
+
+		if abort {
+			return
+		}
+
+		cached, _ := r.Exists(m)
+		path, err := r.download(ctx, u, m, p.quota)
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		if p.withdrawn[u] {
+			if err == nil && !cached {
+				p.evict(u, m)
+			}
+			return
+		}
+
+		if err != nil && p.failed && !r.config.ContinueOnError && errors.Is(err, context.Canceled) {
+			// cancelled after another download failed, that failure is reported instead
+			return
+		}
+
+		if err != nil {
+			r.stats.errors.Add(1)
+			p.errs = append(p.errs, err)
+			p.failed = true
+
+			if !r.config.ContinueOnError {
+				p.cancel()
+			}
+		} else {
+			p.paths[u] = path
+			p.stored[u] = !cached
+		}
+	}()
+}
+
+// withdraw cancels the download of u scheduled with m, removing its archive from the
+// cache when the pool stored it
+func (p *downloadPool) withdraw(u string, m *Metadata) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.withdrawn[u] = true
+
+	if cancel, ok := p.jobs[u]; ok {
+		cancel()
+	}
+
+	if _, ok := p.paths[u]; ok {
+		if p.stored[u] {
+			p.evict(u, m)
+		}
+
+		delete(p.paths, u)
+	}
+}
+
+// evict removes the package directory of m, the archive blob is kept as other packages
+// may link to it
+func (p *downloadPool) evict(u string, m *Metadata) {
+	dir, err := p.r.packageDir(m)
+
+	if err == nil {
+		err = os.RemoveAll(dir)
+	}
+
+	if err != nil {
+		p.r.config.Logger.Error("Removing the withdrawn download of %s failed: %s", u, err)
+	}
+}
+
+// wait waits for every scheduled download, and returns the paths of the archives like Download
+func (p *downloadPool) wait() (map[string]string, error) {
+	p.wg.Wait()
+	p.cancel()
+
+	if err := errors.Join(p.errs...); err != nil {
+		if p.r.config.ContinueOnError {
+			return p.paths, err
+		}
+
+		return nil, err
+	}
+
+	return p.paths, nil
+}
+
+func (r *Resolver) download(ctx context.Context, u string, m *Metadata, quota *downloadQuota) (string, error) {
+	logger := r.config.Logger
+
+	archivePath, err := r.archivePath(m)
+
+	if err != nil {
+		return "", err
+	}
+
+	// another process downloading the same package is waited for, then found cached
+	unlock, err := r.lockPackage(ctx, m)
+
+	if err != nil {
+		return "", fmt.Errorf("dependency %s (%s): locking the cache: %w", m.Name, u, err)
+	}
+
+	defer unlock()
+
+	e, err := r.Exists(m)
+
+	if err != nil {
+		return "", err
+	}
+
+	// a package held by a secondary cache tier is promoted under the package lock
+	if parsed, err := url.Parse(m.PackageUri); e && err == nil && r.promote(parsed) {
+		r.stats.cacheHits.Add(1)
+		return archivePath, nil
+	}
+
+	if err := r.checkPlainArchive(m); err != nil {
+		return "", fmt.Errorf("dependency %s (%s): %w", m.Name, u, err)
+	}
+
+	start := r.timings.start()
+	bytes, reused := r.storedBlob(m)
+
+	if reused {
+		logger.Info("Reusing the stored archive %s for %s", m.PackageZipChecksums.Sha256, u)
+		r.stats.cacheHits.Add(1)
+	} else {
+		if bytes, err = r.fetchArchive(withDownloadQuota(ctx, quota), u, m); err != nil {
+			return "", err
+		}
+
+		if err := quota.add(len(bytes)); err != nil {
+			return "", fmt.Errorf("dependency %s (%s): %w", m.Name, u, err)
+		}
+
+		r.stats.fetched(len(bytes))
+		start = r.timings.record(u, start, archiveTiming)
+	}
+
+	if m.PackageZipChecksums.Sha256 != "" {
+		if err := VerifySha256(bytes, m.PackageZipChecksums.Sha256); err != nil {
+			return "", fmt.Errorf("dependency %s (%s): %w", m.Name, u, err)
+		}
+	}
+
+	if m.PackageZipChecksums.Sha512 != "" {
+		if err := VerifySha512(bytes, m.PackageZipChecksums.Sha512); err != nil {
+			return "", fmt.Errorf("dependency %s (%s): %w", m.Name, u, err)
+		}
+	}
+
+	if err := VerifyDigests(bytes, m.PackageZipChecksums.Digests); err != nil {
+		return "", fmt.Errorf("dependency %s (%s): %w", m.Name, u, err)
+	}
+
+	if m.DeclaredChecksums != nil && m.DeclaredChecksums.Sha256 != "" {
+		if err := VerifySha256(bytes, m.DeclaredChecksums.Sha256); err != nil {
+			return "", fmt.Errorf("dependency %s (%s) does not match the checksum declared by the project: %w", m.Name, u, err)
+		}
+	}
+
+	if err := r.verifySignature(m, bytes); err != nil {
+		return "", err
+	}
+
+	r.timings.record(u, start, verificationTiming)
+
+	return archivePath, r.store(u, m, bytes)
+}
+
+// fetchArchive downloads the archive of m with the resolver of its protocol
+func (r *Resolver) fetchArchive(ctx context.Context, u string, m *Metadata) ([]byte, error) {
+	logger := r.config.Logger
+
+	var resolver DependencyResolver
+
+	if r.tarballResolver != nil {
+		logger.Info("Extracting %s from the registry tarball", u)
+		resolver = r.tarballResolver
+	} else if m.ResolverType == OCI {
+		logger.Info("Downloading %s proto: oci", u)
+		resolver = r.ociResolver
+	} else if m.ResolverType == GITHUB {
+		logger.Info("Downloading %s proto: github", u)
+		resolver = r.githubResolver
+	} else if m.ResolverType == GRPC {
+		logger.Info("Downloading %s proto: grpc", u)
+		resolver = r.grpcResolver
+	} else {
+		logger.Info("Downloading %s proto: http", u)
+		resolver = r.httpResolver
+	}
+
+	var (
+		bytes []byte
+		err   error
+	)
+
+	if cancellable, ok := resolver.(archiveContextResolver); ok {
+		bytes, err = cancellable.ResolveArchiveContext(ctx, m)
+	} else {
+		bytes, err = resolver.ResolveArchive(m)
+	}
+
+	if err == nil {
+		err = ctx.Err()
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("dependency %s (%s): %w", m.Name, u, err)
+	}
+
+	return bytes, nil
+}
+
+// store writes the package metadata and archive into the cache, removing
+// whatever was written when any step fails
+func (r *Resolver) store(u string, m *Metadata, archive []byte) error {
+	basePath, err := r.packageDir(m)
+
+	if err != nil {
+		return err
 	}
 
+	metaPath := filepath.Join(basePath, filepath.Base(basePath)+".json")
+	archivePath := filepath.Join(basePath, filepath.Base(basePath)+".zip")
+
+	err = os.MkdirAll(basePath, os.ModePerm)
+
+	if err == nil {
+		err = writeFile(metaPath, m.Source, os.ModePerm)
+	}
+
+	if err == nil {
+		err = storeCachedResolver(basePath, m)
+	}
+
+	if err == nil {
+		err = r.storeArchive(archivePath, archive)
+	}
+
+	if err != nil {
+		r.config.Logger.Error("Error on storing %s, cleaning up %s", u, basePath)
+
+		if cleanupErr := os.RemoveAll(basePath); cleanupErr != nil {
+			return errors.Join(err, fmt.Errorf("cleanup of %s failed: %w", basePath, cleanupErr))
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// Ping checks every registry host is reachable and accepts the configured
+// credentials, reporting all hosts that are not
+func (r *Resolver) Ping(hosts []string) error {
+	var errs []error
+
+	for _, host := range hosts {
+		if err := r.ociResolver.client.Ping(host); err != nil {
+			r.config.Logger.Error("Registry %s is unavailable: %s", host, err)
+			errs = append(errs, fmt.Errorf("registry %s: %w", host, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// transformMetadata applies AppConfig.MetadataTransform to metadata decoded from source,
+// and returns the source the checksum of metadata is computed from, as the transform
+// may rewrite it
+func transformMetadata(appConfig *AppConfig, metadata *Metadata, source []byte) ([]byte, error) {
+	if appConfig.MetadataTransform == nil {
+		return source, nil
+	}
+
+	metadata.Source = source
+
+	if err := appConfig.MetadataTransform(metadata); err != nil {
+		return nil, fmt.Errorf("transforming metadata of %s: %w", metadata.PackageUri, err)
+	}
+
+	return metadata.Source, nil
+}
+
+// decodeMetadata parses package metadata, rejecting unknown fields when strict is set
+func decodeMetadata(data []byte, strict bool) (*Metadata, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+
+	var metadata Metadata
+	if err := decoder.Decode(&metadata); err != nil {
+		return nil, err
+	}
+
+	return &metadata, nil
+}
+
+func NewOciResolver(appConfig *AppConfig, httpClient *http.Client) (*OciResolver, error) {
+	var client, err = registry.NewClient(
+		registry.WithPlainHttp(appConfig.PlainHttp),
+		registry.ClientOptHTTPClient(httpClient),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	plainClient, err := registry.NewClient(
+		registry.WithPlainHttp(true),
+		registry.ClientOptHTTPClient(httpClient),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resolver := &OciResolver{client: client, plainClient: plainClient, config: appConfig, noReferrers: new(sync.Map)}
+
+	if appConfig.OciLayout != "" {
+		if resolver.layout, err = registry.OpenLayout(appConfig.OciLayout); err != nil {
+			return nil, err
+		}
+	}
+
+	return resolver, nil
+}
+
+// pull fetches ref from the oci layout when configured, from its registry otherwise,
+// bounded by the metadata or archive timeout and aborted when ctx is cancelled
+func (r *OciResolver) pull(ctx context.Context, ref string, plainHttp bool, withPackage bool) (*registry.PullResult, error) {
+	if r.layout != nil {
+		return r.layout.Pull(ref, registry.PullOptWithPackage(withPackage), registry.PullOptContext(ctx))
+	}
+
+	client := r.client
+	if plainHttp {
+		client = r.plainClient
+	}
+
+	timeout := r.config.MetadataTimeout
+	if withPackage {
+		timeout = r.config.ArchiveTimeout
+	}
+
+	return client.Pull(ref, registry.PullOptWithPackage(withPackage), registry.PullOptTimeout(timeout), registry.PullOptContext(ctx))
+}
+
+func (r *OciResolver) ResolveMetadata(uri string, plainHttp bool) (*Metadata, error) {
+	ref, err := pklutils.PklUriToRef(uri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	client := r.client
+	if plainHttp {
+		client = r.plainClient
+	}
+
+	var data []byte
+	var manifestDigest string
+
+	host := ""
+	if u, err := url.Parse(uri); err == nil {
+		host = u.Host
+	}
+
+	_, noReferrers := r.noReferrers.Load(host)
+	useReferrers := r.config.OciReferrers && r.layout == nil && !noReferrers
+
+	if useReferrers {
+		summary, err := client.PullReferrerMetadata(ref)
+
+		if errors.Is(err, registry.ErrNotFound) {
+			return nil, fmt.Errorf("%w: %w", ErrPackageNotFound, err)
+		}
+
+		if errors.Is(err, registry.ErrReferrersUnsupported) {
+			r.config.Logger.Info("Registry %s does not support the referrers API, reading metadata from manifest layers", host)
+			r.noReferrers.Store(host, true)
+			useReferrers = false
+		} else if err != nil {
+			return nil, err
+		} else {
+			data = summary.Data
+		}
+	}
+
+	if !useReferrers {
+		ctx := r.config.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		result, err := r.pull(ctx, ref, plainHttp, false)
+
+		if errors.Is(err, registry.ErrNotFound) {
+			return nil, fmt.Errorf("%w: %w", ErrPackageNotFound, err)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		data = result.Metadata.Data
+		manifestDigest = result.Manifest.Digest
+	}
+
+	metadata, err := decodeMetadata(data, r.config.StrictMetadata)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if data, err = transformMetadata(r.config, metadata, data); err != nil {
+		return nil, err
+	}
+
+	hasher := sha256.New()
+	hasher.Write(data)
+
+	metadata.ResolverType = OCI
+	metadata.Source = data
+	metadata.ManifestDigest = manifestDigest
+	metadata.Checksum = hex.EncodeToString(hasher.Sum(nil))
+
+	return metadata, nil
+}
+
+func (r *OciResolver) ResolveArchive(metadata *Metadata) ([]byte, error) {
+	return r.ResolveArchiveContext(context.Background(), metadata)
+}
+
+// ResolveArchiveContext is ResolveArchive aborting the pull when ctx is cancelled
+func (r *OciResolver) ResolveArchiveContext(ctx context.Context, metadata *Metadata) ([]byte, error) {
+	ref, err := pklutils.PklUriToRef(metadata.registryUri())
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := r.pull(ctx, ref, metadata.PlainHttp, true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	metadata.ManifestDigest = result.Manifest.Digest
+
+	return result.Archive.Data, nil
+}
+
+func NewHttpResolver(appConfig *AppConfig, httpClient *http.Client) *HttpResolver {
+	if len(appConfig.Credentials) > 0 {
+		httpClient = newCredentialClient(appConfig, httpClient)
+	}
+
+	httpClient = withRedirectPolicy(appConfig, httpClient)
+
+	if appConfig.HttpTokenUrl != "" {
+		httpClient = newTokenClient(appConfig, httpClient)
+	}
+
+	resolver := &HttpResolver{plainHttp: appConfig.PlainHttp, config: appConfig, client: httpClient}
+	resolver.index = sync.OnceValue(resolver.loadIndex)
+
+	return resolver
+}
+
+func (r *HttpResolver) ResolveMetadata(uri string, plainHttp bool) (*Metadata, error) {
+
+	u, err := url.Parse(uri)
+	logger := r.config.Logger
+
+	if err != nil {
+		logger.Error("Parsing error %s", uri)
+		return nil, err
+	}
+
+	if metadata, ok, err := r.lookupIndex(uri, plainHttp); ok {
+		return metadata, err
+	}
+
+	if r.plainHttp || plainHttp {
+		u.Scheme = "http"
+	} else {
+		u.Scheme = "https"
+	}
+
+	// u.Path = u.Path + ".json"
+
+	ctx := r.config.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	header := r.metadataHeader()
+	resp, err := r.get(ctx, u.String(), r.config.MetadataTimeout, header)
+
+	fellBack := false
+
+	if err != nil && u.Scheme == "https" && r.plainFallbackAllowed(u) {
+		logger.Error("Https get error %s, falling back to plain http: %s", u.String(), err)
+		u.Scheme = "http"
+		plainHttp = true
+		fellBack = true
+		resp, err = r.get(ctx, u.String(), r.config.MetadataTimeout, header)
+	}
+
+	if err != nil {
+		logger.Error("Http get error %s", u.String())
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrPackageNotFound, u.String())
+	}
+
+	if resp.StatusCode > 300 {
+		return nil, fmt.Errorf("Http get Error status: %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// metadata published as a pkl module is cached as the json it evaluates to
+	if isPklMetadata(resp.Header.Get("Content-Type"), u.Path) {
+		if body, err = evaluatePkl(ctx, string(body)); err != nil {
+			return nil, fmt.Errorf("evaluating pkl metadata %s: %w", u.String(), err)
+		}
+	}
+
+	metadata, err := decodeMetadata(body, r.config.StrictMetadata)
+
+	if err != nil {
+		logger.Error("Json unmarshal error: %s", body)
+		return nil, err
+	}
+
+	if body, err = transformMetadata(r.config, metadata, body); err != nil {
+		return nil, err
+	}
+
+	hasher := sha256.New()
+	hasher.Write(body)
+
+	// Archive URLs may be relative to the metadata location, after any redirect
+	zipUrl, err := url.Parse(metadata.PackageZipUrl)
+
+	if err != nil {
+		logger.Error("Parsing error %s", metadata.PackageZipUrl)
+		return nil, err
+	}
+
+	if host := resp.Request.URL.Host; host != u.Host {
+		metadata.RedirectedHost = host
+	}
+
+	zipUrl = resp.Request.URL.ResolveReference(zipUrl)
+
+	if err := r.checkArchiveHost(u, zipUrl); err != nil {
+		return nil, err
+	}
+
+	metadata.PackageZipUrl = zipUrl.String()
 	metadata.ResolverType = HTTP
 	metadata.Source = body
 	metadata.PlainHttp = plainHttp
 	metadata.Checksum = hex.EncodeToString(hasher.Sum(nil))
 
+	if fellBack {
+		metadata.advise(AdvisoryPlainHttpFallback, "fetched over plain http after https failed")
+	}
+
 	return metadata, nil
 }
 
+func (r *HttpResolver) plainFallbackAllowed(u *url.URL) bool {
+	if r.config.DisallowPlainHttp {
+		return false
+	}
+
+	for _, host := range r.config.PlainHttpFallbackHosts {
+		if host == u.Host || host == u.Hostname() {
+			return true
+		}
+	}
+	return false
+}
+
+// checkArchiveHost rejects archives hosted elsewhere than their metadata when
+// AppConfig.SameHostArchives is set, unless their host is in AppConfig.ArchiveHosts
+func (r *HttpResolver) checkArchiveHost(metadataUrl *url.URL, zipUrl *url.URL) error {
+	if !r.config.SameHostArchives || strings.EqualFold(zipUrl.Host, metadataUrl.Host) {
+		return nil
+	}
+
+	for _, host := range r.config.ArchiveHosts {
+		if strings.EqualFold(host, zipUrl.Host) || strings.EqualFold(host, zipUrl.Hostname()) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: metadata %s points to archive %s", ErrArchiveHostMismatch, metadataUrl, zipUrl)
+}
+
+// get requests resourceUrl until ctx is cancelled, the whole request including the
+// read of the body is bounded by timeout unless it is 0
+func (r *HttpResolver) get(ctx context.Context, resourceUrl string, timeout time.Duration, header http.Header) (*http.Response, error) {
+	if timeout <= 0 {
+		req, err := newGetRequest(ctx, resourceUrl, header)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return r.client.Do(req)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	req, err := newGetRequest(ctx, resourceUrl, header)
+
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp, err := r.client.Do(req)
+
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// newGetRequest builds a GET request of resourceUrl carrying header
+func newGetRequest(ctx context.Context, resourceUrl string, header http.Header) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, resourceUrl, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	return req, nil
+}
+
+// metadataHeader returns the headers of metadata requests, like the Accept-Language
+// configured by AppConfig.AcceptLanguage
+func (r *HttpResolver) metadataHeader() http.Header {
+	header := make(http.Header)
+
+	if r.config.AcceptLanguage != "" {
+		header.Set("Accept-Language", r.config.AcceptLanguage)
+	}
+
+	return header
+}
+
 func (r *HttpResolver) ResolveArchive(metadata *Metadata) ([]byte, error) {
-	var err error
-	resp, err := http.Get(metadata.PackageZipUrl)
+	return r.ResolveArchiveContext(context.Background(), metadata)
+}
+
+// ResolveArchiveContext is ResolveArchive aborting the download when ctx is cancelled
+func (r *HttpResolver) ResolveArchiveContext(ctx context.Context, metadata *Metadata) ([]byte, error) {
+	resp, err := r.get(ctx, archiveUrl(r.config, metadata.PackageZipUrl), r.config.ArchiveTimeout, nil)
 
 	if err != nil {
 		return nil, err
 	}
 
 	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+	body, err := io.ReadAll(downloadQuotaFrom(ctx).limitReader(resp.Body))
 
 	if err != nil {
 		return nil, err
@@ -3,8 +3,23 @@ package app
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/google/go-cmp/cmp"
 	"hpkl.io/hpkl/pkg/logger"
 )
@@ -18,6 +33,7 @@ func TestDeduplicate(t *testing.T) {
 		project:   nil,
 		ctx:       context.Background(),
 		PlainHttp: true,
+		CacheDir:  t.TempDir(),
 	})
 
 	if err != nil {
@@ -30,7 +46,7 @@ func TestDeduplicate(t *testing.T) {
 		"package://host/other@1.2.3": {Name: "other", Version: "1.2.3", PackageUri: "package://host/other@1.2.3"},
 	}
 
-	actual, err := r.Deduplicate(original)
+	actual, err := r.Deduplicate(original, DedupHighestVersion)
 
 	if err != nil {
 		t.Fatal(err)
@@ -45,3 +61,2230 @@ func TestDeduplicate(t *testing.T) {
 		t.Errorf(diff)
 	}
 }
+
+func TestDeduplicateNone(t *testing.T) {
+	r := newTestResolver(t)
+
+	original := map[string]*Metadata{
+		"package://host/path@1.2.3":  {Name: "path", Version: "1.2.3", PackageUri: "package://host/path@1.2.3"},
+		"package://host/path@1.2.4":  {Name: "path", Version: "1.2.4", PackageUri: "package://host/path@1.2.4"},
+		"package://host/other@1.2.3": {Name: "other", Version: "1.2.3", PackageUri: "package://host/other@1.2.3"},
+	}
+
+	actual, err := r.Deduplicate(original, DedupNone)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(original, actual); diff != "" {
+		t.Errorf(diff)
+	}
+}
+
+func TestResolveBuildMetadata(t *testing.T) {
+	reg := newTestRegistry(t)
+	first := reg.add(t, "lib", "1.2.3+build.1", []byte("first"))
+	second := reg.add(t, "lib", "1.2.3+build.2", []byte("second"))
+
+	r := newTestResolver(t)
+
+	resolved, err := r.Resolve(dependencySet(first, second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resolved) != 2 {
+		t.Fatalf("expected both builds to resolve, got %v", resolved)
+	}
+
+	for range 5 {
+		deduplicated, err := r.Deduplicate(resolved, DedupHighestVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(deduplicated) != 1 || deduplicated[second.Uri] == nil {
+			t.Fatalf("expected the builds to deduplicate to %s, got %v", second.Uri, deduplicated)
+		}
+	}
+
+	paths, err := r.Download(resolved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for uri, path := range paths {
+		if name := filepath.Base(path); strings.ContainsAny(name, `<>:"/\|?* `) || !strings.Contains(name, "+build.") {
+			t.Errorf("expected a filesystem safe archive name for %s, got %s", uri, name)
+		}
+	}
+
+	if paths[first.Uri] == paths[second.Uri] {
+		t.Errorf("expected the builds to be cached apart, got %s", paths[first.Uri])
+	}
+}
+
+type testRegistry struct {
+	server   *httptest.Server
+	host     string
+	mu       sync.Mutex
+	metadata map[string][]byte
+	archives map[string][]byte
+	requests map[string]int
+	// archiveDelay holds archive responses to let concurrent downloads overlap
+	archiveDelay time.Duration
+	inFlight     int
+	maxInFlight  int
+	// authorize rejects requests with 401 when it returns false
+	authorize func(req *http.Request) bool
+	// metadataDelay holds metadata responses
+	metadataDelay time.Duration
+	// intercept sees every request first, the registry does not answer it when it returns false
+	intercept func(w http.ResponseWriter, req *http.Request) bool
+}
+
+func newTestRegistry(t testing.TB) *testRegistry {
+	reg := &testRegistry{
+		metadata: make(map[string][]byte),
+		archives: make(map[string][]byte),
+		requests: make(map[string]int),
+	}
+
+	reg.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		reg.mu.Lock()
+		reg.requests[req.URL.Path]++
+		metadata, isMetadata := reg.metadata[req.URL.Path]
+		archive, isArchive := reg.archives[req.URL.Path]
+		delay := reg.archiveDelay
+		metadataDelay := reg.metadataDelay
+		authorize := reg.authorize
+		intercept := reg.intercept
+		reg.mu.Unlock()
+
+		if intercept != nil && !intercept(w, req) {
+			return
+		} else if authorize != nil && !authorize(req) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		} else if isMetadata {
+			time.Sleep(metadataDelay)
+			w.Write(metadata)
+		} else if isArchive {
+			reg.mu.Lock()
+			reg.inFlight++
+			reg.maxInFlight = max(reg.maxInFlight, reg.inFlight)
+			reg.mu.Unlock()
+
+			time.Sleep(delay)
+
+			reg.mu.Lock()
+			reg.inFlight--
+			reg.mu.Unlock()
+
+			w.Write(archive)
+		} else {
+			http.NotFound(w, req)
+		}
+	}))
+	t.Cleanup(reg.server.Close)
+
+	u, err := url.Parse(reg.server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.host = u.Host
+
+	return reg
+}
+
+// add publishes a package and returns the dependency pointing at it
+func (reg *testRegistry) add(t testing.TB, name string, version string, archive []byte, deps ...Dependency) Dependency {
+	path := fmt.Sprintf("/%s@%s", name, version)
+	uri := fmt.Sprintf("package://%s%s", reg.host, path)
+	sum := sha256.Sum256(archive)
+
+	metadata := Metadata{
+		Name:                name,
+		PackageUri:          uri,
+		Version:             version,
+		PackageZipUrl:       reg.server.URL + path + ".zip",
+		PackageZipChecksums: Checksums{Sha256: hex.EncodeToString(sum[:])},
+		Dependencies:        make(map[string]Dependency),
+	}
+
+	for _, dep := range deps {
+		metadata.Dependencies[dep.Name] = Dependency{Uri: dep.Uri}
+	}
+
+	reg.publish(t, path, metadata, archive)
+
+	return Dependency{Uri: uri, Name: name}
+}
+
+// publish serves metadata at path and the archive next to it
+func (reg *testRegistry) publish(t testing.TB, path string, metadata Metadata, archive []byte) {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.metadata[path] = data
+	reg.archives[path+".zip"] = archive
+}
+
+// serve makes the registry answer path with data
+func (reg *testRegistry) serve(path string, data []byte) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.archives[path] = data
+}
+
+func (reg *testRegistry) requestCount(path string) int {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	return reg.requests[path]
+}
+
+func newTestResolver(t testing.TB, configure ...func(config *AppConfig)) *Resolver {
+	config := &AppConfig{
+		Logger:    logger.New(new(bytes.Buffer), new(bytes.Buffer)),
+		ctx:       context.Background(),
+		PlainHttp: true,
+		CacheDir:  t.TempDir(),
+	}
+
+	for _, c := range configure {
+		c(config)
+	}
+
+	r, err := NewResolver(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+func dependencySet(deps ...Dependency) map[string]Dependency {
+	result := make(map[string]Dependency, len(deps))
+	for _, dep := range deps {
+		result[dep.Uri] = dep
+	}
+	return result
+}
+
+func TestResolveBoundedMemoryCache(t *testing.T) {
+	reg := newTestRegistry(t)
+
+	var deps []Dependency
+	for i := 0; i < 10; i++ {
+		deps = append(deps, reg.add(t, fmt.Sprintf("pkg%d", i), "1.0.0", []byte("zip")))
+	}
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.CacheMaxEntries = 3
+	})
+
+	resolved, err := r.Resolve(dependencySet(deps...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resolved) != 10 {
+		t.Errorf("expected 10 resolved packages, got %d", len(resolved))
+	}
+
+	if r.cache.Len() != 3 {
+		t.Errorf("expected memory cache to hold 3 entries, got %d", r.cache.Len())
+	}
+
+	if r.closures.Len() != 3 {
+		t.Errorf("expected the dependency closures to be bounded like the memory cache, got %d", r.closures.Len())
+	}
+}
+
+func TestResolveWithoutMemoryCache(t *testing.T) {
+	reg := newTestRegistry(t)
+	a := reg.add(t, "a", "1.0.0", []byte("zip"))
+	b := reg.add(t, "b", "1.0.0", []byte("zip"), a)
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.DisableMemoryCache = true
+	})
+
+	for i := 0; i < 2; i++ {
+		resolved, err := r.Resolve(dependencySet(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(resolved) != 2 {
+			t.Errorf("expected 2 resolved packages, got %d", len(resolved))
+		}
+	}
+
+	if r.cache.Len() != 0 {
+		t.Errorf("expected empty memory cache, got %d entries", r.cache.Len())
+	}
+
+	if r.closures.Len() != 0 {
+		t.Errorf("expected no dependency closures, got %d", r.closures.Len())
+	}
+
+	if count := reg.requestCount("/a@1.0.0"); count != 2 {
+		t.Errorf("expected metadata to be fetched on every resolve, got %d requests", count)
+	}
+}
+
+func TestResolveRepeatedOverlappingInputs(t *testing.T) {
+	reg := newTestRegistry(t)
+	leaf := reg.add(t, "leaf", "1.0.0", []byte("zip"))
+	mid := reg.add(t, "mid", "1.0.0", []byte("zip"), leaf)
+	root := reg.add(t, "root", "1.0.0", []byte("zip"), mid)
+	other := reg.add(t, "other", "1.0.0", []byte("zip"), leaf)
+
+	r := newTestResolver(t)
+
+	first, err := r.Resolve(dependencySet(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := r.Resolve(dependencySet(root, other))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	third, err := r.Resolve(dependencySet(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fourth, err := r.Resolve(dependencySet(root, other))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(second, fourth); diff != "" {
+		t.Errorf("repeated resolve of several roots returned a different graph (-second +fourth):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(first, third); diff != "" {
+		t.Errorf("repeated resolve returned a different graph (-first +third):\n%s", diff)
+	}
+
+	if len(second) != 4 {
+		t.Errorf("expected 4 resolved packages, got %d", len(second))
+	}
+
+	for _, path := range []string{"/root@1.0.0", "/mid@1.0.0", "/leaf@1.0.0", "/other@1.0.0"} {
+		if count := reg.requestCount(path); count != 1 {
+			t.Errorf("expected %s to be fetched once, got %d requests", path, count)
+		}
+	}
+}
+
+func TestResolveWithSources(t *testing.T) {
+	reg := newTestRegistry(t)
+	onDisk := reg.add(t, "disk", "1.0.0", []byte("zip"))
+	inMemory := reg.add(t, "memory", "1.0.0", []byte("zip"))
+	remote := reg.add(t, "remote", "1.0.0", []byte("zip"))
+
+	cacheDir := t.TempDir()
+	sharedCache := func(config *AppConfig) {
+		config.CacheDir = cacheDir
+	}
+
+	downloader := newTestResolver(t, sharedCache)
+
+	downloaded, err := downloader.Resolve(dependencySet(onDisk))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := downloader.Download(downloaded); err != nil {
+		t.Fatal(err)
+	}
+
+	r := newTestResolver(t, sharedCache)
+
+	if _, err := r.Resolve(dependencySet(inMemory)); err != nil {
+		t.Fatal(err)
+	}
+
+	resolved, sources, err := r.ResolveWithSources(dependencySet(onDisk, inMemory, remote))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]ResolutionSource{
+		onDisk.Uri:   DiskCache,
+		inMemory.Uri: CacheHit,
+		remote.Uri:   NetworkFetch,
+	}
+
+	if diff := cmp.Diff(expected, sources); diff != "" {
+		t.Errorf("unexpected resolution sources (-expected +actual):\n%s", diff)
+	}
+
+	if metadata := resolved[onDisk.Uri]; metadata == nil || metadata.Checksum != downloaded[onDisk.Uri].Checksum {
+		t.Errorf("expected metadata read from disk to match the downloaded one, got %+v", metadata)
+	}
+
+	if count := reg.requestCount("/disk@1.0.0"); count != 1 {
+		t.Errorf("expected cached metadata not to be fetched again, got %d requests", count)
+	}
+}
+
+func TestResolveArchiveUrl(t *testing.T) {
+	reg := newTestRegistry(t)
+
+	tests := []struct {
+		name          string
+		packageZipUrl string
+		expected      string
+	}{
+		{"rel", "./rel@1.0.0.zip", reg.server.URL + "/pkgs/rel@1.0.0.zip"},
+		{"abs", reg.server.URL + "/pkgs/abs@1.0.0.zip", reg.server.URL + "/pkgs/abs@1.0.0.zip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := fmt.Sprintf("/pkgs/%s@1.0.0", tt.name)
+			reg.publish(t, path, Metadata{Name: tt.name, Version: "1.0.0", PackageZipUrl: tt.packageZipUrl}, []byte(tt.name))
+
+			r := newTestResolver(t)
+
+			metadata, err := r.httpResolver.ResolveMetadata(fmt.Sprintf("package://%s%s", reg.host, path), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if metadata.PackageZipUrl != tt.expected {
+				t.Errorf("expected archive url %s, got %s", tt.expected, metadata.PackageZipUrl)
+			}
+
+			archive, err := r.httpResolver.ResolveArchive(metadata)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(archive) != tt.name {
+				t.Errorf("expected archive %q, got %q", tt.name, archive)
+			}
+		})
+	}
+}
+
+func TestResolverBasePath(t *testing.T) {
+	reg := newTestRegistry(t)
+	dep := reg.add(t, "shared", "1.0.0", []byte("zip"))
+
+	config := &AppConfig{
+		Logger:    logger.New(new(bytes.Buffer), new(bytes.Buffer)),
+		ctx:       context.Background(),
+		PlainHttp: true,
+		CacheDir:  t.TempDir(),
+	}
+
+	basePaths := []string{t.TempDir(), t.TempDir()}
+
+	for _, basePath := range basePaths {
+		r, err := NewResolver(config, WithBasePath(basePath))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resolved, err := r.Resolve(dependencySet(dep))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := r.Download(resolved); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, basePath := range basePaths {
+		archive := filepath.Join(basePath, reg.host, "shared@1.0.0", "shared@1.0.0.zip")
+		if _, err := os.Stat(archive); err != nil {
+			t.Errorf("expected archive in %s: %s", basePath, err)
+		}
+	}
+
+	if count := reg.requestCount("/shared@1.0.0.zip"); count != 2 {
+		t.Errorf("expected each resolver to download the archive, got %d requests", count)
+	}
+
+	if entries, _ := os.ReadDir(config.CacheDir); len(entries) != 0 {
+		t.Errorf("expected the default cache dir to stay empty")
+	}
+}
+
+func TestResolverUnusableCacheDir(t *testing.T) {
+	newResolver := func(cacheDir string) error {
+		_, err := NewResolver(&AppConfig{
+			Logger:   logger.New(new(bytes.Buffer), new(bytes.Buffer)),
+			ctx:      context.Background(),
+			CacheDir: cacheDir,
+		})
+		return err
+	}
+
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, []byte("not a directory"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := newResolver(file); err == nil || !strings.Contains(err.Error(), "invalid cache directory") {
+		t.Errorf("expected a cache dir below a file to be rejected, got %v", err)
+	}
+
+	if os.Geteuid() == 0 {
+		t.Skip("permissions are not enforced for root")
+	}
+
+	readOnly := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(readOnly, "package-2"), 0o555); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(readOnly, "package-2"), 0o555); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(filepath.Join(readOnly, "package-2"), 0o755) })
+
+	if err := newResolver(readOnly); err == nil || !strings.Contains(err.Error(), "is not writable") {
+		t.Errorf("expected a read-only cache dir to be rejected, got %v", err)
+	}
+}
+
+func TestResolveConflictingConstraints(t *testing.T) {
+	reg := newTestRegistry(t)
+	v1 := reg.add(t, "lib", "1.0.0", []byte("zip"))
+	v2 := reg.add(t, "lib", "2.0.0", []byte("zip"))
+	v2.Name = "libNext"
+
+	r := newTestResolver(t)
+
+	_, err := r.Resolve(dependencySet(v1, v2))
+	if err == nil {
+		t.Fatal("expected conflicting constraints error")
+	}
+
+	expected := fmt.Sprintf("conflicting version constraints: package://%s/lib requested as 1.0.0 (lib) and 2.0.0 (libNext)", reg.host)
+	if err.Error() != expected {
+		t.Errorf("expected %q, got %q", expected, err.Error())
+	}
+
+	if count := reg.requestCount("/lib@1.0.0") + reg.requestCount("/lib@2.0.0"); count != 0 {
+		t.Errorf("expected no network calls, got %d", count)
+	}
+}
+
+func TestValidateConstraints(t *testing.T) {
+	tests := []struct {
+		name       string
+		versions   []string
+		conflicted bool
+	}{
+		{"same major", []string{"1.0.0", "1.1.0"}, false},
+		{"build metadata", []string{"1.2.3+build.1", "1.2.3+build.2"}, false},
+		{"overlapping ranges", []string{"^1.0", "^1.2"}, false},
+		{"exact within range", []string{"1.0.0", "^1.2"}, false},
+		{"different majors", []string{"1.0.0", "2.0.0"}, true},
+		{"disjoint ranges", []string{"^1.0", "^2.0"}, true},
+		{"exact above range", []string{"1.5.0", "<1.2"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dependencies := make(map[string]Dependency)
+
+			for i, version := range tt.versions {
+				uri := "package://example.com/lib@" + version
+				dependencies[uri] = Dependency{Uri: uri, Name: fmt.Sprintf("lib%d", i)}
+			}
+
+			if err := ValidateConstraints(dependencies); (err != nil) != tt.conflicted {
+				t.Errorf("expected conflict %v for %v, got %v", tt.conflicted, tt.versions, err)
+			}
+		})
+	}
+}
+
+func TestResolvePlainHttpFallback(t *testing.T) {
+	reg := newTestRegistry(t)
+	dep := reg.add(t, "dev", "1.0.0", []byte("zip"))
+
+	strict := newTestResolver(t, func(config *AppConfig) {
+		config.PlainHttp = false
+	})
+
+	if _, err := strict.Resolve(dependencySet(dep)); err == nil {
+		t.Error("expected https request to a plain http host to fail")
+	}
+
+	errWriter := new(bytes.Buffer)
+	fallback := newTestResolver(t, func(config *AppConfig) {
+		config.Logger = logger.New(new(bytes.Buffer), errWriter)
+		config.PlainHttp = false
+		config.PlainHttpFallbackHosts = []string{"127.0.0.1"}
+	})
+
+	resolved, err := fallback.Resolve(dependencySet(dep))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if metadata := resolved[dep.Uri]; !metadata.PlainHttp {
+		t.Error("expected metadata to be marked as resolved over plain http")
+	}
+
+	if !strings.Contains(errWriter.String(), "falling back to plain http") {
+		t.Errorf("expected fallback warning, got %q", errWriter.String())
+	}
+}
+
+func TestDisallowPlainHttp(t *testing.T) {
+	reg := newTestRegistry(t)
+	dep := reg.add(t, "dev", "1.0.0", []byte("zip"))
+	dep.Name = "dev.plain"
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.PlainHttp = false
+		config.DisallowPlainHttp = true
+	})
+
+	if _, err := r.Resolve(dependencySet(dep)); !errors.Is(err, ErrPlainHttpDisallowed) {
+		t.Errorf("expected a .plain dependency to be rejected, got %v", err)
+	}
+
+	if reg.requestCount("/dev@1.0.0") != 0 {
+		t.Error("expected no request to reach the registry")
+	}
+
+	fallback := newTestResolver(t, func(config *AppConfig) {
+		config.PlainHttp = false
+		config.PlainHttpFallbackHosts = []string{"127.0.0.1"}
+		config.DisallowPlainHttp = true
+	})
+
+	dep.Name = "dev"
+	if _, err := fallback.Resolve(dependencySet(dep)); err == nil {
+		t.Error("expected the plain http fallback to be disabled")
+	}
+
+	metadata := &Metadata{Name: "dev", PackageUri: dep.Uri, Version: "1.0.0", PackageZipUrl: reg.server.URL + "/dev@1.0.0.zip", ResolverType: HTTP}
+
+	if _, err := fallback.Download(map[string]*Metadata{dep.Uri: metadata}); !errors.Is(err, ErrPlainHttpDisallowed) {
+		t.Errorf("expected a plain http archive to be rejected, got %v", err)
+	}
+}
+
+func TestResolveRegistryFallback(t *testing.T) {
+	primary := newTestRegistry(t)
+	secondary := newTestRegistry(t)
+	secondary.add(t, "lib", "1.0.0", []byte("zip"))
+
+	dep := Dependency{Uri: fmt.Sprintf("package://%s/lib@1.0.0", primary.host), Name: "lib"}
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.Registries = []string{primary.host, secondary.host}
+	})
+
+	resolved, err := r.Resolve(dependencySet(dep))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if metadata := resolved[dep.Uri]; metadata == nil || metadata.Registry != secondary.host {
+		t.Fatalf("expected lib to be served by the secondary registry, got %+v", metadata)
+	}
+
+	if primary.requestCount("/lib@1.0.0") != 1 {
+		t.Error("expected the primary registry to be tried first")
+	}
+
+	if _, err := r.Download(resolved); err != nil {
+		t.Fatal(err)
+	}
+
+	primary.mu.Lock()
+	primary.authorize = func(req *http.Request) bool { return false }
+	primary.mu.Unlock()
+
+	denied := newTestResolver(t, func(config *AppConfig) {
+		config.Registries = []string{primary.host, secondary.host}
+	})
+
+	if _, err := denied.Resolve(dependencySet(dep)); err == nil || errors.Is(err, ErrPackageNotFound) {
+		t.Errorf("expected a non 404 error from the primary registry, got %v", err)
+	}
+
+	if secondary.requestCount("/lib@1.0.0") != 1 {
+		t.Error("expected non 404 errors not to fall back to the secondary registry")
+	}
+}
+
+func TestDownloadEnforcesDeclaredChecksums(t *testing.T) {
+	reg := newTestRegistry(t)
+	// the registry is compromised, serving another archive with matching metadata
+	lib := reg.add(t, "lib", "1.0.0", []byte("compromised"))
+
+	trusted := sha256.Sum256([]byte("trusted"))
+	lib.Checksums = &Checksums{Sha256: hex.EncodeToString(trusted[:])}
+
+	r := newTestResolver(t)
+
+	resolved, err := r.Resolve(dependencySet(lib))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Download(resolved); err == nil || !strings.Contains(err.Error(), "declared by the project") {
+		t.Errorf("expected the project declared checksum to be enforced, got %v", err)
+	}
+
+	if exists, _ := r.Exists(resolved[lib.Uri]); exists {
+		t.Error("expected the rejected archive not to be stored")
+	}
+
+	served := sha256.Sum256([]byte("compromised"))
+	lib.Checksums = &Checksums{Sha256: hex.EncodeToString(served[:])}
+
+	r = newTestResolver(t)
+
+	resolved, err = r.Resolve(dependencySet(lib))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Download(resolved); err != nil {
+		t.Errorf("expected a matching declared checksum to pass, got %v", err)
+	}
+}
+
+func TestStrictMetadata(t *testing.T) {
+	reg := newTestRegistry(t)
+	lib := reg.add(t, "lib", "1.0.0", []byte("zip"))
+	reg.mu.Lock()
+	reg.metadata["/lib@1.0.0"] = []byte(fmt.Sprintf(`{"name":"lib","packageUri":%q,"version":"1.0.0","unexpected":true}`, lib.Uri))
+	reg.mu.Unlock()
+
+	for _, strict := range []bool{false, true} {
+		t.Run(fmt.Sprintf("strict=%t", strict), func(t *testing.T) {
+			r := newTestResolver(t, func(config *AppConfig) {
+				config.StrictMetadata = strict
+			})
+
+			_, err := r.Resolve(dependencySet(lib))
+
+			if strict && err == nil {
+				t.Error("expected metadata with an unknown field to be rejected")
+			}
+
+			if !strict && err != nil {
+				t.Errorf("expected unknown fields to be ignored, got %s", err)
+			}
+		})
+	}
+}
+
+func TestResolveReplaceDirective(t *testing.T) {
+	reg := newTestRegistry(t)
+	vulnerable := reg.add(t, "lib", "1.0.0", []byte("zip"))
+	patch := reg.add(t, "patch", "1.0.0", []byte("zip"))
+	patched := reg.add(t, "lib", "1.0.1", []byte("zip"), patch)
+	root := reg.add(t, "root", "1.0.0", []byte("zip"), vulnerable)
+
+	base, _, err := SplitPackageUri(vulnerable.Uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.Replace = map[string]string{base: "1.0.1"}
+	})
+
+	resolved, err := r.Resolve(dependencySet(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := resolved[vulnerable.Uri]; ok {
+		t.Errorf("expected %s to be replaced", vulnerable.Uri)
+	}
+
+	metadata, ok := resolved[patched.Uri]
+	if !ok {
+		t.Fatalf("expected %s to be resolved, got %v", patched.Uri, resolved)
+	}
+
+	if metadata.Replaced != vulnerable.Uri {
+		t.Errorf("expected the override of %s to be recorded, got %q", vulnerable.Uri, metadata.Replaced)
+	}
+
+	if _, ok := resolved[patch.Uri]; !ok {
+		t.Errorf("expected dependencies of the override to be resolved")
+	}
+
+	if count := reg.requestCount("/lib@1.0.0"); count != 0 {
+		t.Errorf("expected the replaced version not to be fetched, got %d requests", count)
+	}
+}
+
+func TestDeclaredChecksumsPerResolution(t *testing.T) {
+	reg := newTestRegistry(t)
+	lib := reg.add(t, "lib", "1.0.0", []byte("compromised"))
+	root := reg.add(t, "root", "1.0.0", []byte("root"), lib)
+
+	trusted := sha256.Sum256([]byte("trusted"))
+	declared := lib
+	declared.Checksums = &Checksums{Sha256: hex.EncodeToString(trusted[:])}
+
+	r := newTestResolver(t)
+
+	// the first resolutions record the closures the following ones are served from
+	for _, deps := range []map[string]Dependency{dependencySet(root, lib), dependencySet(root, declared), dependencySet(root, declared)} {
+		resolved, err := r.Resolve(deps)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if deps[lib.Uri].Checksums == nil {
+			if resolved[lib.Uri].DeclaredChecksums != nil {
+				t.Errorf("expected no declared checksums to leak from other resolutions, got %v", resolved[lib.Uri].DeclaredChecksums)
+			}
+			continue
+		}
+
+		if _, err := r.Download(resolved); err == nil || !strings.Contains(err.Error(), "declared by the project") {
+			t.Errorf("expected the declared checksum to be enforced on every resolution, got %v", err)
+		}
+	}
+
+	store := NewMetadataStore(0)
+	undeclared := newTestResolver(t)
+	WithMetadataStore(store)(undeclared)
+	enforcing := newTestResolver(t)
+	WithMetadataStore(store)(enforcing)
+
+	if _, err := enforcing.Resolve(dependencySet(declared)); err != nil {
+		t.Fatal(err)
+	}
+
+	resolved, err := undeclared.Resolve(dependencySet(lib))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := undeclared.Download(resolved); err != nil {
+		t.Errorf("expected the checksums declared to another resolver not to be enforced, got %v", err)
+	}
+}
+
+func TestReplacedPerResolution(t *testing.T) {
+	reg := newTestRegistry(t)
+	vulnerable := reg.add(t, "lib", "1.0.0", []byte("zip"))
+	patched := reg.add(t, "lib", "1.0.1", []byte("zip"))
+	root := reg.add(t, "root", "1.0.0", []byte("zip"), vulnerable)
+
+	base, _, err := SplitPackageUri(vulnerable.Uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewMetadataStore(0)
+	replacing := newTestResolver(t, func(config *AppConfig) {
+		config.Replace = map[string]string{base: "1.0.1"}
+	})
+	WithMetadataStore(store)(replacing)
+	plain := newTestResolver(t)
+	WithMetadataStore(store)(plain)
+
+	for i := 0; i < 2; i++ {
+		resolved, err := replacing.Resolve(dependencySet(root))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if metadata := resolved[patched.Uri]; metadata == nil || metadata.Replaced != vulnerable.Uri {
+			t.Errorf("expected the override of %s to be recorded on resolution %d, got %v", vulnerable.Uri, i, metadata)
+		}
+	}
+
+	resolved, err := plain.Resolve(dependencySet(patched))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if metadata := resolved[patched.Uri]; metadata.Replaced != "" || len(metadata.Advisories) != 0 {
+		t.Errorf("expected the override of another resolver not to leak, got %q and %v", metadata.Replaced, metadata.Advisories)
+	}
+}
+
+func TestPreviewReplace(t *testing.T) {
+	reg := newTestRegistry(t)
+	shared := reg.add(t, "shared", "1.0.0", []byte("zip"))
+	patch := reg.add(t, "patch", "1.0.0", []byte("zip"))
+	reg.add(t, "shared", "1.1.0", []byte("zip"), patch)
+	first := reg.add(t, "first", "1.0.0", []byte("zip"), shared)
+	second := reg.add(t, "second", "1.0.0", []byte("zip"), shared)
+	other := reg.add(t, "other", "1.0.0", []byte("zip"))
+
+	base, _, err := SplitPackageUri(shared.Uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newTestResolver(t)
+	deps := dependencySet(first, second, other)
+
+	report, err := r.PreviewReplace(deps, map[string]string{base: "1.1.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patchBase, _, err := SplitPackageUri(patch.Uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := UpgradeReport{
+		Added:    []PackageChange{{Package: patchBase, To: "1.0.0"}},
+		Upgraded: []PackageChange{{Package: base, From: "1.0.0", To: "1.1.0"}},
+	}
+
+	if diff := cmp.Diff(expected, report); diff != "" {
+		t.Errorf("unexpected preview (-want +got):\n%s", diff)
+	}
+
+	if len(r.config.Replace) != 0 || r.cache.Len() != 0 {
+		t.Errorf("expected the preview to leave the resolver untouched, got replace %v and %d cached", r.config.Replace, r.cache.Len())
+	}
+
+	if cached, err := r.ListCached(); err != nil || len(cached) != 0 {
+		t.Errorf("expected nothing to be downloaded, got %v %v", cached, err)
+	}
+
+	resolved, err := r.Resolve(deps)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := resolved[shared.Uri]; !ok {
+		t.Errorf("expected a regular resolution to keep %s, got %v", shared.Uri, resolved)
+	}
+}
+
+func TestResolveLeafWithoutDependencies(t *testing.T) {
+	reg := newTestRegistry(t)
+	leaf := reg.add(t, "leaf", "1.0.0", []byte("zip"))
+	root := reg.add(t, "root", "1.0.0", []byte("zip"), leaf)
+
+	sum := sha256.Sum256([]byte("zip"))
+	reg.mu.Lock()
+	reg.metadata["/leaf@1.0.0"] = []byte(fmt.Sprintf(
+		`{"name":"leaf","packageUri":%q,"version":"1.0.0","packageZipUrl":%q,"packageZipChecksums":{"sha256":%q}}`,
+		leaf.Uri, reg.server.URL+"/leaf@1.0.0.zip", hex.EncodeToString(sum[:]),
+	))
+	reg.mu.Unlock()
+
+	r := newTestResolver(t)
+
+	resolved, err := r.Resolve(dependencySet(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metadata := resolved[leaf.Uri]
+	if metadata == nil || metadata.Dependencies == nil || len(metadata.Dependencies) != 0 {
+		t.Fatalf("expected leaf to resolve with an empty dependency map, got %+v", metadata)
+	}
+
+	if _, err := r.Download(resolved); err != nil {
+		t.Fatal(err)
+	}
+
+	if deps := CollectRemoteDependencies(nil); len(deps) != 0 {
+		t.Errorf("expected no dependencies for a nil project dependency set, got %v", deps)
+	}
+}
+
+func TestReachableFrom(t *testing.T) {
+	reg := newTestRegistry(t)
+	shared := reg.add(t, "shared", "1.0.0", []byte("zip"))
+	leaf := reg.add(t, "leaf", "1.0.0", []byte("zip"))
+	app := reg.add(t, "app", "1.0.0", []byte("zip"), shared, leaf)
+	unrelated := reg.add(t, "unrelated", "1.0.0", []byte("zip"), shared)
+
+	r := newTestResolver(t)
+
+	resolved, err := r.Resolve(dependencySet(app, unrelated))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reachable := r.ReachableFrom(app.Uri, resolved)
+
+	var actual []string
+	for uri := range reachable {
+		actual = append(actual, uri)
+	}
+	sort.Strings(actual)
+
+	expected := []string{app.Uri, leaf.Uri, shared.Uri}
+	sort.Strings(expected)
+
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Errorf("unexpected closure of %s (-expected +actual):\n%s", app.Uri, diff)
+	}
+
+	if len(r.ReachableFrom("package://example.com/missing@1.0.0", resolved)) != 0 {
+		t.Error("expected nothing to be reachable from an unknown root")
+	}
+}
+
+func TestResolveFromMetadataIndex(t *testing.T) {
+	reg := newTestRegistry(t)
+	a := reg.add(t, "a", "1.0.0", []byte("zip"))
+	b := reg.add(t, "b", "1.0.0", []byte("zip"), a)
+	c := reg.add(t, "c", "1.0.0", []byte("zip"))
+	root := reg.add(t, "root", "1.0.0", []byte("zip"), b, c)
+
+	reg.mu.Lock()
+	index := fmt.Sprintf("[%s,%s,%s]", reg.metadata["/a@1.0.0"], reg.metadata["/b@1.0.0"], reg.metadata["/root@1.0.0"])
+	reg.mu.Unlock()
+	reg.serve("/index.json", []byte(index))
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.MetadataIndexUrl = reg.server.URL + "/index.json"
+	})
+
+	resolved, err := r.Resolve(dependencySet(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resolved) != 4 {
+		t.Errorf("expected 4 resolved packages, got %d", len(resolved))
+	}
+
+	for path, expected := range map[string]int{"/index.json": 1, "/root@1.0.0": 0, "/a@1.0.0": 0, "/b@1.0.0": 0, "/c@1.0.0": 1} {
+		if count := reg.requestCount(path); count != expected {
+			t.Errorf("expected %d requests for %s, got %d", expected, path, count)
+		}
+	}
+
+	if _, err := r.Download(resolved); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolveStream(t *testing.T) {
+	reg := newTestRegistry(t)
+	leaf := reg.add(t, "leaf", "1.0.0", []byte("zip"))
+	middle := reg.add(t, "middle", "1.0.0", []byte("zip"), leaf)
+	root := reg.add(t, "root", "1.0.0", []byte("zip"), middle, leaf)
+
+	r := newTestResolver(t)
+
+	var names []string
+	err := r.ResolveStream(dependencySet(root), func(metadata *Metadata) error {
+		names = append(names, metadata.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(names) != 3 || names[0] != "root" {
+		t.Errorf("expected root followed by its 2 dependencies, got %v", names)
+	}
+}
+
+func TestResolveStreamAbort(t *testing.T) {
+	reg := newTestRegistry(t)
+	leaf := reg.add(t, "leaf", "1.0.0", []byte("zip"))
+	root := reg.add(t, "root", "1.0.0", []byte("zip"), leaf)
+
+	r := newTestResolver(t)
+	stop := fmt.Errorf("stop")
+
+	calls := 0
+	err := r.ResolveStream(dependencySet(root), func(metadata *Metadata) error {
+		calls++
+		return stop
+	})
+
+	if err != stop {
+		t.Errorf("expected callback error to be returned, got %v", err)
+	}
+
+	if calls != 1 {
+		t.Errorf("expected resolution to stop after the first callback, got %d calls", calls)
+	}
+
+	if count := reg.requestCount("/leaf@1.0.0"); count != 0 {
+		t.Errorf("expected leaf not to be fetched after abort, got %d requests", count)
+	}
+}
+
+func TestResolveConstraintWithIndexSnapshot(t *testing.T) {
+	reg := newTestRegistry(t)
+	reg.add(t, "lib", "1.0.0", []byte("zip"))
+	pinned := reg.add(t, "lib", "1.1.0", []byte("zip"))
+	reg.add(t, "lib", "1.2.0", []byte("zip"))
+
+	base := fmt.Sprintf("package://%s/lib", reg.host)
+	snapshot := IndexSnapshot{base: {"1.0.0", "1.1.0", "2.0.0"}}
+
+	r, err := NewResolver(newTestResolver(t).config, WithIndexSnapshot(snapshot))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolved, err := r.Resolve(dependencySet(Dependency{Uri: base + "@^1.0", Name: "lib"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := resolved[pinned.Uri]; !ok || len(resolved) != 1 {
+		t.Errorf("expected only %s to be resolved, got %v", pinned.Uri, resolved)
+	}
+
+	if count := reg.requestCount("/lib@1.2.0"); count != 0 {
+		t.Errorf("expected newer upstream version to be ignored, got %d requests", count)
+	}
+}
+
+func TestPrereleasePolicy(t *testing.T) {
+	reg := newTestRegistry(t)
+	stable := reg.add(t, "lib", "1.1.0", []byte("zip"))
+	prerelease := reg.add(t, "lib", "1.2.0-rc.1", []byte("zip"))
+
+	base := fmt.Sprintf("package://%s/lib", reg.host)
+	snapshot := IndexSnapshot{base: {"1.0.0", "1.1.0", "1.2.0-rc.1"}}
+
+	for _, tt := range []struct {
+		name     string
+		include  bool
+		expected Dependency
+	}{
+		{"stable by default", false, stable},
+		{"pre-release when opted in", true, prerelease},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := newTestResolver(t).config
+			config.IncludePrereleases = tt.include
+
+			r, err := NewResolver(config, WithIndexSnapshot(snapshot))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resolved, err := r.Resolve(dependencySet(Dependency{Uri: base + "@^1.0", Name: "lib"}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, ok := resolved[tt.expected.Uri]; !ok || len(resolved) != 1 {
+				t.Errorf("expected the constraint to select %s, got %v", tt.expected.Uri, resolved)
+			}
+
+			both := map[string]*Metadata{
+				stable.Uri:     {Name: "lib", Version: "1.1.0", PackageUri: stable.Uri},
+				prerelease.Uri: {Name: "lib", Version: "1.2.0-rc.1", PackageUri: prerelease.Uri},
+			}
+
+			deduplicated, err := r.Deduplicate(both, DedupHighestVersion)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, ok := deduplicated[tt.expected.Uri]; !ok || len(deduplicated) != 1 {
+				t.Errorf("expected deduplication to keep %s, got %v", tt.expected.Uri, deduplicated)
+			}
+		})
+	}
+}
+
+func TestVersionComparator(t *testing.T) {
+	reg := newTestRegistry(t)
+	selected := reg.add(t, "lib", "1.2.0", []byte("zip"))
+	reg.add(t, "lib", "1.3.0", []byte("zip"))
+	reg.add(t, "lib", "1.4.0", []byte("zip"))
+
+	base := fmt.Sprintf("package://%s/lib", reg.host)
+	snapshot := IndexSnapshot{base: {"1.1.0", "1.2.0", "1.3.0", "1.4.0"}}
+
+	// prefers versions with an even minor, and the lowest among them
+	lowestEvenMinor := func(a *semver.Version, b *semver.Version) int {
+		aEven, bEven := a.Minor()%2 == 0, b.Minor()%2 == 0
+
+		if aEven != bEven {
+			if aEven {
+				return 1
+			}
+			return -1
+		}
+
+		return b.Compare(a)
+	}
+
+	r, err := NewResolver(newTestResolver(t).config, WithIndexSnapshot(snapshot), WithVersionComparator(lowestEvenMinor))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolved, err := r.Resolve(dependencySet(Dependency{Uri: base + "@^1.0", Name: "lib"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := resolved[selected.Uri]; !ok || len(resolved) != 1 {
+		t.Errorf("expected the constraint to select %s, got %v", selected.Uri, resolved)
+	}
+
+	versions := make(map[string]*Metadata)
+	for _, version := range []string{"1.1.0", "1.2.0", "1.3.0", "1.4.0"} {
+		uri := fmt.Sprintf("%s@%s", base, version)
+		versions[uri] = &Metadata{Name: "lib", Version: version, PackageUri: uri}
+	}
+
+	deduplicated, err := r.Deduplicate(versions, DedupHighestVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := deduplicated[selected.Uri]; !ok || len(deduplicated) != 1 {
+		t.Errorf("expected deduplication to keep %s, got %v", selected.Uri, deduplicated)
+	}
+
+	deduplicated, err = newTestResolver(t).Deduplicate(versions, DedupHighestVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := deduplicated[base+"@1.4.0"]; !ok || len(deduplicated) != 1 {
+		t.Errorf("expected the highest version to be kept by default, got %v", deduplicated)
+	}
+}
+
+func TestResolveContextCorrelationID(t *testing.T) {
+	reg := newTestRegistry(t)
+	out := new(bytes.Buffer)
+	shared := logger.New(out, out)
+	shared.SetLevel(logger.LevelDebug)
+
+	packages := map[string]Dependency{
+		"first":  reg.add(t, "first", "1.0.0", []byte("first")),
+		"second": reg.add(t, "second", "1.0.0", []byte("second")),
+	}
+
+	// both resolutions share the resolver, its caches and the resolvers it delegates to
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.Logger = shared
+	})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(packages))
+
+	for id, dep := range packages {
+		wg.Add(1)
+		go func(id string, dep Dependency) {
+			defer wg.Done()
+			ctx := logger.WithCorrelationID(context.Background(), id)
+
+			resolved, err := r.ResolveContext(ctx, dependencySet(dep))
+			if err == nil {
+				_, err = r.DownloadContext(ctx, resolved)
+			}
+			errs <- err
+		}(id, dep)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+
+	for _, line := range lines {
+		matched := false
+
+		for id, dep := range packages {
+			if strings.Contains(line, dep.Uri) {
+				matched = true
+
+				if !strings.HasPrefix(line, "["+id+"] ") {
+					t.Errorf("expected line about %s to carry id %s: %q", dep.Uri, id, line)
+				}
+			}
+		}
+
+		if !matched {
+			t.Errorf("unexpected line %q", line)
+		}
+	}
+
+	if len(lines) < 4 {
+		t.Errorf("expected resolution and download lines for both packages, got %q", out.String())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := r.ResolveContext(ctx, dependencySet(reg.add(t, "third", "1.0.0", []byte("third")))); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected metadata requests to be aborted with the context, got %v", err)
+	}
+}
+
+func TestDownloadCleansUpPartialFiles(t *testing.T) {
+	reg := newTestRegistry(t)
+	dep := reg.add(t, "broken", "1.0.0", []byte("zip"))
+
+	r := newTestResolver(t)
+
+	resolved, err := r.Resolve(dependencySet(dep))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	injected := fmt.Errorf("disk full")
+	writeFile = func(name string, data []byte, perm os.FileMode) error {
+		if strings.HasSuffix(name, ".zip") {
+			return injected
+		}
+		return os.WriteFile(name, data, perm)
+	}
+	t.Cleanup(func() { writeFile = os.WriteFile })
+
+	_, err = r.Download(resolved)
+	if !errors.Is(err, injected) {
+		t.Fatalf("expected the write error to be returned, got %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(r.basePath, reg.host, "broken@1.0.0")); !os.IsNotExist(err) {
+		t.Errorf("expected partial package directory to be removed, got %v", err)
+	}
+}
+
+func TestDownloadStoresIdenticalArchivesOnce(t *testing.T) {
+	reg := newTestRegistry(t)
+	first := reg.add(t, "first", "1.0.0", []byte("shared archive"))
+	second := reg.add(t, "second", "2.0.0", []byte("shared archive"))
+
+	r := newTestResolver(t)
+
+	resolved, err := r.Resolve(dependencySet(first, second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Download(resolved); err != nil {
+		t.Fatal(err)
+	}
+
+	blobs, err := os.ReadDir(filepath.Join(r.basePath, blobsDir, "sha256"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(blobs) != 1 {
+		t.Errorf("expected the shared archive to be stored once, got %d blobs", len(blobs))
+	}
+
+	firstInfo, err := os.Stat(filepath.Join(r.basePath, reg.host, "first@1.0.0", "first@1.0.0.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secondInfo, err := os.Stat(filepath.Join(r.basePath, reg.host, "second@2.0.0", "second@2.0.0.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !os.SameFile(firstInfo, secondInfo) {
+		t.Error("expected both packages to link the same archive")
+	}
+}
+
+func TestDownloadReusesStoredArchives(t *testing.T) {
+	reg := newTestRegistry(t)
+	first := reg.add(t, "first", "1.0.0", []byte("vendored archive"))
+	second := reg.add(t, "second", "1.0.0", []byte("vendored archive"))
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.ReuseArchives = true
+	})
+
+	resolved, err := r.Resolve(dependencySet(first, second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths := make(map[string]string)
+
+	for _, dep := range []Dependency{first, second} {
+		downloaded, err := r.Download(map[string]*Metadata{dep.Uri: resolved[dep.Uri]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths[dep.Uri] = downloaded[dep.Uri]
+	}
+
+	if count := reg.requestCount("/second@1.0.0.zip"); count != 0 {
+		t.Errorf("expected the stored archive to be reused, got %d requests", count)
+	}
+
+	blobs, err := os.ReadDir(filepath.Join(r.basePath, blobsDir, "sha256"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(blobs) != 1 {
+		t.Errorf("expected the archive bytes to be stored once, got %d blobs", len(blobs))
+	}
+
+	firstInfo, err := os.Stat(paths[first.Uri])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secondInfo, err := os.Stat(paths[second.Uri])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !os.SameFile(firstInfo, secondInfo) {
+		t.Error("expected both packages to link the same archive")
+	}
+}
+
+func TestRegistryProxy(t *testing.T) {
+	reg := newTestRegistry(t)
+	lib := reg.add(t, "lib", "1.0.0", []byte("zip"))
+
+	var mu sync.Mutex
+	cached := make(map[string][]byte)
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		key := req.Header.Get("X-Forwarded-Host") + req.URL.Path
+
+		if _, ok := cached[key]; !ok {
+			resp, err := http.Get("http://" + key)
+			if err != nil || resp.StatusCode != http.StatusOK {
+				http.Error(w, "upstream failure", http.StatusBadGateway)
+				return
+			}
+			defer resp.Body.Close()
+
+			data := new(bytes.Buffer)
+			data.ReadFrom(resp.Body)
+			cached[key] = data.Bytes()
+		}
+
+		w.Write(cached[key])
+	}))
+	t.Cleanup(proxy.Close)
+
+	download := func() error {
+		r := newTestResolver(t, func(config *AppConfig) {
+			config.RegistryProxyURL = proxy.URL
+		})
+
+		resolved, err := r.Resolve(dependencySet(lib))
+		if err != nil {
+			return err
+		}
+
+		_, err = r.Download(resolved)
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := download(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if count := reg.requestCount("/lib@1.0.0.zip"); count != 1 {
+		t.Errorf("expected the proxy to serve the cached archive, got %d upstream requests", count)
+	}
+
+	mu.Lock()
+	cached[reg.host+"/lib@1.0.0.zip"] = []byte("tampered")
+	mu.Unlock()
+
+	if err := download(); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected archives served by the proxy to be verified, got %v", err)
+	}
+}
+
+func TestHttpTokenRefresh(t *testing.T) {
+	var mu sync.Mutex
+	issued := 0
+	valid := ""
+
+	tokens := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id, secret, ok := req.BasicAuth()
+		req.ParseForm()
+
+		if !ok || id != "hpkl" || secret != "s3cret" || req.PostForm.Get("grant_type") != "client_credentials" {
+			http.Error(w, "invalid client", http.StatusUnauthorized)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		issued++
+		valid = fmt.Sprintf("token-%d", issued)
+
+		json.NewEncoder(w).Encode(map[string]any{"access_token": valid, "token_type": "Bearer", "expires_in": 3600})
+	}))
+	t.Cleanup(tokens.Close)
+
+	issuedCount := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return issued
+	}
+
+	reg := newTestRegistry(t)
+	reg.mu.Lock()
+	reg.authorize = func(req *http.Request) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return valid != "" && req.Header.Get("Authorization") == "Bearer "+valid
+	}
+	reg.mu.Unlock()
+
+	first := reg.add(t, "first", "1.0.0", []byte("first"))
+	second := reg.add(t, "second", "1.0.0", []byte("second"))
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.HttpTokenUrl = tokens.URL
+		config.HttpClientId = "hpkl"
+		config.HttpClientSecret = "s3cret"
+		config.HttpTokenPrefixes = []string{reg.host}
+	})
+
+	resolved, err := r.Resolve(dependencySet(first))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Download(resolved); err != nil {
+		t.Fatal(err)
+	}
+
+	if count := issuedCount(); count != 1 {
+		t.Errorf("expected the token to be cached, got %d tokens issued", count)
+	}
+
+	// the server revokes the cached token, the next request must refresh it once
+	mu.Lock()
+	valid = "revoked"
+	mu.Unlock()
+
+	if _, err := r.Resolve(dependencySet(second)); err != nil {
+		t.Fatal(err)
+	}
+
+	if count := issuedCount(); count != 2 {
+		t.Errorf("expected a single refresh after 401, got %d tokens issued", count)
+	}
+
+	unauthorized := newTestResolver(t, func(config *AppConfig) {
+		config.HttpTokenUrl = tokens.URL
+		config.HttpClientId = "hpkl"
+		config.HttpClientSecret = "wrong"
+		config.HttpTokenPrefixes = []string{reg.host}
+	})
+
+	if _, err := unauthorized.Resolve(dependencySet(first)); err == nil || !strings.Contains(err.Error(), "token request") {
+		t.Errorf("expected invalid client credentials to fail, got %v", err)
+	}
+}
+
+func TestHttpTokenLimitedToRegistry(t *testing.T) {
+	tokens := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"access_token": "registry-token", "token_type": "Bearer"})
+	}))
+	t.Cleanup(tokens.Close)
+
+	archive := []byte("lib")
+	var cdnAuthorization []string
+
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		cdnAuthorization = append(cdnAuthorization, req.Header.Get("Authorization"))
+		w.Write(archive)
+	}))
+	t.Cleanup(cdn.Close)
+
+	reg := newTestRegistry(t)
+	reg.mu.Lock()
+	reg.authorize = func(req *http.Request) bool {
+		return req.Header.Get("Authorization") == "Bearer registry-token"
+	}
+	reg.mu.Unlock()
+
+	sum := sha256.Sum256(archive)
+	reg.publish(t, "/lib@1.0.0", Metadata{
+		Name:                "lib",
+		PackageUri:          fmt.Sprintf("package://%s/lib@1.0.0", reg.host),
+		Version:             "1.0.0",
+		PackageZipUrl:       cdn.URL + "/lib@1.0.0.zip",
+		PackageZipChecksums: Checksums{Sha256: hex.EncodeToString(sum[:])},
+	}, nil)
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.HttpTokenUrl = tokens.URL
+		config.HttpTokenPrefixes = []string{reg.host}
+	})
+
+	resolved, err := r.Resolve(dependencySet(Dependency{Uri: fmt.Sprintf("package://%s/lib@1.0.0", reg.host), Name: "lib"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Download(resolved); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cdnAuthorization) != 1 || cdnAuthorization[0] != "" {
+		t.Errorf("expected the archive host not to receive the registry token, got %q", cdnAuthorization)
+	}
+}
+
+func TestHttpTokenRequiresPrefixes(t *testing.T) {
+	config := &AppConfig{
+		Logger:       logger.New(new(bytes.Buffer), new(bytes.Buffer)),
+		ctx:          context.Background(),
+		CacheDir:     t.TempDir(),
+		HttpTokenUrl: "https://auth.example.com/token",
+	}
+
+	if _, err := NewResolver(config); !errors.Is(err, ErrTokenPrefixesRequired) {
+		t.Errorf("expected a token url without prefixes to be rejected, got %v", err)
+	}
+}
+
+func TestDownloadReturnsArchivePaths(t *testing.T) {
+	reg := newTestRegistry(t)
+	cached := reg.add(t, "cached", "1.0.0", []byte("cached"))
+	fresh := reg.add(t, "fresh", "1.0.0", []byte("fresh"))
+
+	r := newTestResolver(t)
+
+	resolved, err := r.Resolve(dependencySet(cached))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Download(resolved); err != nil {
+		t.Fatal(err)
+	}
+
+	resolved, err = r.Resolve(dependencySet(cached, fresh))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := r.Download(resolved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		cached.Uri: filepath.Join(r.basePath, reg.host, "cached@1.0.0", "cached@1.0.0.zip"),
+		fresh.Uri:  filepath.Join(r.basePath, reg.host, "fresh@1.0.0", "fresh@1.0.0.zip"),
+	}
+
+	if diff := cmp.Diff(expected, paths); diff != "" {
+		t.Errorf("unexpected archive paths (-expected +actual):\n%s", diff)
+	}
+
+	for uri, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected archive of %s at %s: %s", uri, path, err)
+		}
+	}
+
+	if count := reg.requestCount("/cached@1.0.0.zip"); count != 1 {
+		t.Errorf("expected the cached archive not to be downloaded again, got %d requests", count)
+	}
+}
+
+func TestDownloadConcurrencyPerHost(t *testing.T) {
+	registries := []*testRegistry{newTestRegistry(t), newTestRegistry(t)}
+
+	var deps []Dependency
+	for i, reg := range registries {
+		reg.archiveDelay = 20 * time.Millisecond
+
+		for j := 0; j < 6; j++ {
+			deps = append(deps, reg.add(t, fmt.Sprintf("pkg%d_%d", i, j), "1.0.0", []byte("zip")))
+		}
+	}
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.DownloadConcurrency = 10
+		config.DownloadConcurrencyPerHost = 2
+	})
+
+	resolved, err := r.Resolve(dependencySet(deps...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Download(resolved); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, reg := range registries {
+		reg.mu.Lock()
+		maxInFlight := reg.maxInFlight
+		reg.mu.Unlock()
+
+		if maxInFlight > 2 {
+			t.Errorf("expected at most 2 concurrent downloads from %s, got %d", reg.host, maxInFlight)
+		}
+
+		if maxInFlight < 1 {
+			t.Errorf("expected archives to be downloaded from %s", reg.host)
+		}
+	}
+}
+
+func BenchmarkResolveWide(b *testing.B) {
+	reg := newTestRegistry(b)
+
+	var deps []Dependency
+	for i := 0; i < 100; i++ {
+		deps = append(deps, reg.add(b, fmt.Sprintf("pkg%d", i), "1.0.0", []byte("zip")))
+	}
+	root := reg.add(b, "root", "1.0.0", []byte("zip"), deps...)
+
+	configs := map[string]func(config *AppConfig){
+		"default": func(config *AppConfig) {},
+		"tuned": func(config *AppConfig) {
+			config.MaxIdleConns = 200
+			config.MaxIdleConnsPerHost = 100
+		},
+	}
+
+	for name, configure := range configs {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				r := newTestResolver(b, configure)
+
+				if _, err := r.Resolve(dependencySet(root)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveRepeatedSkipsResolvedSubtrees(t *testing.T) {
+	reg := newTestRegistry(t)
+
+	var deps []Dependency
+	for i := 0; i < 10; i++ {
+		leaf := reg.add(t, fmt.Sprintf("leaf%d", i), "1.0.0", []byte("zip"))
+		deps = append(deps, reg.add(t, fmt.Sprintf("pkg%d", i), "1.0.0", []byte("zip"), leaf))
+	}
+	root := reg.add(t, "root", "1.0.0", []byte("zip"), deps...)
+
+	// every metadata lookup of the walk records the package timings
+	timings := NewTimings()
+	r := newTestResolver(t)
+	WithTimings(timings)(r)
+
+	var lookups []int
+
+	for i := 0; i < 2; i++ {
+		timings.Reset()
+
+		resolved, err := r.Resolve(dependencySet(root))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(resolved) != 21 {
+			t.Fatalf("expected 21 resolved packages, got %d", len(resolved))
+		}
+
+		lookups = append(lookups, len(timings.Packages()))
+	}
+
+	if lookups[0] != 21 {
+		t.Errorf("expected the first resolve to look up every package, got %d lookups", lookups[0])
+	}
+
+	if lookups[1] >= lookups[0] {
+		t.Errorf("expected the second resolve to skip the resolved subtrees, got %d lookups after %d", lookups[1], lookups[0])
+	}
+}
+
+func TestResolveVersionPrefix(t *testing.T) {
+	reg := newTestRegistry(t)
+	prefixed := reg.add(t, "lib", "v1.2.3", []byte("prefixed"))
+	plain := reg.add(t, "lib", "1.2.4", []byte("plain"))
+	root := reg.add(t, "root", "1.0.0", []byte("root"), prefixed)
+
+	r := newTestResolver(t)
+
+	resolved, err := r.Resolve(dependencySet(root, plain))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prefixedKey, err := r.MajorVersionPackage(resolved[prefixed.Uri])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plainKey, err := r.MajorVersionPackage(resolved[plain.Uri])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if prefixedKey != plainKey {
+		t.Errorf("expected v1.2.3 and 1.2.4 to share a major version key, got %s and %s", prefixedKey, plainKey)
+	}
+
+	deduplicated, err := r.Deduplicate(resolved, DedupHighestVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := deduplicated[plain.Uri]; !ok || len(deduplicated) != 2 {
+		t.Errorf("expected lib to be deduplicated to 1.2.4, got %v", deduplicated)
+	}
+}
+
+func TestResolveMaxDepth(t *testing.T) {
+	reg := newTestRegistry(t)
+
+	var chain []string
+	dependency := reg.add(t, "pkg4", "1.0.0", []byte("pkg4"))
+	chain = append(chain, dependency.Uri)
+
+	for i := 3; i >= 0; i-- {
+		dependency = reg.add(t, fmt.Sprintf("pkg%d", i), "1.0.0", []byte("pkg"), dependency)
+		chain = append([]string{dependency.Uri}, chain...)
+	}
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.MaxResolveDepth = 3
+	})
+
+	_, err := r.Resolve(dependencySet(dependency))
+	if !errors.Is(err, ErrResolveDepthExceeded) {
+		t.Fatalf("expected ErrResolveDepthExceeded, got %v", err)
+	}
+
+	if expected := strings.Join(chain[:4], " -> "); !strings.HasSuffix(err.Error(), expected) {
+		t.Errorf("expected the error to name the chain %s, got %v", expected, err)
+	}
+
+	r = newTestResolver(t, func(config *AppConfig) {
+		config.MaxResolveDepth = 5
+	})
+
+	if resolved, err := r.Resolve(dependencySet(dependency)); err != nil || len(resolved) != 5 {
+		t.Errorf("expected the chain to resolve within 5 levels, got %d packages and %v", len(resolved), err)
+	}
+}
+
+func TestResolveAdvisories(t *testing.T) {
+	primary := newTestRegistry(t)
+	secondary := newTestRegistry(t)
+	lib := secondary.add(t, "lib", "1.0.0", []byte("zip"))
+	tool := primary.add(t, "tool", "1.1.0", []byte("zip"))
+	pinned := primary.add(t, "tool", "1.0.0", []byte("zip"))
+
+	fallback := Dependency{Uri: fmt.Sprintf("package://%s/lib@1.0.0", primary.host), Name: "lib"}
+
+	base, _, err := SplitPackageUri(tool.Uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.Registries = []string{primary.host, secondary.host}
+		config.Replace = map[string]string{base: "1.0.0"}
+	})
+
+	resolved, err := r.Resolve(dependencySet(fallback, tool))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Advisory{
+		{Uri: lib.Uri, Kind: AdvisoryRegistryFallback, Detail: "resolved from fallback registry " + secondary.host},
+		{Uri: pinned.Uri, Kind: AdvisoryReplaced, Detail: "replaced " + tool.Uri},
+		{Uri: pinned.Uri, Kind: AdvisoryDowngrade, Detail: "version 1.0.0 is lower than the requested 1.1.0"},
+	}
+
+	// registries listen on random ports, advisories are ordered by uri
+	sort.Slice(expected, func(i, j int) bool {
+		return expected[i].Uri < expected[j].Uri || expected[i].Uri == expected[j].Uri && expected[i].Kind < expected[j].Kind
+	})
+
+	if diff := cmp.Diff(expected, Advisories(resolved)); diff != "" {
+		t.Errorf("unexpected advisories (-expected +actual):\n%s", diff)
+	}
+}
+
+func TestResolveDirect(t *testing.T) {
+	reg := newTestRegistry(t)
+	leaf := reg.add(t, "leaf", "1.0.0", []byte("leaf"))
+	root := reg.add(t, "root", "1.0.0", []byte("root"), leaf)
+
+	r := newTestResolver(t)
+
+	resolved, err := r.ResolveDirect(dependencySet(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := resolved[root.Uri]; !ok || len(resolved) != 1 {
+		t.Errorf("expected only %s to be resolved, got %v", root.Uri, resolved)
+	}
+
+	if count := reg.requestCount("/leaf@1.0.0"); count != 0 {
+		t.Errorf("expected the transitive dependency not to be fetched, got %d requests", count)
+	}
+
+	resolved, err = r.Resolve(dependencySet(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resolved) != 2 {
+		t.Errorf("expected a later Resolve to walk the whole graph, got %v", resolved)
+	}
+}
+
+func TestDownloadContinueOnError(t *testing.T) {
+	reg := newTestRegistry(t)
+	first := reg.add(t, "first", "1.0.0", []byte("first"))
+	broken := reg.add(t, "broken", "1.0.0", []byte("broken"))
+	second := reg.add(t, "second", "1.0.0", []byte("second"))
+	third := reg.add(t, "third", "1.0.0", []byte("third"))
+	reg.serve("/broken@1.0.0.zip", []byte("corrupted"))
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.ContinueOnError = true
+		config.DownloadConcurrency = 1
+	})
+
+	resolved, err := r.Resolve(dependencySet(first, broken, second, third))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := r.Download(resolved)
+
+	if err == nil || !strings.Contains(err.Error(), broken.Uri) || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected the failed download of %s to be reported, got %v", broken.Uri, err)
+	}
+
+	for _, dep := range []Dependency{first, second, third} {
+		if _, ok := paths[dep.Uri]; !ok {
+			t.Errorf("expected the path of %s to be returned", dep.Uri)
+		}
+
+		if exists, err := r.Exists(resolved[dep.Uri]); err != nil || !exists {
+			t.Errorf("expected %s to be cached, got %v", dep.Uri, err)
+		}
+	}
+
+	if _, ok := paths[broken.Uri]; ok {
+		t.Errorf("expected no path for %s", broken.Uri)
+	}
+}
+
+func TestDownloadAbortsOnChecksumMismatch(t *testing.T) {
+	slow := newTestRegistry(t)
+	slow.archiveDelay = 3 * time.Second
+	first := slow.add(t, "first", "1.0.0", []byte("first"))
+	second := slow.add(t, "second", "1.0.0", []byte("second"))
+
+	fast := newTestRegistry(t)
+	broken := fast.add(t, "broken", "1.0.0", []byte("broken"))
+	fast.serve("/broken@1.0.0.zip", []byte("corrupted"))
+
+	r := newTestResolver(t)
+
+	resolved, err := r.Resolve(dependencySet(first, second, broken))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	paths, err := r.Download(resolved)
+	elapsed := time.Since(start)
+
+	if !errors.Is(err, ErrChecksumMismatch) || !strings.Contains(err.Error(), broken.Uri) {
+		t.Fatalf("expected the checksum mismatch of %s to be reported, got %v", broken.Uri, err)
+	}
+
+	if strings.Contains(err.Error(), first.Uri) || strings.Contains(err.Error(), second.Uri) {
+		t.Errorf("expected only the failing package to be reported, got %v", err)
+	}
+
+	if elapsed >= slow.archiveDelay {
+		t.Errorf("expected the downloads in flight to be cancelled, Download took %s", elapsed)
+	}
+
+	if paths != nil {
+		t.Errorf("expected no paths, got %v", paths)
+	}
+
+	for _, dep := range []Dependency{first, second} {
+		if exists, err := r.Exists(resolved[dep.Uri]); err != nil || exists {
+			t.Errorf("expected the cancelled download of %s not to be cached, got %v", dep.Uri, err)
+		}
+	}
+}
+
+func TestMetadataAndArchiveTimeouts(t *testing.T) {
+	reg := newTestRegistry(t)
+	lib := reg.add(t, "lib", "1.0.0", []byte("lib"))
+
+	configure := func(metadataTimeout time.Duration, archiveTimeout time.Duration) func(config *AppConfig) {
+		return func(config *AppConfig) {
+			config.MetadataTimeout = metadataTimeout
+			config.ArchiveTimeout = archiveTimeout
+		}
+	}
+
+	reg.archiveDelay = 200 * time.Millisecond
+
+	r := newTestResolver(t, configure(50*time.Millisecond, 5*time.Second))
+
+	resolved, err := r.Resolve(dependencySet(lib))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Download(resolved); err != nil {
+		t.Errorf("expected a slow archive not to be bound by the metadata timeout, got %s", err)
+	}
+
+	r = newTestResolver(t, configure(5*time.Second, 50*time.Millisecond))
+
+	if _, err := r.Download(resolved); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the archive timeout to expire, got %v", err)
+	}
+
+	reg.mu.Lock()
+	reg.archiveDelay = 0
+	reg.metadataDelay = 200 * time.Millisecond
+	reg.mu.Unlock()
+
+	if _, err := newTestResolver(t, configure(5*time.Second, 50*time.Millisecond)).Resolve(dependencySet(lib)); err != nil {
+		t.Errorf("expected slow metadata not to be bound by the archive timeout, got %s", err)
+	}
+
+	if _, err := newTestResolver(t, configure(50*time.Millisecond, 5*time.Second)).Resolve(dependencySet(lib)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the metadata timeout to expire, got %v", err)
+	}
+}
+
+func TestResolveWithSharedMetadataStore(t *testing.T) {
+	reg := newTestRegistry(t)
+	leaf := reg.add(t, "leaf", "1.0.0", []byte("leaf"))
+	root := reg.add(t, "root", "1.0.0", []byte("root"), leaf)
+
+	store := NewMetadataStore(2)
+
+	first := newTestResolver(t)
+	WithMetadataStore(store)(first)
+
+	if _, err := first.Resolve(dependencySet(root)); err != nil {
+		t.Fatal(err)
+	}
+
+	second := newTestResolver(t)
+	WithMetadataStore(store)(second)
+
+	resolved, err := second.Resolve(dependencySet(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resolved) != 2 {
+		t.Errorf("expected 2 packages resolved, got %d", len(resolved))
+	}
+
+	for _, path := range []string{"/root@1.0.0", "/leaf@1.0.0"} {
+		if count := reg.requestCount(path); count != 1 {
+			t.Errorf("expected %s to be fetched once across resolvers, got %d requests", path, count)
+		}
+	}
+
+	if stats := second.Stats(); stats.NetworkFetches != 0 || stats.CacheHits != 2 {
+		t.Errorf("expected the second resolver to hit the shared store only, got %+v", stats)
+	}
+
+	other := reg.add(t, "other", "1.0.0", []byte("other"))
+
+	if _, err := second.Resolve(dependencySet(other)); err != nil {
+		t.Fatal(err)
+	}
+
+	if store.Len() != 2 {
+		t.Errorf("expected the store to be bounded to 2 entries, got %d", store.Len())
+	}
+}
+
+func TestSameHostArchives(t *testing.T) {
+	reg := newTestRegistry(t)
+	cdn := newTestRegistry(t)
+
+	reg.publish(t, "/external@1.0.0", Metadata{Name: "external", Version: "1.0.0", PackageZipUrl: cdn.server.URL + "/external@1.0.0.zip"}, nil)
+	reg.publish(t, "/local@1.0.0", Metadata{Name: "local", Version: "1.0.0", PackageZipUrl: "./local@1.0.0.zip"}, []byte("local"))
+
+	tests := []struct {
+		name     string
+		uri      string
+		strict   bool
+		hosts    []string
+		rejected bool
+	}{
+		{name: "lenient", uri: "/external@1.0.0"},
+		{name: "strict external", uri: "/external@1.0.0", strict: true, rejected: true},
+		{name: "strict allowlisted", uri: "/external@1.0.0", strict: true, hosts: []string{cdn.host}},
+		{name: "strict same host", uri: "/local@1.0.0", strict: true, hosts: []string{cdn.host}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newTestResolver(t, func(config *AppConfig) {
+				config.SameHostArchives = test.strict
+				config.ArchiveHosts = test.hosts
+			})
+
+			_, err := r.httpResolver.ResolveMetadata("package://"+reg.host+test.uri, true)
+
+			if test.rejected != errors.Is(err, ErrArchiveHostMismatch) || (!test.rejected && err != nil) {
+				t.Errorf("expected rejected: %v, got %v", test.rejected, err)
+			}
+		})
+	}
+}
+
+func TestMetadataTransform(t *testing.T) {
+	reg := newTestRegistry(t)
+	archive := []byte("lib")
+	sum := sha256.Sum256(archive)
+	path := "/lib@1.0.0"
+	uri := "package://" + reg.host + path
+
+	// the upstream publishes a malformed archive url, the archive is served next to the metadata
+	reg.publish(t, path, Metadata{
+		Name:                "lib",
+		PackageUri:          uri,
+		Version:             "1.0.0",
+		PackageZipUrl:       reg.server.URL + "/broken/lib.zip",
+		PackageZipChecksums: Checksums{Sha256: hex.EncodeToString(sum[:])},
+	}, archive)
+
+	fixed := reg.server.URL + path + ".zip"
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.MetadataTransform = func(m *Metadata) error {
+			if strings.Contains(m.PackageZipUrl, "/broken/") {
+				m.PackageZipUrl = fixed
+				m.Source = bytes.Replace(m.Source, []byte(reg.server.URL+"/broken/lib.zip"), []byte(fixed), 1)
+			}
+			return nil
+		}
+	})
+
+	resolved, err := r.Resolve(dependencySet(Dependency{Uri: uri, Name: "lib"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metadata := resolved[uri]
+	if metadata.PackageZipUrl != fixed {
+		t.Errorf("expected the archive url to be rewritten to %s, got %s", fixed, metadata.PackageZipUrl)
+	}
+
+	sourceSum := sha256.Sum256(metadata.Source)
+	if !bytes.Contains(metadata.Source, []byte(fixed)) || metadata.Checksum != hex.EncodeToString(sourceSum[:]) {
+		t.Errorf("expected the checksum to be computed over the rewritten source, got %s", metadata.Checksum)
+	}
+
+	if _, err := r.Download(resolved); err != nil {
+		t.Fatal(err)
+	}
+
+	if count := reg.requestCount("/broken/lib.zip"); count != 0 {
+		t.Errorf("expected the malformed archive url not to be requested, got %d requests", count)
+	}
+
+	failing := newTestResolver(t, func(config *AppConfig) {
+		config.MetadataTransform = func(m *Metadata) error {
+			return errors.New("rejected")
+		}
+	})
+
+	if _, err := failing.Resolve(dependencySet(Dependency{Uri: uri, Name: "lib"})); err == nil {
+		t.Error("expected the error of the transform to fail the resolution")
+	}
+}
+
+func TestAcceptLanguage(t *testing.T) {
+	reg := newTestRegistry(t)
+	dep := reg.add(t, "lib", "1.0.0", []byte("lib"))
+
+	languages := make(map[string]string)
+	reg.authorize = func(req *http.Request) bool {
+		reg.mu.Lock()
+		defer reg.mu.Unlock()
+		languages[req.URL.Path] = req.Header.Get("Accept-Language")
+		return true
+	}
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.AcceptLanguage = "de-CH, de;q=0.9"
+	})
+
+	resolved, err := r.Resolve(dependencySet(dep))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Download(resolved); err != nil {
+		t.Fatal(err)
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if language := languages["/lib@1.0.0"]; language != "de-CH, de;q=0.9" {
+		t.Errorf("expected the configured Accept-Language on the metadata request, got %q", language)
+	}
+
+	if language := languages["/lib@1.0.0.zip"]; language != "" {
+		t.Errorf("expected no Accept-Language on the archive request, got %q", language)
+	}
+}
@@ -0,0 +1,332 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SBOMFormat is the standard a software bill of materials is written in
+type SBOMFormat int
+
+const (
+	// SBOMCycloneDX is the CycloneDX 1.5 json format
+	SBOMCycloneDX SBOMFormat = iota
+	// SBOMSPDX is the SPDX 2.3 json format
+	SBOMSPDX
+)
+
+// spdxNoAssertion marks SPDX fields whose value is unknown
+const spdxNoAssertion = "NOASSERTION"
+
+type (
+	cyclonedxBom struct {
+		BomFormat    string                `json:"bomFormat"`
+		SpecVersion  string                `json:"specVersion"`
+		Version      int                   `json:"version"`
+		Metadata     cyclonedxMetadata     `json:"metadata"`
+		Components   []cyclonedxComponent  `json:"components"`
+		Dependencies []cyclonedxDependency `json:"dependencies"`
+	}
+
+	cyclonedxMetadata struct {
+		Timestamp string         `json:"timestamp"`
+		Tools     cyclonedxTools `json:"tools"`
+	}
+
+	cyclonedxTools struct {
+		Components []cyclonedxComponent `json:"components"`
+	}
+
+	cyclonedxComponent struct {
+		Type     string             `json:"type"`
+		BomRef   string             `json:"bom-ref,omitempty"`
+		Name     string             `json:"name"`
+		Version  string             `json:"version,omitempty"`
+		Author   string             `json:"author,omitempty"`
+		Purl     string             `json:"purl,omitempty"`
+		Hashes   []cyclonedxHash    `json:"hashes,omitempty"`
+		Licenses []cyclonedxLicense `json:"licenses,omitempty"`
+	}
+
+	cyclonedxHash struct {
+		Alg     string `json:"alg"`
+		Content string `json:"content"`
+	}
+
+	cyclonedxLicense struct {
+		License struct {
+			Name string `json:"name"`
+		} `json:"license"`
+	}
+
+	cyclonedxDependency struct {
+		Ref       string   `json:"ref"`
+		DependsOn []string `json:"dependsOn"`
+	}
+
+	spdxDocument struct {
+		SpdxVersion       string             `json:"spdxVersion"`
+		DataLicense       string             `json:"dataLicense"`
+		SPDXID            string             `json:"SPDXID"`
+		Name              string             `json:"name"`
+		DocumentNamespace string             `json:"documentNamespace"`
+		CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+		Packages          []spdxPackage      `json:"packages"`
+		Relationships     []spdxRelationship `json:"relationships"`
+	}
+
+	spdxCreationInfo struct {
+		Created  string   `json:"created"`
+		Creators []string `json:"creators"`
+	}
+
+	spdxPackage struct {
+		SPDXID           string            `json:"SPDXID"`
+		Name             string            `json:"name"`
+		VersionInfo      string            `json:"versionInfo,omitempty"`
+		DownloadLocation string            `json:"downloadLocation"`
+		FilesAnalyzed    bool              `json:"filesAnalyzed"`
+		Originator       string            `json:"originator,omitempty"`
+		LicenseDeclared  string            `json:"licenseDeclared"`
+		Checksums        []spdxChecksum    `json:"checksums,omitempty"`
+		ExternalRefs     []spdxExternalRef `json:"externalRefs"`
+	}
+
+	spdxChecksum struct {
+		Algorithm     string `json:"algorithm"`
+		ChecksumValue string `json:"checksumValue"`
+	}
+
+	spdxExternalRef struct {
+		ReferenceCategory string `json:"referenceCategory"`
+		ReferenceType     string `json:"referenceType"`
+		ReferenceLocator  string `json:"referenceLocator"`
+	}
+
+	spdxRelationship struct {
+		SpdxElementId      string `json:"spdxElementId"`
+		RelationshipType   string `json:"relationshipType"`
+		RelatedSpdxElement string `json:"relatedSpdxElement"`
+	}
+
+	// sbomPackage holds the fields of a resolved package common to every SBOM format
+	sbomPackage struct {
+		uri          string
+		metadata     *Metadata
+		purl         string
+		sha256       string
+		sha512       string
+		dependencies []string
+	}
+)
+
+// SBOM describes every package of resolved, which Resolve returned, as a software bill
+// of materials in format. Packages are identified by package uri and by a purl of type
+// pkl, pkg:pkl/host/path/name@version.
+func (r *Resolver) SBOM(resolved map[string]*Metadata, format SBOMFormat) ([]byte, error) {
+	packages := make([]sbomPackage, 0, len(resolved))
+
+	for uri, m := range resolved {
+		pkg := sbomPackage{uri: uri, metadata: m}
+
+		purl, err := packagePurl(uri)
+
+		if err != nil {
+			return nil, err
+		}
+
+		pkg.purl = purl
+
+		if m.PackageZipChecksums.Sha256 != "" {
+			digest, err := DecodeSha256(m.PackageZipChecksums.Sha256)
+
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", uri, err)
+			}
+
+			pkg.sha256 = hex.EncodeToString(digest)
+		}
+
+		if m.PackageZipChecksums.Sha512 != "" {
+			digest, err := DecodeSha512(m.PackageZipChecksums.Sha512)
+
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", uri, err)
+			}
+
+			pkg.sha512 = hex.EncodeToString(digest)
+		}
+
+		for _, dependency := range declaredDependencies(m) {
+			if _, ok := resolved[dependency]; ok {
+				pkg.dependencies = append(pkg.dependencies, dependency)
+			}
+		}
+
+		packages = append(packages, pkg)
+	}
+
+	sort.Slice(packages, func(i, j int) bool {
+		return packages[i].uri < packages[j].uri
+	})
+
+	switch format {
+	case SBOMCycloneDX:
+		return json.MarshalIndent(cyclonedxSBOM(packages), "", "  ")
+	case SBOMSPDX:
+		return json.MarshalIndent(spdxSBOM(packages), "", "  ")
+	default:
+		return nil, fmt.Errorf("unsupported sbom format %d", format)
+	}
+}
+
+func cyclonedxSBOM(packages []sbomPackage) *cyclonedxBom {
+	bom := &cyclonedxBom{
+		BomFormat:   "CycloneDX",
+		SpecVersion: "1.5",
+		Version:     1,
+		Metadata: cyclonedxMetadata{
+			Timestamp: now().UTC().Format(time.RFC3339),
+			Tools:     cyclonedxTools{Components: []cyclonedxComponent{{Type: "application", Name: "hpkl", Version: Version()}}},
+		},
+		Components:   make([]cyclonedxComponent, 0, len(packages)),
+		Dependencies: make([]cyclonedxDependency, 0, len(packages)),
+	}
+
+	for _, pkg := range packages {
+		component := cyclonedxComponent{
+			Type:    "library",
+			BomRef:  pkg.uri,
+			Name:    pkg.metadata.Name,
+			Version: pkg.metadata.Version,
+			Author:  strings.Join(pkg.metadata.Authors, ", "),
+			Purl:    pkg.purl,
+		}
+
+		if pkg.sha256 != "" {
+			component.Hashes = append(component.Hashes, cyclonedxHash{Alg: "SHA-256", Content: pkg.sha256})
+		}
+
+		if pkg.sha512 != "" {
+			component.Hashes = append(component.Hashes, cyclonedxHash{Alg: "SHA-512", Content: pkg.sha512})
+		}
+
+		if pkg.metadata.License != "" {
+			var license cyclonedxLicense
+			license.License.Name = pkg.metadata.License
+			component.Licenses = []cyclonedxLicense{license}
+		}
+
+		dependsOn := pkg.dependencies
+		if dependsOn == nil {
+			dependsOn = []string{}
+		}
+
+		bom.Components = append(bom.Components, component)
+		bom.Dependencies = append(bom.Dependencies, cyclonedxDependency{Ref: pkg.uri, DependsOn: dependsOn})
+	}
+
+	return bom
+}
+
+func spdxSBOM(packages []sbomPackage) *spdxDocument {
+	// the namespace is unique to the resolved set, so the same set always gets the same one
+	hasher := sha256.New()
+	for _, pkg := range packages {
+		hasher.Write([]byte(pkg.uri))
+		hasher.Write([]byte{0})
+	}
+
+	doc := &spdxDocument{
+		SpdxVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              "hpkl-dependencies",
+		DocumentNamespace: "https://hpkl.io/spdx/" + hex.EncodeToString(hasher.Sum(nil)),
+		CreationInfo: spdxCreationInfo{
+			Created:  now().UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: hpkl-" + Version()},
+		},
+		Packages:      make([]spdxPackage, 0, len(packages)),
+		Relationships: make([]spdxRelationship, 0, len(packages)),
+	}
+
+	ids := make(map[string]string, len(packages))
+	for i, pkg := range packages {
+		ids[pkg.uri] = fmt.Sprintf("SPDXRef-Package-%d", i+1)
+	}
+
+	for _, pkg := range packages {
+		spdx := spdxPackage{
+			SPDXID:           ids[pkg.uri],
+			Name:             pkg.metadata.Name,
+			VersionInfo:      pkg.metadata.Version,
+			DownloadLocation: spdxNoAssertion,
+			LicenseDeclared:  spdxNoAssertion,
+			ExternalRefs:     []spdxExternalRef{{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: pkg.purl}},
+		}
+
+		if pkg.metadata.PackageZipUrl != "" {
+			spdx.DownloadLocation = pkg.metadata.PackageZipUrl
+		}
+
+		if pkg.metadata.License != "" {
+			spdx.LicenseDeclared = pkg.metadata.License
+		}
+
+		if len(pkg.metadata.Authors) > 0 {
+			spdx.Originator = "Person: " + strings.Join(pkg.metadata.Authors, ", ")
+		}
+
+		if pkg.sha256 != "" {
+			spdx.Checksums = append(spdx.Checksums, spdxChecksum{Algorithm: "SHA256", ChecksumValue: pkg.sha256})
+		}
+
+		if pkg.sha512 != "" {
+			spdx.Checksums = append(spdx.Checksums, spdxChecksum{Algorithm: "SHA512", ChecksumValue: pkg.sha512})
+		}
+
+		doc.Packages = append(doc.Packages, spdx)
+		doc.Relationships = append(doc.Relationships, spdxRelationship{SpdxElementId: doc.SPDXID, RelationshipType: "DESCRIBES", RelatedSpdxElement: spdx.SPDXID})
+
+		for _, dependency := range pkg.dependencies {
+			doc.Relationships = append(doc.Relationships, spdxRelationship{SpdxElementId: spdx.SPDXID, RelationshipType: "DEPENDS_ON", RelatedSpdxElement: ids[dependency]})
+		}
+	}
+
+	return doc
+}
+
+// packagePurl converts package://host/path/name@version into pkg:pkl/host/path/name@version
+func packagePurl(uri string) (string, error) {
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return "", err
+	}
+
+	path, version, found := strings.Cut(strings.TrimPrefix(u.Path, "/"), "@")
+
+	if !found || u.Host == "" || path == "" {
+		return "", fmt.Errorf("invalid package uri %s", uri)
+	}
+
+	segments := append([]string{u.Host}, strings.Split(path, "/")...)
+	for i, segment := range segments {
+		segments[i] = purlEscape(segment)
+	}
+
+	return fmt.Sprintf("pkg:pkl/%s@%s", strings.Join(segments, "/"), purlEscape(version)), nil
+}
+
+// purlEscape percent-encodes the characters of a purl component that are not unreserved,
+// like the port separator of hosts and the + of build metadata
+func purlEscape(component string) string {
+	return strings.ReplaceAll(url.QueryEscape(component), "+", "%20")
+}
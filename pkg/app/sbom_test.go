@@ -0,0 +1,179 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+)
+
+func sbomFixture() map[string]*Metadata {
+	leafSum := sha256.Sum256([]byte("leaf"))
+	rootSum := sha256.Sum256([]byte("root"))
+
+	leaf := &Metadata{
+		Name:                "leaf",
+		PackageUri:          "package://localhost:5000/org/leaf@1.0.0+build.1",
+		Version:             "1.0.0+build.1",
+		PackageZipUrl:       "https://localhost:5000/org/leaf@1.0.0.zip",
+		PackageZipChecksums: Checksums{Sha256: "sha256:" + hex.EncodeToString(leafSum[:])},
+		Authors:             []string{"Jane Doe"},
+		License:             "Apache-2.0",
+	}
+
+	root := &Metadata{
+		Name:                "root",
+		PackageUri:          "package://example.com/root@2.0.0",
+		Version:             "2.0.0",
+		PackageZipChecksums: Checksums{Sha256: hex.EncodeToString(rootSum[:])},
+		Dependencies:        map[string]Dependency{"leaf": {Uri: leaf.PackageUri}},
+	}
+
+	return map[string]*Metadata{leaf.PackageUri: leaf, root.PackageUri: root}
+}
+
+func TestSBOMCycloneDX(t *testing.T) {
+	now = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+	t.Cleanup(func() { now = time.Now })
+
+	data, err := newTestResolver(t).SBOM(sbomFixture(), SBOMCycloneDX)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var bom cyclonedxBom
+	if err := json.Unmarshal(data, &bom); err != nil {
+		t.Fatal(err)
+	}
+
+	// required properties and enums of the CycloneDX 1.5 schema
+	if bom.BomFormat != "CycloneDX" || bom.SpecVersion != "1.5" || bom.Version < 1 {
+		t.Errorf("unexpected bom header %+v", bom)
+	}
+
+	if bom.Metadata.Timestamp != "2024-05-01T12:00:00Z" {
+		t.Errorf("unexpected timestamp %s", bom.Metadata.Timestamp)
+	}
+
+	hexPattern := regexp.MustCompile(`^[a-f0-9]{64}$`)
+	refs := make(map[string]bool)
+
+	for _, component := range bom.Components {
+		if component.Type != "library" || component.Name == "" || component.BomRef == "" {
+			t.Errorf("component misses required properties: %+v", component)
+		}
+
+		for _, hash := range component.Hashes {
+			if hash.Alg != "SHA-256" || !hexPattern.MatchString(hash.Content) {
+				t.Errorf("invalid hash %+v of %s", hash, component.Name)
+			}
+		}
+
+		refs[component.BomRef] = true
+	}
+
+	// packages are sorted by uri, root on example.com comes first
+	leaf := bom.Components[1]
+	if leaf.Purl != "pkg:pkl/localhost%3A5000/org/leaf@1.0.0%2Bbuild.1" {
+		t.Errorf("unexpected purl %s", leaf.Purl)
+	}
+
+	if leaf.Author != "Jane Doe" || len(leaf.Licenses) != 1 || leaf.Licenses[0].License.Name != "Apache-2.0" {
+		t.Errorf("expected authors and license of %s, got %+v", leaf.Name, leaf)
+	}
+
+	for _, dependency := range bom.Dependencies {
+		if !refs[dependency.Ref] {
+			t.Errorf("dependency references unknown component %s", dependency.Ref)
+		}
+
+		for _, ref := range dependency.DependsOn {
+			if !refs[ref] {
+				t.Errorf("%s depends on unknown component %s", dependency.Ref, ref)
+			}
+		}
+	}
+
+	if root := bom.Dependencies[0]; !slices.Equal(root.DependsOn, []string{leaf.BomRef}) {
+		t.Errorf("expected root to depend on leaf, got %+v", root)
+	}
+}
+
+func TestSBOMSPDX(t *testing.T) {
+	now = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+	t.Cleanup(func() { now = time.Now })
+
+	r := newTestResolver(t)
+
+	data, err := r.SBOM(sbomFixture(), SBOMSPDX)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc spdxDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	// required properties and patterns of the SPDX 2.3 schema
+	if doc.SpdxVersion != "SPDX-2.3" || doc.DataLicense != "CC0-1.0" || doc.SPDXID != "SPDXRef-DOCUMENT" || doc.Name == "" {
+		t.Errorf("unexpected document header %+v", doc)
+	}
+
+	if doc.CreationInfo.Created != "2024-05-01T12:00:00Z" || len(doc.CreationInfo.Creators) == 0 {
+		t.Errorf("unexpected creation info %+v", doc.CreationInfo)
+	}
+
+	idPattern := regexp.MustCompile(`^SPDXRef-[a-zA-Z0-9.-]+$`)
+	ids := map[string]bool{doc.SPDXID: true}
+
+	for _, pkg := range doc.Packages {
+		if !idPattern.MatchString(pkg.SPDXID) || pkg.Name == "" || pkg.DownloadLocation == "" || pkg.LicenseDeclared == "" {
+			t.Errorf("package misses required properties: %+v", pkg)
+		}
+
+		for _, checksum := range pkg.Checksums {
+			if checksum.Algorithm != "SHA256" || len(checksum.ChecksumValue) != 64 {
+				t.Errorf("invalid checksum %+v of %s", checksum, pkg.Name)
+			}
+		}
+
+		if len(pkg.ExternalRefs) != 1 || pkg.ExternalRefs[0].ReferenceType != "purl" {
+			t.Errorf("expected a purl reference for %s, got %+v", pkg.Name, pkg.ExternalRefs)
+		}
+
+		ids[pkg.SPDXID] = true
+	}
+
+	leaf := doc.Packages[1]
+	if leaf.Originator != "Person: Jane Doe" || leaf.LicenseDeclared != "Apache-2.0" || leaf.DownloadLocation != "https://localhost:5000/org/leaf@1.0.0.zip" {
+		t.Errorf("unexpected leaf package %+v", leaf)
+	}
+
+	if root := doc.Packages[0]; root.DownloadLocation != spdxNoAssertion || root.LicenseDeclared != spdxNoAssertion {
+		t.Errorf("expected unknown fields of root to be NOASSERTION, got %+v", root)
+	}
+
+	expected := spdxRelationship{SpdxElementId: doc.Packages[0].SPDXID, RelationshipType: "DEPENDS_ON", RelatedSpdxElement: leaf.SPDXID}
+	if !slices.Contains(doc.Relationships, expected) {
+		t.Errorf("expected %+v in %+v", expected, doc.Relationships)
+	}
+
+	for _, relationship := range doc.Relationships {
+		if !ids[relationship.SpdxElementId] || !ids[relationship.RelatedSpdxElement] {
+			t.Errorf("relationship references unknown elements: %+v", relationship)
+		}
+	}
+
+	again, err := r.SBOM(sbomFixture(), SBOMSPDX)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(again) != string(data) {
+		t.Error("expected the same resolved set to produce the same document")
+	}
+}
@@ -0,0 +1,232 @@
+package app
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"hpkl.io/hpkl/pkg/pklutils"
+	"hpkl.io/hpkl/pkg/registry"
+)
+
+type SignatureMode int
+
+const (
+	// SignatureOff skips signature verification
+	SignatureOff SignatureMode = iota
+	// SignatureVerify verifies signatures when a package provides one
+	SignatureVerify
+	// SignatureEnforce requires a valid signature for every package
+	SignatureEnforce
+)
+
+var errSignatureMissing = errors.New("no signature found")
+
+// errSignatureUnsupported is returned for the resolver types not serving signatures
+var errSignatureUnsupported = errors.New("unsupported")
+
+// trustStore holds the public keys package signatures are verified against
+type trustStore struct {
+	pgp    openpgp.EntityList
+	cosign []*ecdsa.PublicKey
+}
+
+// loadTrustStore reads armored OpenPGP public keys and PEM encoded cosign public keys
+func loadTrustStore(paths []string) (*trustStore, error) {
+	store := &trustStore{}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if bytes.Contains(data, []byte("BEGIN PGP PUBLIC KEY BLOCK")) {
+			entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted key %s: %w", path, err)
+			}
+
+			store.pgp = append(store.pgp, entities...)
+			continue
+		}
+
+		block, _ := pem.Decode(data)
+
+		if block == nil {
+			return nil, fmt.Errorf("invalid trusted key %s: neither an OpenPGP nor a PEM public key", path)
+		}
+
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted key %s: %w", path, err)
+		}
+
+		ecdsaKey, ok := key.(*ecdsa.PublicKey)
+
+		if !ok {
+			return nil, fmt.Errorf("invalid trusted key %s: cosign keys must be ECDSA", path)
+		}
+
+		store.cosign = append(store.cosign, ecdsaKey)
+	}
+
+	if len(store.pgp) == 0 && len(store.cosign) == 0 {
+		return nil, errors.New("signature verification requires at least one trusted key")
+	}
+
+	return store, nil
+}
+
+// verifySignature checks the archive signature of m according to the configured SignatureMode
+func (r *Resolver) verifySignature(m *Metadata, archive []byte) error {
+	if r.config.SignatureMode == SignatureOff {
+		return nil
+	}
+
+	var err error
+	switch m.ResolverType {
+	case OCI:
+		err = r.verifyCosign(m)
+	case HTTP:
+		err = r.verifyPgp(m, archive)
+	default:
+		err = fmt.Errorf("%w for %s packages", errSignatureUnsupported, lockedResolvers[m.ResolverType])
+	}
+
+	if r.config.SignatureMode != SignatureEnforce {
+		if errors.Is(err, errSignatureMissing) {
+			r.config.Logger.Error("No signature found for %s, skipping verification", m.PackageUri)
+			return nil
+		}
+
+		if errors.Is(err, errSignatureUnsupported) {
+			r.config.Logger.Error("Signatures are %s, skipping verification of %s", err, m.PackageUri)
+			return nil
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("signature verification of %s failed: %w", m.PackageUri, err)
+	}
+
+	return nil
+}
+
+func (r *Resolver) verifyPgp(m *Metadata, archive []byte) error {
+	signature, err := r.httpResolver.ResolveSignature(m)
+
+	if err != nil {
+		return err
+	}
+
+	if bytes.Contains(signature, []byte("BEGIN PGP SIGNATURE")) {
+		_, err = openpgp.CheckArmoredDetachedSignature(r.trust.pgp, bytes.NewReader(archive), bytes.NewReader(signature), nil)
+	} else {
+		_, err = openpgp.CheckDetachedSignature(r.trust.pgp, bytes.NewReader(archive), bytes.NewReader(signature), nil)
+	}
+
+	return err
+}
+
+func (r *Resolver) verifyCosign(m *Metadata) error {
+	signatures, err := r.ociResolver.ResolveSignatures(m)
+
+	if err != nil {
+		return err
+	}
+
+	for _, signature := range signatures {
+		sig, err := base64.StdEncoding.DecodeString(signature.Signature)
+
+		if err != nil {
+			continue
+		}
+
+		var payload struct {
+			Critical struct {
+				Image struct {
+					DockerManifestDigest string `json:"docker-manifest-digest"`
+				} `json:"image"`
+			} `json:"critical"`
+		}
+
+		if err := json.Unmarshal(signature.Payload, &payload); err != nil {
+			continue
+		}
+
+		if payload.Critical.Image.DockerManifestDigest != m.ManifestDigest {
+			continue
+		}
+
+		digest := sha256.Sum256(signature.Payload)
+
+		for _, key := range r.trust.cosign {
+			if ecdsa.VerifyASN1(key, digest[:], sig) {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("no signature of %s matches a trusted key", m.ManifestDigest)
+}
+
+// ResolveSignature fetches the detached signature published next to the package archive
+func (r *HttpResolver) ResolveSignature(metadata *Metadata) ([]byte, error) {
+	resp, err := r.client.Get(metadata.PackageZipUrl + ".sig")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errSignatureMissing
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Http get Error status: %s", resp.Status)
+	}
+
+	var signature bytes.Buffer
+	if _, err := signature.ReadFrom(resp.Body); err != nil {
+		return nil, err
+	}
+
+	return signature.Bytes(), nil
+}
+
+// ResolveSignatures fetches the cosign signatures of the package manifest
+func (r *OciResolver) ResolveSignatures(metadata *Metadata) ([]registry.CosignSignature, error) {
+	ref, err := pklutils.PklUriToRef(metadata.registryUri())
+
+	if err != nil {
+		return nil, err
+	}
+
+	client := r.client
+	if metadata.PlainHttp {
+		client = r.plainClient
+	}
+
+	signatures, err := client.PullCosignSignatures(ref, metadata.ManifestDigest)
+
+	if errors.Is(err, registry.ErrSignatureNotFound) {
+		return nil, errSignatureMissing
+	}
+
+	return signatures, err
+}
@@ -0,0 +1,124 @@
+package app
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+// newTestSigner creates an OpenPGP key and stores its armored public key in a temp file
+func newTestSigner(t *testing.T) (*openpgp.Entity, string) {
+	entity, err := openpgp.NewEntity("hpkl", "test", "test@hpkl.io", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var public bytes.Buffer
+	w, err := armor.Encode(&public, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	path := filepath.Join(t.TempDir(), "trusted.asc")
+	if err := os.WriteFile(path, public.Bytes(), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	return entity, path
+}
+
+func sign(t *testing.T, signer *openpgp.Entity, data []byte) []byte {
+	var signature bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&signature, signer, bytes.NewReader(data), nil); err != nil {
+		t.Fatal(err)
+	}
+	return signature.Bytes()
+}
+
+func TestDownloadVerifiesSignatures(t *testing.T) {
+	signer, trustedKey := newTestSigner(t)
+	reg := newTestRegistry(t)
+
+	archive := []byte("signed archive")
+	signed := reg.add(t, "signed", "1.0.0", archive)
+	reg.serve("/signed@1.0.0.zip.sig", sign(t, signer, archive))
+
+	tampered := reg.add(t, "tampered", "1.0.0", []byte("tampered archive"))
+	reg.serve("/tampered@1.0.0.zip.sig", sign(t, signer, archive))
+
+	unsigned := reg.add(t, "unsigned", "1.0.0", []byte("unsigned archive"))
+
+	tests := []struct {
+		name    string
+		dep     Dependency
+		mode    SignatureMode
+		success bool
+	}{
+		{"valid signature", signed, SignatureEnforce, true},
+		{"tampered archive", tampered, SignatureVerify, false},
+		{"missing signature enforced", unsigned, SignatureEnforce, false},
+		{"missing signature verified", unsigned, SignatureVerify, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestResolver(t, func(config *AppConfig) {
+				config.SignatureMode = tt.mode
+				config.TrustedKeys = []string{trustedKey}
+			})
+
+			resolved, err := r.Resolve(dependencySet(tt.dep))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = r.Download(resolved)
+			if tt.success && err != nil {
+				t.Errorf("expected download to succeed, got %s", err)
+			}
+			if !tt.success && err == nil {
+				t.Error("expected signature verification to fail")
+			}
+		})
+	}
+}
+
+func TestSignatureUnsupportedResolver(t *testing.T) {
+	_, trustedKey := newTestSigner(t)
+	m := &Metadata{PackageUri: "package://github.com/org/repo@1.0.0", ResolverType: GITHUB}
+
+	for _, mode := range []SignatureMode{SignatureVerify, SignatureEnforce} {
+		r := newTestResolver(t, func(config *AppConfig) {
+			config.SignatureMode = mode
+			config.TrustedKeys = []string{trustedKey}
+		})
+
+		err := r.verifySignature(m, []byte("archive"))
+
+		if mode == SignatureVerify && err != nil {
+			t.Errorf("expected unsupported signatures to be skipped, got %v", err)
+		}
+
+		if mode == SignatureEnforce && (err == nil || !strings.Contains(err.Error(), "unsupported for github packages")) {
+			t.Errorf("expected unsupported signatures to be reported, got %v", err)
+		}
+	}
+}
+
+func TestNewResolverRequiresTrustedKeys(t *testing.T) {
+	config := newTestResolver(t).config
+	config.SignatureMode = SignatureEnforce
+
+	if _, err := NewResolver(config); err == nil {
+		t.Error("expected an error without trusted keys")
+	}
+}
@@ -0,0 +1,50 @@
+package app
+
+import "sync/atomic"
+
+type (
+	// ResolverStats are the counters of a Resolver since it was created or last reset
+	ResolverStats struct {
+		// CacheHits counts metadata and archives served from the memory or disk cache
+		CacheHits int64
+		// NetworkFetches counts metadata and archives fetched from a registry
+		NetworkFetches int64
+		// BytesDownloaded is the size of the metadata and archives fetched from registries
+		BytesDownloaded int64
+		// Errors counts failed metadata resolutions and archive downloads
+		Errors int64
+	}
+
+	// resolverCounters are updated concurrently by resolutions and downloads, they are
+	// shared with the resolvers scoped by ResolveContext and DownloadContext
+	resolverCounters struct {
+		cacheHits       atomic.Int64
+		networkFetches  atomic.Int64
+		bytesDownloaded atomic.Int64
+		errors          atomic.Int64
+	}
+)
+
+// Stats returns a snapshot of the resolver counters
+func (r *Resolver) Stats() ResolverStats {
+	return ResolverStats{
+		CacheHits:       r.stats.cacheHits.Load(),
+		NetworkFetches:  r.stats.networkFetches.Load(),
+		BytesDownloaded: r.stats.bytesDownloaded.Load(),
+		Errors:          r.stats.errors.Load(),
+	}
+}
+
+// ResetStats sets every resolver counter back to zero
+func (r *Resolver) ResetStats() {
+	r.stats.cacheHits.Store(0)
+	r.stats.networkFetches.Store(0)
+	r.stats.bytesDownloaded.Store(0)
+	r.stats.errors.Store(0)
+}
+
+// fetched records a successful fetch of size bytes from a registry
+func (c *resolverCounters) fetched(size int) {
+	c.networkFetches.Add(1)
+	c.bytesDownloaded.Add(int64(size))
+}
@@ -0,0 +1,52 @@
+package app
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestResolverStats(t *testing.T) {
+	reg := newTestRegistry(t)
+	leaf := reg.add(t, "leaf", "1.0.0", []byte("leaf archive"))
+	root := reg.add(t, "root", "1.0.0", []byte("root archive"), leaf)
+
+	r := newTestResolver(t)
+
+	resolved, err := r.Resolve(dependencySet(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Resolve(dependencySet(root)); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := r.Download(resolved); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	missing := Dependency{Uri: fmt.Sprintf("package://%s/missing@1.0.0", reg.host), Name: "missing"}
+	if _, err := r.Resolve(dependencySet(missing)); err == nil {
+		t.Fatal("expected resolving a missing package to fail")
+	}
+
+	var bytes int64
+	for _, m := range resolved {
+		bytes += int64(len(m.Source))
+	}
+	bytes += int64(len("leaf archive") + len("root archive"))
+
+	expected := ResolverStats{CacheHits: 4, NetworkFetches: 4, BytesDownloaded: bytes, Errors: 1}
+
+	if stats := r.Stats(); stats != expected {
+		t.Errorf("expected %+v, got %+v", expected, stats)
+	}
+
+	r.ResetStats()
+
+	if stats := r.Stats(); stats != (ResolverStats{}) {
+		t.Errorf("expected counters to be reset, got %+v", stats)
+	}
+}
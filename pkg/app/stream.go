@@ -0,0 +1,67 @@
+package app
+
+// ResolveAndDownload resolves dependencies and downloads the archives of the packages
+// Deduplicate keeps with mode, like Resolve, Deduplicate and Download in turn, except
+// the download of each archive starts as soon as its metadata is resolved. A download
+// superseded by a version resolved later is cancelled, and removed from the cache when
+// it completed, so the cache ends up as it would with the separate passes.
+func (r *Resolver) ResolveAndDownload(dependencies map[string]Dependency, mode DedupMode) (map[string]*Metadata, map[string]string, error) {
+	if r.config.MetadataOnly {
+		return nil, nil, ErrMetadataOnly
+	}
+
+	resolved := make(map[string]*Metadata)
+	kept := make(map[string]*Metadata)
+	pool := r.newDownloadPool()
+
+	err := r.walk(dependencies, false, func(uri string, metadata *Metadata, _ ResolutionSource) error {
+		resolved[uri] = metadata
+
+		if mode == DedupNone {
+			pool.schedule(metadata.PackageUri, metadata)
+			return nil
+		}
+
+		key, err := r.MajorVersionPackage(metadata)
+
+		if err != nil {
+			return err
+		}
+
+		if exists, ok := kept[key]; ok {
+			supersedes, err := r.supersedes(metadata, exists)
+
+			if err != nil || !supersedes {
+				return err
+			}
+
+			r.config.Logger.Info("Cancelling the download of %s superseded by %s", exists.PackageUri, metadata.PackageUri)
+			pool.withdraw(exists.PackageUri, exists)
+		}
+
+		kept[key] = metadata
+		pool.schedule(metadata.PackageUri, metadata)
+
+		return nil
+	})
+
+	if err != nil {
+		pool.cancel()
+		pool.wait()
+		return nil, nil, err
+	}
+
+	paths, err := pool.wait()
+
+	if err != nil && !r.config.ContinueOnError {
+		return nil, nil, err
+	}
+
+	deduplicated, dedupErr := r.Deduplicate(resolved, mode)
+
+	if dedupErr != nil {
+		return nil, nil, dedupErr
+	}
+
+	return deduplicated, paths, err
+}
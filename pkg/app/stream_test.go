@@ -0,0 +1,72 @@
+package app
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestResolveAndDownloadMatchesTwoPasses(t *testing.T) {
+	reg := newTestRegistry(t)
+	older := reg.add(t, "lib", "1.0.0", []byte("lib 1.0.0"))
+	newer := reg.add(t, "lib", "1.1.0", []byte("lib 1.1.0"))
+	major := reg.add(t, "lib", "2.0.0", []byte("lib 2.0.0"))
+	app := reg.add(t, "app", "1.0.0", []byte("app"), older)
+	tool := reg.add(t, "tool", "1.0.0", []byte("tool"), newer)
+
+	dependencies := dependencySet(app, tool, major)
+
+	keys := func(m map[string]string) []string {
+		var result []string
+		for key := range m {
+			result = append(result, key)
+		}
+		sort.Strings(result)
+		return result
+	}
+
+	twoPass := newTestResolver(t)
+
+	resolved, err := twoPass.Resolve(dependencies)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deduplicated, err := twoPass.Deduplicate(resolved, DedupHighestVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := twoPass.Download(deduplicated)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the walk order varies between runs, so the older version is sometimes resolved first
+	for i := 0; i < 5; i++ {
+		streaming := newTestResolver(t)
+
+		metadata, paths, err := streaming.ResolveAndDownload(dependencies, DedupHighestVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(keys(expected), keys(paths)); diff != "" {
+			t.Errorf("unexpected downloaded packages (-expected +actual):\n%s", diff)
+		}
+
+		if len(metadata) != len(deduplicated) {
+			t.Errorf("expected %d packages to be kept, got %d", len(deduplicated), len(metadata))
+		}
+
+		diffs, err := DiffCaches(twoPass.config.CacheDir, streaming.config.CacheDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(diffs) != 0 {
+			t.Errorf("expected the same cache as the two passes, got %+v", diffs)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package app
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+type (
+	// TarballResolver serves metadata and archives from a tarball of a whole registry,
+	// configured by AppConfig.RegistryTarball, without any network access. Every
+	// name.json entry holding package metadata is indexed by its packageUri, with
+	// the name.zip entry of the same directory as archive.
+	TarballResolver struct {
+		config *AppConfig
+		// packages reads the tarball once, it is shared with the resolvers scoped by ResolveContext
+		packages func() (map[string]tarballPackage, error)
+	}
+
+	tarballPackage struct {
+		metadata []byte
+		archive  []byte
+	}
+)
+
+func NewTarballResolver(appConfig *AppConfig) *TarballResolver {
+	return &TarballResolver{
+		config: appConfig,
+		packages: sync.OnceValues(func() (map[string]tarballPackage, error) {
+			return readRegistryTarball(appConfig.RegistryTarball)
+		}),
+	}
+}
+
+func (r *TarballResolver) ResolveMetadata(uri string, plainHttp bool) (*Metadata, error) {
+	pkg, err := r.lookup(uri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := decodeMetadata(pkg.metadata, r.config.StrictMetadata)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(pkg.metadata)
+
+	metadata.ResolverType = TARBALL
+	metadata.Source = pkg.metadata
+	metadata.Checksum = hex.EncodeToString(sum[:])
+
+	return metadata, nil
+}
+
+func (r *TarballResolver) ResolveArchive(metadata *Metadata) ([]byte, error) {
+	pkg, err := r.lookup(metadata.registryUri())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if pkg.archive == nil {
+		return nil, fmt.Errorf("registry tarball %s has no archive for %s", r.config.RegistryTarball, metadata.PackageUri)
+	}
+
+	return pkg.archive, nil
+}
+
+func (r *TarballResolver) lookup(uri string) (tarballPackage, error) {
+	packages, err := r.packages()
+
+	if err != nil {
+		return tarballPackage{}, err
+	}
+
+	pkg, ok := packages[uri]
+
+	if !ok {
+		return tarballPackage{}, fmt.Errorf("%w: %s in registry tarball %s", ErrPackageNotFound, uri, r.config.RegistryTarball)
+	}
+
+	return pkg, nil
+}
+
+// readRegistryTarball indexes the packages of a tar file, optionally gzip compressed
+func readRegistryTarball(tarball string) (map[string]tarballPackage, error) {
+	file, err := os.Open(tarball)
+
+	if err != nil {
+		return nil, fmt.Errorf("registry tarball: %w", err)
+	}
+
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var stream io.Reader = reader
+
+	if magic, err := reader.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(reader)
+
+		if err != nil {
+			return nil, fmt.Errorf("registry tarball %s: %w", tarball, err)
+		}
+
+		defer gz.Close()
+		stream = gz
+	}
+
+	entries := make(map[string][]byte)
+	archive := tar.NewReader(stream)
+
+	for {
+		header, err := archive.Next()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("registry tarball %s: %w", tarball, err)
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		data, err := io.ReadAll(archive)
+
+		if err != nil {
+			return nil, fmt.Errorf("registry tarball %s: %w", tarball, err)
+		}
+
+		entries[path.Clean(strings.TrimPrefix(header.Name, "./"))] = data
+	}
+
+	packages := make(map[string]tarballPackage)
+
+	for name, data := range entries {
+		if path.Ext(name) != ".json" {
+			continue
+		}
+
+		var header struct {
+			PackageUri string `json:"packageUri"`
+		}
+
+		if err := json.Unmarshal(data, &header); err != nil || header.PackageUri == "" {
+			continue
+		}
+
+		packages[header.PackageUri] = tarballPackage{
+			metadata: data,
+			archive:  entries[strings.TrimSuffix(name, ".json")+".zip"],
+		}
+	}
+
+	return packages, nil
+}
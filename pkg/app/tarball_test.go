@@ -0,0 +1,131 @@
+package app
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeRegistryTarball writes packages, metadata with their archive, as a gzipped
+// tarball laid out like the cache directory
+func writeRegistryTarball(t *testing.T, packages map[*Metadata][]byte) string {
+	tarball := filepath.Join(t.TempDir(), "registry.tar.gz")
+
+	file, err := os.Create(tarball)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+
+	for metadata, archive := range packages {
+		data, err := json.Marshal(metadata)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dir := strings.TrimPrefix(metadata.PackageUri, "package://")
+		name := filepath.Base(dir)
+
+		for entry, content := range map[string][]byte{dir + "/" + name + ".json": data, dir + "/" + name + ".zip": archive} {
+			if err := tw.WriteHeader(&tar.Header{Name: entry, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := tw.Write(content); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return tarball
+}
+
+func tarballMetadata(name string, archive []byte, deps ...Dependency) *Metadata {
+	sum := sha256.Sum256(archive)
+	uri := "package://registry.invalid/" + name + "@1.0.0"
+
+	metadata := &Metadata{
+		Name:                name,
+		PackageUri:          uri,
+		Version:             "1.0.0",
+		PackageZipUrl:       "https://registry.invalid/" + name + "@1.0.0.zip",
+		PackageZipChecksums: Checksums{Sha256: hex.EncodeToString(sum[:])},
+		Dependencies:        make(map[string]Dependency),
+	}
+
+	for _, dep := range deps {
+		metadata.Dependencies[dep.Name] = Dependency{Uri: dep.Uri}
+	}
+
+	return metadata
+}
+
+func TestResolveFromRegistryTarball(t *testing.T) {
+	leaf := tarballMetadata("leaf", []byte("leaf"))
+	root := tarballMetadata("root", []byte("root"), Dependency{Uri: leaf.PackageUri, Name: "leaf"})
+	other := tarballMetadata("other", []byte("other"))
+	tampered := tarballMetadata("tampered", []byte("original"))
+
+	tarball := writeRegistryTarball(t, map[*Metadata][]byte{
+		leaf:     []byte("leaf"),
+		root:     []byte("root"),
+		other:    []byte("other"),
+		tampered: []byte("tampered"),
+	})
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.RegistryTarball = tarball
+	})
+
+	resolved, err := r.Resolve(dependencySet(
+		Dependency{Uri: root.PackageUri, Name: "root"},
+		Dependency{Uri: other.PackageUri, Name: "other.oci"},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resolved) != 3 {
+		t.Fatalf("expected 3 packages resolved from the tarball, got %v", resolved)
+	}
+
+	paths, err := r.Download(resolved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := os.ReadFile(paths[leaf.PackageUri])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(archive) != "leaf" {
+		t.Errorf("unexpected archive content %q", archive)
+	}
+
+	resolved, err = r.Resolve(dependencySet(Dependency{Uri: tampered.PackageUri, Name: "tampered"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Download(resolved); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected the archive checksum to be verified, got %v", err)
+	}
+}
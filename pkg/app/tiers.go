@@ -0,0 +1,109 @@
+package app
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// cacheTiers returns the package base paths of AppConfig.CacheTiers, the first writable
+// one being the primary tier downloads are stored in, along with the other tiers in order
+func cacheTiers(appConfig *AppConfig) (string, []string, error) {
+	var (
+		primary string
+		others  []string
+		lastErr error
+	)
+
+	for _, tier := range appConfig.CacheTiers {
+		basePath := filepath.Join(tier, "package-2")
+
+		if primary == "" {
+			if lastErr = checkCacheDir(basePath); lastErr == nil {
+				primary = basePath
+				continue
+			}
+		}
+
+		others = append(others, basePath)
+	}
+
+	if primary == "" {
+		return "", nil, lastErr
+	}
+
+	return primary, others, nil
+}
+
+// tierDir returns the directory of the first secondary cache tier holding the complete
+// package of u, only reading the tiers
+func (r *Resolver) tierDir(u *url.URL) (string, bool) {
+	name := filepath.Base(cacheDir(r.config.CacheNaming, r.basePath, u))
+
+	for _, tier := range r.tiers {
+		dir := cacheDir(r.config.CacheNaming, tier, u)
+
+		if _, err := os.Stat(filepath.Join(dir, name+".json")); err != nil {
+			continue
+		}
+
+		if _, err := os.Stat(filepath.Join(dir, name+".zip")); err != nil {
+			continue
+		}
+
+		return dir, true
+	}
+
+	return "", false
+}
+
+// promote copies the package of u from the first secondary cache tier holding it into
+// the primary one, reporting whether the primary tier holds it. The caller holds the
+// package lock, so that concurrent readers never see a partial copy.
+func (r *Resolver) promote(u *url.URL) bool {
+	primary := cacheDir(r.config.CacheNaming, r.basePath, u)
+
+	if _, err := os.Stat(primary); err == nil {
+		return true
+	}
+
+	dir, ok := r.tierDir(u)
+
+	if !ok {
+		return false
+	}
+
+	name := filepath.Base(primary)
+	metadata, err := os.ReadFile(filepath.Join(dir, name+".json"))
+
+	var archive []byte
+	if err == nil {
+		archive, err = os.ReadFile(filepath.Join(dir, name+".zip"))
+	}
+
+	if err == nil {
+		err = os.MkdirAll(primary, os.ModePerm)
+	}
+
+	if err == nil {
+		err = writeFile(filepath.Join(primary, name+".json"), metadata, os.ModePerm)
+	}
+
+	if err == nil {
+		err = r.storeArchive(filepath.Join(primary, name+".zip"), archive)
+	}
+
+	// the resolver the package was cached with is kept for Repair when recorded
+	if resolver, readErr := os.ReadFile(filepath.Join(dir, name+".resolver")); err == nil && readErr == nil {
+		err = writeFile(filepath.Join(primary, name+".resolver"), resolver, os.ModePerm)
+	}
+
+	if err != nil {
+		r.config.Logger.Error("Promoting %s from the cache tier %s failed: %s", u, dir, err)
+		os.RemoveAll(primary)
+		return false
+	}
+
+	r.config.Logger.Info("Promoted %s from the cache tier %s", u, dir)
+	return true
+}
@@ -0,0 +1,68 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCacheTierPromotion(t *testing.T) {
+	local, shared := t.TempDir(), t.TempDir()
+	seedCache(t, filepath.Join(shared, "package-2"), "example.com", "lib", "1.0.0", []byte("lib"))
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.CacheTiers = []string{local, shared}
+	})
+
+	if r.basePath != filepath.Join(local, "package-2") {
+		t.Fatalf("expected the first tier to be the primary one, got %s", r.basePath)
+	}
+
+	dep := Dependency{Uri: "package://example.com/lib@1.0.0", Name: "lib"}
+
+	resolved, err := r.Resolve(dependencySet(dep))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	promoted := filepath.Join(local, "package-2", "example.com", "lib@1.0.0", "lib@1.0.0.zip")
+
+	if exists, err := r.Exists(resolved[dep.Uri]); err != nil || !exists {
+		t.Fatalf("expected the package of the shared tier to exist, got %v, %v", exists, err)
+	}
+
+	if _, err := os.Stat(filepath.Dir(promoted)); !os.IsNotExist(err) {
+		t.Fatalf("expected resolving to leave the local tier untouched, got %v", err)
+	}
+
+	paths, err := r.Download(resolved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data, err := os.ReadFile(promoted); err != nil || string(data) != "lib" {
+		t.Fatalf("expected the package to be promoted to the local tier, got %q, %v", data, err)
+	}
+
+	if paths[dep.Uri] != promoted {
+		t.Errorf("expected the archive to be served from the local tier, got %s", paths[dep.Uri])
+	}
+}
+
+func TestCacheTiersSkipReadOnly(t *testing.T) {
+	readOnly := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(readOnly, []byte("not a directory"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	writable := t.TempDir()
+
+	primary, others, err := cacheTiers(&AppConfig{CacheTiers: []string{readOnly, writable}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if primary != filepath.Join(writable, "package-2") || len(others) != 1 {
+		t.Errorf("expected downloads to go to the first writable tier, got %s and %v", primary, others)
+	}
+}
@@ -0,0 +1,107 @@
+package app
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// PackageTimings is the time spent on a package by Resolve and Download
+	PackageTimings struct {
+		// Metadata is spent looking up the package metadata, in the caches or the registry
+		Metadata time.Duration
+		// Archive is spent fetching the package archive from the registry
+		Archive time.Duration
+		// Verification is spent verifying the checksums and signature of the archive
+		Verification time.Duration
+	}
+
+	// Timings records PackageTimings by package uri, a Resolver fills it when
+	// created WithTimings
+	Timings struct {
+		mu       sync.Mutex
+		now      func() time.Time
+		packages map[string]*PackageTimings
+	}
+)
+
+func NewTimings() *Timings {
+	return &Timings{now: time.Now, packages: make(map[string]*PackageTimings)}
+}
+
+// WithTimings records the time spent on every package resolved or downloaded into timings
+func WithTimings(timings *Timings) ResolverOption {
+	return func(r *Resolver) {
+		r.timings = timings
+	}
+}
+
+// Packages returns a snapshot of the recorded timings by package uri
+func (t *Timings) Packages() map[string]PackageTimings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := make(map[string]PackageTimings, len(t.packages))
+	for uri, timings := range t.packages {
+		result[uri] = *timings
+	}
+
+	return result
+}
+
+// Get returns the timings recorded for uri
+func (t *Timings) Get(uri string) (PackageTimings, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	timings, ok := t.packages[uri]
+	if !ok {
+		return PackageTimings{}, false
+	}
+
+	return *timings, true
+}
+
+// Reset drops every recorded timing
+func (t *Timings) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	clear(t.packages)
+}
+
+// start returns the current time, a nil Timings records nothing
+func (t *Timings) start() time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+
+	return t.now()
+}
+
+// record adds the time elapsed since start to the duration of uri selected by field
+// and returns the current time, so consecutive steps can be chained
+func (t *Timings) record(uri string, start time.Time, field func(*PackageTimings) *time.Duration) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+
+	end := t.now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	timings, ok := t.packages[uri]
+	if !ok {
+		timings = new(PackageTimings)
+		t.packages[uri] = timings
+	}
+
+	*field(timings) += end.Sub(start)
+
+	return end
+}
+
+func metadataTiming(t *PackageTimings) *time.Duration     { return &t.Metadata }
+func archiveTiming(t *PackageTimings) *time.Duration      { return &t.Archive }
+func verificationTiming(t *PackageTimings) *time.Duration { return &t.Verification }
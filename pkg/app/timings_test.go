@@ -0,0 +1,56 @@
+package app
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestResolverTimings(t *testing.T) {
+	reg := newTestRegistry(t)
+	leaf := reg.add(t, "leaf", "1.0.0", []byte("leaf archive"))
+	root := reg.add(t, "root", "1.0.0", []byte("root archive"), leaf)
+
+	// every reading of the clock advances it by a second
+	var mu sync.Mutex
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	timings := NewTimings()
+	timings.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		clock = clock.Add(time.Second)
+		return clock
+	}
+
+	r := newTestResolver(t, func(config *AppConfig) {
+		config.DownloadConcurrency = 1
+	})
+	WithTimings(timings)(r)
+
+	resolved, err := r.Resolve(dependencySet(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Download(resolved); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]PackageTimings{
+		root.Uri: {Metadata: time.Second, Archive: time.Second, Verification: time.Second},
+		leaf.Uri: {Metadata: time.Second, Archive: time.Second, Verification: time.Second},
+	}
+
+	if diff := cmp.Diff(expected, timings.Packages()); diff != "" {
+		t.Errorf(diff)
+	}
+
+	timings.Reset()
+
+	if _, ok := timings.Get(root.Uri); ok {
+		t.Errorf("expected timings to be reset")
+	}
+}
@@ -0,0 +1,219 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrTokenPrefixesRequired is returned by NewResolver when AppConfig.HttpTokenUrl is set
+// without the AppConfig.HttpTokenPrefixes the token is sent to
+var ErrTokenPrefixesRequired = errors.New("http token prefixes are required with a token url")
+
+// tokenRefreshMargin is how long before its expiry a cached token is refreshed
+const tokenRefreshMargin = 30 * time.Second
+
+type (
+	// tokenSource obtains bearer tokens from an OAuth client credentials endpoint
+	// and caches them until shortly before they expire
+	tokenSource struct {
+		mu           sync.Mutex
+		client       *http.Client
+		tokenUrl     string
+		clientId     string
+		clientSecret string
+		token        string
+		expiresAt    time.Time
+	}
+
+	tokenResponse struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+
+	// tokenTransport attaches the bearer token of source to the requests to the
+	// registries it was issued for and refreshes the token once when they answer 401
+	tokenTransport struct {
+		source    *tokenSource
+		prefixes  []string
+		transport http.RoundTripper
+	}
+)
+
+// checkTokenConfig rejects a token url without the registries its token is issued for,
+// the token endpoint is seldom hosted by the registries themselves
+func checkTokenConfig(appConfig *AppConfig) error {
+	if appConfig.HttpTokenUrl != "" && len(appConfig.HttpTokenPrefixes) == 0 {
+		return fmt.Errorf("%w: set the registries %s issues tokens for", ErrTokenPrefixesRequired, appConfig.HttpTokenUrl)
+	}
+
+	return nil
+}
+
+// newTokenClient wraps the transport of httpClient with a token source configured
+// by the HttpToken* fields of appConfig
+func newTokenClient(appConfig *AppConfig, httpClient *http.Client) *http.Client {
+	transport := httpClient.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	source := &tokenSource{
+		client:       &http.Client{Transport: transport, Timeout: httpClient.Timeout},
+		tokenUrl:     appConfig.HttpTokenUrl,
+		clientId:     appConfig.HttpClientId,
+		clientSecret: appConfig.HttpClientSecret,
+	}
+
+	return &http.Client{
+		Transport:     &tokenTransport{source: source, prefixes: appConfig.HttpTokenPrefixes, transport: transport},
+		CheckRedirect: httpClient.CheckRedirect,
+		Jar:           httpClient.Jar,
+		Timeout:       httpClient.Timeout,
+	}
+}
+
+// Token returns the cached token, fetching a new one when it is missing or about to expire
+func (s *tokenSource) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && (s.expiresAt.IsZero() || now().Add(tokenRefreshMargin).Before(s.expiresAt)) {
+		return s.token, nil
+	}
+
+	return s.fetch()
+}
+
+// Refresh fetches a new token unless the cached one differs from rejected,
+// meaning another request already refreshed it
+func (s *tokenSource) Refresh(rejected string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && s.token != rejected {
+		return s.token, nil
+	}
+
+	return s.fetch()
+}
+
+func (s *tokenSource) fetch() (string, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	req, err := http.NewRequest(http.MethodPost, s.tokenUrl, strings.NewReader(form.Encode()))
+
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(s.clientId), url.QueryEscape(s.clientSecret))
+
+	resp, err := s.client.Do(req)
+
+	if err != nil {
+		return "", fmt.Errorf("token request to %s: %w", s.tokenUrl, err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request to %s error status: %s", s.tokenUrl, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+
+	if err != nil {
+		return "", err
+	}
+
+	var token tokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", fmt.Errorf("invalid token response from %s: %w", s.tokenUrl, err)
+	}
+
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("invalid token response from %s: missing access_token", s.tokenUrl)
+	}
+
+	if token.TokenType != "" && !strings.EqualFold(token.TokenType, "bearer") {
+		return "", fmt.Errorf("unsupported token type %s from %s", token.TokenType, s.tokenUrl)
+	}
+
+	s.token = token.AccessToken
+	s.expiresAt = time.Time{}
+
+	// a token without expires_in is kept until the server rejects it
+	if token.ExpiresIn > 0 {
+		s.expiresAt = now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+
+	return s.token, nil
+}
+
+// covers reports whether the token is issued for the registry req is sent to, so it
+// never reaches archive hosts named by metadata or the targets of redirects
+func (t *tokenTransport) covers(req *http.Request) bool {
+	for _, prefix := range t.prefixes {
+		if (RegistryCredential{Prefix: prefix}).matches(req.URL.Host, req.URL.Path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.covers(req) {
+		return t.transport.RoundTrip(req)
+	}
+
+	token, err := t.source.Token()
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.transport.RoundTrip(withBearer(req, token))
+
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+
+	refreshed, err := t.source.Refresh(token)
+
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	retry := withBearer(req, refreshed)
+
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+	}
+
+	resp.Body.Close()
+	return t.transport.RoundTrip(retry)
+}
+
+func withBearer(req *http.Request, token string) *http.Request {
+	authorized := req.Clone(req.Context())
+	authorized.Header.Set("Authorization", "Bearer "+token)
+	return authorized
+}
@@ -0,0 +1,147 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrPlainHttpDisallowed is returned when a dependency would be fetched over plain http
+// while AppConfig.DisallowPlainHttp is set
+var ErrPlainHttpDisallowed = errors.New("plain http is disallowed")
+
+// ErrArchiveHostMismatch is returned for http packages whose archive is hosted elsewhere
+// than their metadata while AppConfig.SameHostArchives is set
+var ErrArchiveHostMismatch = errors.New("archive host differs from metadata host")
+
+// proxyTransport sends every request to a read-through caching proxy, keeping
+// the original path and passing the original host in X-Forwarded-Host
+type proxyTransport struct {
+	proxy     *url.URL
+	transport http.RoundTripper
+}
+
+func (t *proxyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	proxied := req.Clone(req.Context())
+	proxied.Header.Set("X-Forwarded-Host", req.URL.Host)
+	proxied.URL.Scheme = t.proxy.Scheme
+	proxied.URL.Host = t.proxy.Host
+	proxied.URL.Path = strings.TrimSuffix(t.proxy.Path, "/") + req.URL.Path
+	proxied.URL.RawPath = ""
+	proxied.Host = t.proxy.Host
+
+	return t.transport.RoundTrip(proxied)
+}
+
+// newHttpClient builds the http client shared by the resolvers of a Resolver
+func newHttpClient(appConfig *AppConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if appConfig.MaxIdleConns > 0 {
+		transport.MaxIdleConns = appConfig.MaxIdleConns
+	}
+
+	if appConfig.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = appConfig.MaxIdleConnsPerHost
+	}
+
+	if appConfig.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = appConfig.MaxConnsPerHost
+	}
+
+	roundTripper := withProtocol(appConfig.HttpProtocol, transport)
+
+	jar, err := newCookieJar(appConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if appConfig.RegistryProxyURL == "" {
+		return &http.Client{Transport: roundTripper, Jar: jar}, nil
+	}
+
+	proxy, err := url.Parse(appConfig.RegistryProxyURL)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid registry proxy url %s: %w", appConfig.RegistryProxyURL, err)
+	}
+
+	if proxy.Scheme == "" || proxy.Host == "" {
+		return nil, fmt.Errorf("invalid registry proxy url %s: scheme and host are required", appConfig.RegistryProxyURL)
+	}
+
+	return &http.Client{Transport: &proxyTransport{proxy: proxy, transport: roundTripper}, Jar: jar}, nil
+}
+
+// checkPlainHttp rejects dependencies resolved over plain http, through the config
+// or a .plain name, when plain http is disallowed
+func (r *Resolver) checkPlainHttp(dependency Dependency) error {
+	if !r.config.DisallowPlainHttp || r.tarballResolver != nil {
+		return nil
+	}
+
+	if r.config.PlainHttp || strings.Contains(dependency.Name, ".plain") {
+		return fmt.Errorf("dependency %s (%s): %w", dependency.Name, dependency.Uri, ErrPlainHttpDisallowed)
+	}
+
+	return nil
+}
+
+// checkPlainArchive rejects archives fetched over plain http when plain http is disallowed
+func (r *Resolver) checkPlainArchive(m *Metadata) error {
+	if !r.config.DisallowPlainHttp || r.tarballResolver != nil {
+		return nil
+	}
+
+	if m.PlainHttp {
+		return ErrPlainHttpDisallowed
+	}
+
+	if zipUrl := archiveUrl(r.config, m.PackageZipUrl); m.ResolverType != OCI && strings.HasPrefix(strings.ToLower(zipUrl), "http://") {
+		return fmt.Errorf("archive %s: %w", zipUrl, ErrPlainHttpDisallowed)
+	}
+
+	return nil
+}
+
+// cancelBody releases the context of a request bounded by a timeout once its body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// archiveUrl applies the scheme configured in AppConfig.ArchiveSchemes for the host of zipUrl
+func archiveUrl(appConfig *AppConfig, zipUrl string) string {
+	if len(appConfig.ArchiveSchemes) == 0 {
+		return zipUrl
+	}
+
+	u, err := url.Parse(zipUrl)
+
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return zipUrl
+	}
+
+	scheme, ok := appConfig.ArchiveSchemes[u.Host]
+
+	if !ok {
+		scheme, ok = appConfig.ArchiveSchemes[u.Hostname()]
+	}
+
+	if !ok {
+		return zipUrl
+	}
+
+	u.Scheme = scheme
+	return u.String()
+}
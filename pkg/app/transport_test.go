@@ -0,0 +1,61 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestArchiveSchemeOverride(t *testing.T) {
+	reg := newTestRegistry(t)
+	archive := []byte("archive")
+	reg.add(t, "lib", "1.0.0", archive)
+
+	sum := sha256.Sum256(archive)
+	metadata, err := json.Marshal(Metadata{
+		Name:                "lib",
+		Version:             "1.0.0",
+		PackageZipUrl:       "https://" + reg.host + "/lib@1.0.0.zip",
+		PackageZipChecksums: Checksums{Sha256: hex.EncodeToString(sum[:])},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write(metadata)
+	}))
+	t.Cleanup(server.Close)
+
+	config := newTestResolver(t, func(config *AppConfig) {
+		config.PlainHttp = false
+		config.ArchiveSchemes = map[string]string{reg.host: "http"}
+	}).config
+
+	r := NewHttpResolver(config, server.Client())
+
+	m, err := r.ResolveMetadata("package://"+server.Listener.Addr().String()+"/lib@1.0.0", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.PlainHttp {
+		t.Errorf("expected the metadata to be fetched over https")
+	}
+
+	data, err := r.ResolveArchive(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != string(archive) {
+		t.Errorf("unexpected archive %q", data)
+	}
+
+	if count := reg.requestCount("/lib@1.0.0.zip"); count != 1 {
+		t.Errorf("expected the archive to be fetched once over plain http, got %d requests", count)
+	}
+}
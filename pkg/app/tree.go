@@ -0,0 +1,94 @@
+package app
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// shortChecksumLength is the number of hex digits of the sha256 shown by RenderTree
+const shortChecksumLength = 12
+
+// RenderTree writes the dependency tree of resolved, as returned by Resolve, to w for
+// human review. Every package is annotated with a short sha256 of its archive, and the
+// package already shown with its dependencies is marked with (*) instead.
+func (r *Resolver) RenderTree(resolved map[string]*Metadata, w io.Writer) error {
+	index := aliasIndex(resolved)
+	children := make(map[string][]string, len(resolved))
+	dependent := make(map[string]bool, len(resolved))
+
+	for uri, m := range resolved {
+		for _, dependency := range declaredDependencies(m) {
+			if child, ok := index[dependency]; ok {
+				children[uri] = append(children[uri], child)
+				dependent[child] = true
+			}
+		}
+
+		sort.Strings(children[uri])
+	}
+
+	var roots []string
+	for uri := range resolved {
+		if !dependent[uri] {
+			roots = append(roots, uri)
+		}
+	}
+
+	// packages only reachable through a cycle still have to be shown
+	if len(roots) == 0 {
+		for uri := range resolved {
+			roots = append(roots, uri)
+		}
+	}
+
+	sort.Strings(roots)
+
+	var b strings.Builder
+	shown := make(map[string]bool, len(resolved))
+
+	var render func(uri string, prefix string, connector string, indent string)
+	render = func(uri string, prefix string, connector string, indent string) {
+		b.WriteString(prefix + connector + treeLabel(uri, resolved[uri]))
+
+		if shown[uri] {
+			b.WriteString(" (*)\n")
+			return
+		}
+
+		b.WriteString("\n")
+		shown[uri] = true
+
+		for i, child := range children[uri] {
+			if i == len(children[uri])-1 {
+				render(child, prefix+indent, "└── ", "    ")
+			} else {
+				render(child, prefix+indent, "├── ", "│   ")
+			}
+		}
+	}
+
+	for _, root := range roots {
+		if !shown[root] {
+			render(root, "", "", "")
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+// treeLabel is the line of a package in RenderTree, its uri without scheme followed by
+// the start of the sha256 of its archive
+func treeLabel(uri string, m *Metadata) string {
+	label := strings.TrimPrefix(uri, "package://")
+
+	if digest, err := DecodeSha256(m.PackageZipChecksums.Sha256); err == nil && len(digest) > 0 {
+		label += fmt.Sprintf(" (sha256:%s…)", hex.EncodeToString(digest)[:shortChecksumLength])
+	}
+
+	return label
+}
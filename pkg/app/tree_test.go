@@ -0,0 +1,62 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestRenderTree(t *testing.T) {
+	metadata := func(name string, deps ...string) *Metadata {
+		sum := sha256.Sum256([]byte(name))
+		m := &Metadata{
+			Name:                name,
+			PackageUri:          "package://example.com/" + name + "@1.0.0",
+			Version:             "1.0.0",
+			PackageZipChecksums: Checksums{Sha256: hex.EncodeToString(sum[:])},
+			Dependencies:        make(map[string]Dependency),
+		}
+
+		for _, dep := range deps {
+			m.Dependencies[dep] = Dependency{Uri: "package://example.com/" + dep + "@1.0.0", Name: dep}
+		}
+
+		return m
+	}
+
+	resolved := make(map[string]*Metadata)
+	for _, m := range []*Metadata{
+		metadata("app", "left", "right"),
+		metadata("left", "shared"),
+		metadata("right", "shared"),
+		metadata("shared", "leaf"),
+		metadata("leaf"),
+	} {
+		resolved[m.PackageUri] = m
+	}
+
+	short := func(name string) string {
+		sum := sha256.Sum256([]byte(name))
+		return "(sha256:" + hex.EncodeToString(sum[:])[:shortChecksumLength] + "…)"
+	}
+
+	var b strings.Builder
+	if err := newTestResolver(t).RenderTree(resolved, &b); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Join([]string{
+		"example.com/app@1.0.0 " + short("app"),
+		"├── example.com/left@1.0.0 " + short("left"),
+		"│   └── example.com/shared@1.0.0 " + short("shared"),
+		"│       └── example.com/leaf@1.0.0 " + short("leaf"),
+		"└── example.com/right@1.0.0 " + short("right"),
+		"    └── example.com/shared@1.0.0 " + short("shared") + " (*)",
+		"",
+	}, "\n")
+
+	if b.String() != expected {
+		t.Errorf("unexpected tree, expected:\n%s\ngot:\n%s", expected, b.String())
+	}
+}
@@ -0,0 +1,131 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type (
+	// PackageChange is a package whose version differs between two resolved sets,
+	// From is empty for added packages and To for removed ones
+	PackageChange struct {
+		Package string `json:"package"`
+		From    string `json:"from,omitempty"`
+		To      string `json:"to,omitempty"`
+	}
+
+	// UpgradeReport lists the packages changed between two resolved dependency sets,
+	// each list sorted by versionless package uri
+	UpgradeReport struct {
+		Added      []PackageChange `json:"added,omitempty"`
+		Removed    []PackageChange `json:"removed,omitempty"`
+		Upgraded   []PackageChange `json:"upgraded,omitempty"`
+		Downgraded []PackageChange `json:"downgraded,omitempty"`
+	}
+)
+
+// UpgradeSummary compares the resolved sets before and after a dependency change by
+// versionless package uri. When a set holds several versions of a package side by
+// side, their highest versions are compared.
+func (r *Resolver) UpgradeSummary(before, after map[string]*Metadata) UpgradeReport {
+	beforeVersions := highestVersions(before)
+	afterVersions := highestVersions(after)
+
+	var report UpgradeReport
+
+	for pkg, from := range beforeVersions {
+		to, ok := afterVersions[pkg]
+
+		switch {
+		case !ok:
+			report.Removed = append(report.Removed, PackageChange{Package: pkg, From: from})
+		case compareVersions(from, to) < 0:
+			report.Upgraded = append(report.Upgraded, PackageChange{Package: pkg, From: from, To: to})
+		case compareVersions(from, to) > 0:
+			report.Downgraded = append(report.Downgraded, PackageChange{Package: pkg, From: from, To: to})
+		}
+	}
+
+	for pkg, to := range afterVersions {
+		if _, ok := beforeVersions[pkg]; !ok {
+			report.Added = append(report.Added, PackageChange{Package: pkg, To: to})
+		}
+	}
+
+	for _, changes := range [][]PackageChange{report.Added, report.Removed, report.Upgraded, report.Downgraded} {
+		sort.Slice(changes, func(i, j int) bool {
+			return changes[i].Package < changes[j].Package
+		})
+	}
+
+	return report
+}
+
+// Empty reports whether no package changed
+func (u UpgradeReport) Empty() bool {
+	return len(u.Added) == 0 && len(u.Removed) == 0 && len(u.Upgraded) == 0 && len(u.Downgraded) == 0
+}
+
+// String renders the report as a markdown list grouped by kind of change
+func (u UpgradeReport) String() string {
+	if u.Empty() {
+		return "No dependency changes\n"
+	}
+
+	var b strings.Builder
+
+	section := func(title string, changes []PackageChange, format func(PackageChange) string) {
+		if len(changes) == 0 {
+			return
+		}
+
+		fmt.Fprintf(&b, "%s:\n", title)
+		for _, change := range changes {
+			fmt.Fprintf(&b, "- %s\n", format(change))
+		}
+	}
+
+	section("Added", u.Added, func(c PackageChange) string { return fmt.Sprintf("%s %s", c.Package, c.To) })
+	section("Removed", u.Removed, func(c PackageChange) string { return fmt.Sprintf("%s %s", c.Package, c.From) })
+	section("Upgraded", u.Upgraded, func(c PackageChange) string { return fmt.Sprintf("%s %s → %s", c.Package, c.From, c.To) })
+	section("Downgraded", u.Downgraded, func(c PackageChange) string { return fmt.Sprintf("%s %s → %s", c.Package, c.From, c.To) })
+
+	return b.String()
+}
+
+// highestVersions maps the versionless uri of every package of resolved to its highest version
+func highestVersions(resolved map[string]*Metadata) map[string]string {
+	versions := make(map[string]string, len(resolved))
+
+	for _, m := range resolved {
+		base, version, err := SplitPackageUri(m.PackageUri)
+
+		if err != nil {
+			base = m.PackageUri
+		}
+
+		if m.Version != "" {
+			version = m.Version
+		}
+
+		if current, ok := versions[base]; !ok || compareVersions(current, version) < 0 {
+			versions[base] = version
+		}
+	}
+
+	return versions
+}
+
+// compareVersions orders semver versions by precedence, falling back to comparing
+// them as strings when one of them is not semver
+func compareVersions(a, b string) int {
+	va, errA := parseVersion(a)
+	vb, errB := parseVersion(b)
+
+	if errA != nil || errB != nil {
+		return strings.Compare(a, b)
+	}
+
+	return va.Compare(vb)
+}
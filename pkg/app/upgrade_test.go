@@ -0,0 +1,71 @@
+package app
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestUpgradeSummary(t *testing.T) {
+	resolved := func(uris ...string) map[string]*Metadata {
+		result := make(map[string]*Metadata, len(uris))
+		for _, uri := range uris {
+			_, version, err := SplitPackageUri(uri)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result[uri] = &Metadata{PackageUri: uri, Version: version}
+		}
+		return result
+	}
+
+	before := resolved(
+		"package://example.com/kept@1.0.0",
+		"package://example.com/bumped@1.2.0",
+		"package://example.com/major@1.4.0",
+		"package://example.com/rolledback@2.1.0",
+		"package://example.com/dropped@0.3.0",
+	)
+
+	after := resolved(
+		"package://example.com/kept@1.0.0",
+		"package://example.com/bumped@1.10.0",
+		"package://example.com/major@1.4.0",
+		"package://example.com/major@2.0.0",
+		"package://example.com/rolledback@2.0.5",
+		"package://example.com/fresh@0.1.0",
+	)
+
+	r := newTestResolver(t)
+	report := r.UpgradeSummary(before, after)
+
+	expected := UpgradeReport{
+		Added:   []PackageChange{{Package: "package://example.com/fresh", To: "0.1.0"}},
+		Removed: []PackageChange{{Package: "package://example.com/dropped", From: "0.3.0"}},
+		Upgraded: []PackageChange{
+			{Package: "package://example.com/bumped", From: "1.2.0", To: "1.10.0"},
+			{Package: "package://example.com/major", From: "1.4.0", To: "2.0.0"},
+		},
+		Downgraded: []PackageChange{{Package: "package://example.com/rolledback", From: "2.1.0", To: "2.0.5"}},
+	}
+
+	if diff := cmp.Diff(expected, report); diff != "" {
+		t.Errorf("unexpected report (-want +got):\n%s", diff)
+	}
+
+	summary := report.String()
+	for _, line := range []string{
+		"- package://example.com/fresh 0.1.0",
+		"- package://example.com/bumped 1.2.0 → 1.10.0",
+		"- package://example.com/rolledback 2.1.0 → 2.0.5",
+	} {
+		if !strings.Contains(summary, line) {
+			t.Errorf("expected %q in summary:\n%s", line, summary)
+		}
+	}
+
+	if unchanged := r.UpgradeSummary(before, before); !unchanged.Empty() {
+		t.Errorf("expected no changes, got %+v", unchanged)
+	}
+}
@@ -0,0 +1,138 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// versionsFile lists the versions of a package next to its metadata on http registries
+const versionsFile = "versions.json"
+
+type (
+	// VersionLister enumerates the published versions of a versionless package uri,
+	// consulted to select the version matching a constraint
+	VersionLister interface {
+		ListVersions(packageUri string) ([]*semver.Version, error)
+	}
+
+	// plainVersionLister is implemented by listers able to list the versions of
+	// .plain dependencies over plain http
+	plainVersionLister interface {
+		listPlainVersions(packageUri string) ([]*semver.Version, error)
+	}
+)
+
+// WithVersionLister replaces how versions of packages of resolverType are enumerated
+func WithVersionLister(resolverType ResolverType, lister VersionLister) ResolverOption {
+	return func(r *Resolver) {
+		r.versionListers[resolverType] = lister
+	}
+}
+
+// parseVersions parses versions, skipping the ones that are not semver
+func parseVersions(versions []string) []*semver.Version {
+	parsed := make([]*semver.Version, 0, len(versions))
+
+	for _, v := range versions {
+		if version, err := semver.NewVersion(v); err == nil {
+			parsed = append(parsed, version)
+		}
+	}
+
+	return parsed
+}
+
+// ListVersions returns the semver tags published for a versionless package uri
+func (r *OciResolver) ListVersions(packageUri string) ([]*semver.Version, error) {
+	return r.listVersions(packageUri, false)
+}
+
+func (r *OciResolver) listPlainVersions(packageUri string) ([]*semver.Version, error) {
+	return r.listVersions(packageUri, true)
+}
+
+func (r *OciResolver) listVersions(packageUri string, plainHttp bool) ([]*semver.Version, error) {
+	u, err := url.Parse(packageUri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	client := r.client
+	if plainHttp {
+		client = r.plainClient
+	}
+
+	tags, err := client.Tags(u.Host + u.Path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return parseVersions(tags), nil
+}
+
+// ListVersions reads the json array of versions published at <package path>/versions.json
+func (r *HttpResolver) ListVersions(packageUri string) ([]*semver.Version, error) {
+	return r.listVersions(packageUri, false)
+}
+
+func (r *HttpResolver) listPlainVersions(packageUri string) ([]*semver.Version, error) {
+	return r.listVersions(packageUri, true)
+}
+
+func (r *HttpResolver) listVersions(packageUri string, plainHttp bool) ([]*semver.Version, error) {
+	u, err := url.Parse(packageUri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	u.Scheme = "https"
+	if r.plainHttp || plainHttp {
+		u.Scheme = "http"
+	}
+
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + versionsFile
+
+	ctx := r.config.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	resp, err := r.get(ctx, u.String(), r.config.MetadataTimeout, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrPackageNotFound, u.String())
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Http get %s error status: %s", u.String(), resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []string
+	if err := json.Unmarshal(body, &versions); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", u.String(), err)
+	}
+
+	return parseVersions(versions), nil
+}
@@ -0,0 +1,107 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// fakeLister serves a fixed set of versions and records the listed package uris
+type fakeLister struct {
+	mu       sync.Mutex
+	versions []string
+	listed   []string
+}
+
+func (l *fakeLister) ListVersions(packageUri string) ([]*semver.Version, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.listed = append(l.listed, packageUri)
+	return parseVersions(l.versions), nil
+}
+
+func TestResolveWithVersionListers(t *testing.T) {
+	reg := newTestRegistry(t)
+	httpSelected := reg.add(t, "lib", "1.1.0", []byte("zip"))
+	ociReg := newTestOciRegistry(t)
+	ociSelected := ociReg.add(t, "tool", "1.2.0", []byte("zip"), false)
+
+	httpLister := &fakeLister{versions: []string{"1.0.0", "1.1.0", "2.0.0"}}
+	ociLister := &fakeLister{versions: []string{"1.0.0", "1.2.0", "1.3.0-rc.1", "2.0.0"}}
+
+	r, err := NewResolver(newTestResolver(t).config, WithVersionLister(HTTP, httpLister), WithVersionLister(OCI, ociLister))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	httpBase := fmt.Sprintf("package://%s/lib", reg.host)
+	ociBase := fmt.Sprintf("package://%s/pkgs/tool", ociReg.host)
+
+	resolved, err := r.Resolve(dependencySet(
+		Dependency{Uri: httpBase + "@^1.0.0", Name: "lib"},
+		Dependency{Uri: ociBase + "@^1.0.0", Name: "tool.oci"},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, selected := range []Dependency{httpSelected, ociSelected} {
+		if _, ok := resolved[selected.Uri]; !ok {
+			t.Errorf("expected %s to be selected, got %v", selected.Uri, resolved)
+		}
+	}
+
+	if len(httpLister.listed) != 1 || httpLister.listed[0] != httpBase {
+		t.Errorf("expected the http lister to list %s, got %v", httpBase, httpLister.listed)
+	}
+
+	if len(ociLister.listed) != 1 || ociLister.listed[0] != ociBase {
+		t.Errorf("expected the oci lister to list %s, got %v", ociBase, ociLister.listed)
+	}
+}
+
+func TestHttpListVersions(t *testing.T) {
+	reg := newTestRegistry(t)
+	reg.serve("/lib/versions.json", []byte(`["1.0.0", "1.1.0", "not-a-version", "2.0.0"]`))
+
+	r := newTestResolver(t)
+
+	versions, err := r.httpResolver.ListVersions(fmt.Sprintf("package://%s/lib", reg.host))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var listed []string
+	for _, v := range versions {
+		listed = append(listed, v.Original())
+	}
+
+	if fmt.Sprint(listed) != "[1.0.0 1.1.0 2.0.0]" {
+		t.Errorf("unexpected versions %v", listed)
+	}
+}
+
+func TestHttpListVersionsCancelled(t *testing.T) {
+	reg := newTestRegistry(t)
+	reg.serve("/lib/versions.json", []byte(`["1.0.0"]`))
+	reg.add(t, "lib", "1.0.0", []byte("zip"))
+
+	r := newTestResolver(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := r.ResolveContext(ctx, dependencySet(Dependency{Uri: fmt.Sprintf("package://%s/lib@^1.0.0", reg.host), Name: "lib"}))
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected listing the versions to be cancelled with the resolution, got %v", err)
+	}
+
+	if count := reg.requestCount("/lib/versions.json"); count != 0 {
+		t.Errorf("expected no versions request once cancelled, got %d", count)
+	}
+}
@@ -1,33 +1,120 @@
 package logger
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"sync"
 )
 
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelError
+)
+
+// ParseLevel converts a level name (debug, info or error) into a Level
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return LevelInfo, fmt.Errorf("unknown log level %q, expected debug, info or error", name)
+	}
+}
+
+type correlationKey struct{}
+
+// WithCorrelationID returns a context carrying id, prefixed to the lines of loggers scoped with it
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// CorrelationID returns the correlation id carried by ctx, if any
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+// output is shared by a logger and the loggers derived from it
+type output struct {
+	mu    sync.Mutex
+	out   io.Writer
+	err   io.Writer
+	level Level
+}
+
+// Logger writes whole lines under a mutex so that messages logged from
+// concurrent goroutines never interleave
 type Logger struct {
-	out io.Writer
-	err io.Writer
+	*output
+	prefix string
 }
 
 func New(outWriter io.Writer, errWriter io.Writer) *Logger {
 	return &Logger{
-		out: outWriter,
-		err: errWriter,
+		output: &output{
+			out:   outWriter,
+			err:   errWriter,
+			level: LevelInfo,
+		},
+	}
+}
+
+// WithID returns a logger sharing the writers and level of l which prefixes every line with id
+func (l *Logger) WithID(id string) *Logger {
+	if id == "" {
+		return l
 	}
+
+	return &Logger{output: l.output, prefix: "[" + id + "] "}
+}
+
+// SetLevel sets the minimum level of the messages written
+func (l *Logger) SetLevel(level Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.level = level
 }
 
 func (l *Logger) Log(def io.Writer, s string, a ...any) {
-	fmt.Fprintln(def, fmt.Sprintf(s, a...))
+	line := l.prefix + fmt.Sprintf(s, a...) + "\n"
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	io.WriteString(def, line)
+}
+
+func (l *Logger) enabled(level Level) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return level >= l.level
+}
+
+func (l *Logger) Debug(s string, a ...any) {
+	if l.enabled(LevelDebug) {
+		l.Log(l.out, s, a...)
+	}
 }
 
 func (l *Logger) Info(s string, a ...any) {
-	l.Log(l.out, s, a...)
+	if l.enabled(LevelInfo) {
+		l.Log(l.out, s, a...)
+	}
 }
 
 func (l *Logger) Error(s string, a ...any) {
-	l.Log(l.err, s, a...)
+	if l.enabled(LevelError) {
+		l.Log(l.err, s, a...)
+	}
 }
 
 func (l *Logger) Fatal(s string, a ...any) {
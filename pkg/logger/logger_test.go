@@ -0,0 +1,97 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentLogging(t *testing.T) {
+	out := new(bytes.Buffer)
+	logger := New(out, out)
+
+	const goroutines, messages = 50, 100
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for m := 0; m < messages; m++ {
+				if m%2 == 0 {
+					logger.Info("goroutine %d message %d %s", g, m, strings.Repeat("x", 64))
+				} else {
+					logger.Error("goroutine %d message %d %s", g, m, strings.Repeat("x", 64))
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+
+	if len(lines) != goroutines*messages {
+		t.Fatalf("expected %d lines, got %d", goroutines*messages, len(lines))
+	}
+
+	for _, line := range lines {
+		var g, m int
+		var tail string
+		if n, err := fmt.Sscanf(line, "goroutine %d message %d %s", &g, &m, &tail); n != 3 || err != nil || tail != strings.Repeat("x", 64) {
+			t.Fatalf("garbled line %q", line)
+		}
+	}
+}
+
+func TestLevelFiltering(t *testing.T) {
+	out := new(bytes.Buffer)
+	errOut := new(bytes.Buffer)
+	logger := New(out, errOut)
+
+	logger.Debug("hidden by default")
+	logger.Info("info")
+
+	logger.SetLevel(LevelError)
+	logger.Info("hidden")
+	logger.Error("error")
+
+	logger.SetLevel(LevelDebug)
+	logger.Debug("debug")
+
+	if out.String() != "info\ndebug\n" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+
+	if errOut.String() != "error\n" {
+		t.Errorf("unexpected error output %q", errOut.String())
+	}
+
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("expected unknown level to be rejected")
+	}
+}
+
+func TestCorrelationID(t *testing.T) {
+	out := new(bytes.Buffer)
+	logger := New(out, out)
+
+	ctx := WithCorrelationID(context.Background(), "req-1")
+	scoped := logger.WithID(CorrelationID(ctx))
+
+	scoped.Info("scoped")
+	logger.Info("plain")
+
+	if logger.WithID(CorrelationID(context.Background())) != logger {
+		t.Error("expected a context without id to keep the logger")
+	}
+
+	logger.SetLevel(LevelError)
+	scoped.Info("hidden")
+
+	if out.String() != "[req-1] scoped\nplain\n" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
@@ -1,40 +1,12 @@
 package pklutils
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/url"
-	"os"
 	"path/filepath"
 	"strings"
 )
 
-type ResolvedDependency struct {
-	DependencyType string            `json:"type"`
-	Uri            string            `json:"uri,omitempty"`
-	Path           string            `json:"path,omitempty"`
-	Checksums      map[string]string `json:"checksums,omitempty"`
-}
-
-type ProjectDeps struct {
-	SchemaVersion        int                            `json:"schemaVersion"`
-	ResolvedDependencies map[string]*ResolvedDependency `json:"resolvedDependencies"`
-}
-
-func PklWriteDeps(workingDir string, deps *ProjectDeps) error {
-	depsData, err := json.MarshalIndent(deps, "", "  ")
-	if err != nil {
-		return err
-	}
-
-	err = os.WriteFile(filepath.Join(workingDir, "PklProject.deps.json"), depsData, os.ModePerm)
-	if err != nil {
-		return err
-	}
-
-	return err
-}
-
 func PklGetRelativePath(cacheDir string, baseUri *url.URL) string {
 	return filepath.Join(
 		cacheDir,
@@ -52,11 +24,32 @@ func PklBaseUriToRef(uri string, version string) (string, error) {
 	return fmt.Sprintf("%s%s:%s", baseUri.Host, baseUri.Path, version), nil
 }
 
+// PklUriToRef converts a package uri like package://host:port/path/name@version
+// into the OCI reference host:port/path/name:version. The + of build metadata, not
+// allowed in tags, becomes _ following the Helm convention the registry client reverses.
 func PklUriToRef(uri string) (string, error) {
 	u, err := url.Parse(uri)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("invalid package uri %s: %w", uri, err)
+	}
+
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid package uri %s: missing host", uri)
+	}
+
+	path, version, found := strings.Cut(u.Path, "@")
+
+	if !found || version == "" {
+		return "", fmt.Errorf("invalid package uri %s: missing version", uri)
 	}
-	s := strings.Split(u.Path, "@")
-	return fmt.Sprintf("%s%s:%s", u.Host, s[0], s[1]), nil
+
+	if path == "" || path == "/" {
+		return "", fmt.Errorf("invalid package uri %s: missing package path", uri)
+	}
+
+	if strings.Contains(version, "@") || strings.Contains(version, "/") {
+		return "", fmt.Errorf("invalid package uri %s: malformed version %s", uri, version)
+	}
+
+	return fmt.Sprintf("%s%s:%s", u.Host, path, strings.ReplaceAll(version, "+", "_")), nil
 }
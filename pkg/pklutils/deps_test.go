@@ -0,0 +1,42 @@
+package pklutils
+
+import "testing"
+
+func TestPklUriToRef(t *testing.T) {
+	valid := map[string]string{
+		"package://example.com/lib@1.0.0":                    "example.com/lib:1.0.0",
+		"package://localhost:5000/lib@1.0.0":                 "localhost:5000/lib:1.0.0",
+		"package://example.com/org/team/lib@2.1.0":           "example.com/org/team/lib:2.1.0",
+		"package://example.com/lib@1.0.0-rc.1":               "example.com/lib:1.0.0-rc.1",
+		"package://example.com:8443/org/lib@1.0.0-beta+b.12": "example.com:8443/org/lib:1.0.0-beta_b.12",
+	}
+
+	for uri, expected := range valid {
+		actual, err := PklUriToRef(uri)
+
+		if err != nil {
+			t.Errorf("unexpected error for %s: %s", uri, err)
+			continue
+		}
+
+		if actual != expected {
+			t.Errorf("expected %s for %s, got %s", expected, uri, actual)
+		}
+	}
+
+	malformed := []string{
+		"package://example.com/lib",
+		"package://example.com/lib@",
+		"package://example.com/@1.0.0",
+		"package:///lib@1.0.0",
+		"package://example.com/lib@1.0.0@2.0.0",
+		"package://example.com/lib@1.0.0/extra",
+		"package://exa mple.com/lib@1.0.0",
+	}
+
+	for _, uri := range malformed {
+		if ref, err := PklUriToRef(uri); err == nil {
+			t.Errorf("expected an error for %s, got %s", uri, ref)
+		}
+	}
+}
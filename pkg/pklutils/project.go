@@ -5,6 +5,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/apple/pkl-go/pkl"
 )
@@ -48,3 +49,31 @@ func LoadProjectFromEvaluator(context context.Context, ev pkl.Evaluator, path st
 	}
 	return &proj, nil
 }
+
+// evaluateTimeout bounds the evaluation of modules fetched from registries
+const evaluateTimeout = 30 * time.Second
+
+// EvaluateJson evaluates the pkl module text and renders its output as json.
+// The text comes from untrusted registries, so the evaluator may only import the
+// standard library, reads no resources and is bounded by evaluateTimeout.
+func EvaluateJson(ctx context.Context, text string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, evaluateTimeout)
+	defer cancel()
+
+	ev, err := pkl.NewEvaluator(ctx, func(opts *pkl.EvaluatorOptions) {
+		opts.AllowedModules = []string{"pkl:", "repl:"}
+		opts.AllowedResources = []string{}
+		opts.Logger = pkl.NoopLogger
+		opts.OutputFormat = "json"
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer ev.Close()
+
+	out, err := ev.EvaluateOutputText(ctx, pkl.TextSource(text))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(out), nil
+}
@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/apple/pkl-go/pkl"
 	"github.com/pkg/errors"
@@ -17,6 +18,7 @@ import (
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 
 	"github.com/Masterminds/semver/v3"
+	"github.com/containerd/containerd/errdefs"
 	"github.com/containerd/containerd/remotes"
 
 	"oras.land/oras-go/pkg/auth"
@@ -309,6 +311,8 @@ type (
 
 	pullOperation struct {
 		withPackage bool
+		timeout     time.Duration
+		ctx         context.Context
 	}
 )
 
@@ -343,12 +347,25 @@ func (c *Client) Pull(ref string, options ...PullOption) (*PullResult, error) {
 	}
 	registryStore := content.Registry{Resolver: remotesResolver}
 
-	manifest, err := oras.Copy(ctx(c.out, c.debug), registryStore, parsedRef.String(), memoryStore, "",
+	pullCtx := ctx(c.out, c.debug)
+	if operation.ctx != nil {
+		pullCtx = withLogger(operation.ctx, c.out, c.debug)
+	}
+	if operation.timeout > 0 {
+		var cancel context.CancelFunc
+		pullCtx, cancel = context.WithTimeout(pullCtx, operation.timeout)
+		defer cancel()
+	}
+
+	manifest, err := oras.Copy(pullCtx, registryStore, parsedRef.String(), memoryStore, "",
 		oras.WithPullEmptyNameAllowed(),
 		oras.WithAllowedMediaTypes(allowedMediaTypes),
 		oras.WithLayerDescriptors(func(l []ocispec.Descriptor) {
 			layers = l
 		}))
+	if errdefs.IsNotFound(err) {
+		return nil, fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -472,6 +489,20 @@ func PullOptWithPackage(withPackage bool) PullOption {
 	}
 }
 
+// PullOptContext returns a function that cancels the pull when ctx is done
+func PullOptContext(ctx context.Context) PullOption {
+	return func(operation *pullOperation) {
+		operation.ctx = ctx
+	}
+}
+
+// PullOptTimeout returns a function that bounds the duration of a pull, 0 means no timeout
+func PullOptTimeout(timeout time.Duration) PullOption {
+	return func(operation *pullOperation) {
+		operation.timeout = timeout
+	}
+}
+
 type (
 	// PushOption allows specifying various settings on push
 	PushOption func(*pushOperation)
@@ -646,12 +677,17 @@ func (c *Client) Tags(ref string) ([]string, error) {
 	}
 
 	var tagVersions []*semver.Version
+	prefixed := make(map[*semver.Version]bool)
 	for _, tag := range registryTags {
 		// Change underscore (_) back to plus (+) for Helm
 		// See https://github.com/helm/helm/issues/10166
-		tagVersion, err := semver.StrictNewVersion(strings.ReplaceAll(tag, "_", "+"))
+		tag = strings.ReplaceAll(tag, "_", "+")
+		// Keep releases tagged as v1.2.3, the prefix is needed to pull them
+		version, hasPrefix := strings.CutPrefix(tag, "v")
+		tagVersion, err := semver.StrictNewVersion(version)
 		if err == nil {
 			tagVersions = append(tagVersions, tagVersion)
+			prefixed[tagVersion] = hasPrefix
 		}
 	}
 
@@ -662,6 +698,9 @@ func (c *Client) Tags(ref string) ([]string, error) {
 
 	for iTv, tv := range tagVersions {
 		tags[iTv] = tv.String()
+		if prefixed[tv] {
+			tags[iTv] = "v" + tags[iTv]
+		}
 	}
 
 	return tags, nil
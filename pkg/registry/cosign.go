@@ -0,0 +1,77 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	// CosignSimpleSigningMediaType is the media type of the payload signed by cosign
+	CosignSimpleSigningMediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+
+	cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+)
+
+// ErrSignatureNotFound is returned when no signature is stored for a manifest
+var ErrSignatureNotFound = errors.New("signature not found")
+
+// CosignSignature is a cosign signature of a manifest stored in a registry
+type CosignSignature struct {
+	// Payload is the signed simple signing document
+	Payload []byte
+	// Signature is the base64 encoded signature of Payload
+	Signature string
+}
+
+// PullCosignSignatures fetches the cosign signatures stored for manifestDigest
+// in the repository of ref, following the cosign sha256-<digest>.sig tag convention
+func (c *Client) PullCosignSignatures(ref string, manifestDigest string) ([]CosignSignature, error) {
+	parsedRef, err := parseReference(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	baseUrl := c.repositoryUrl(parsedRef)
+	tag := strings.Replace(manifestDigest, ":", "-", 1) + ".sig"
+
+	manifestData, err := c.fetch(baseUrl+"/manifests/"+tag, ocispec.MediaTypeImageManifest, "")
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && statusErr.statusCode == http.StatusNotFound {
+		return nil, ErrSignatureNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest ocispec.Manifest
+	if err := json.Unmarshal(manifestData.Data, &manifest); err != nil {
+		return nil, err
+	}
+
+	var signatures []CosignSignature
+
+	for _, layer := range manifest.Layers {
+		signature, ok := layer.Annotations[cosignSignatureAnnotation]
+		if layer.MediaType != CosignSimpleSigningMediaType || !ok {
+			continue
+		}
+
+		payload, err := c.fetch(baseUrl+"/blobs/"+layer.Digest.String(), layer.MediaType, layer.Digest)
+		if err != nil {
+			return nil, err
+		}
+
+		signatures = append(signatures, CosignSignature{Payload: payload.Data, Signature: signature})
+	}
+
+	if len(signatures) == 0 {
+		return nil, fmt.Errorf("%w: %s has no cosign signature layers", ErrSignatureNotFound, tag)
+	}
+
+	return signatures, nil
+}
@@ -0,0 +1,37 @@
+package registry
+
+import (
+	"net/http"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Exists reports whether the manifest of ref is stored in the registry
+func (c *Client) Exists(ref string) (bool, error) {
+	parsedRef, err := parseReference(ref)
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequest(http.MethodHead, c.repositoryUrl(parsedRef)+"/manifests/"+parsedRef.Reference, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", strings.Join([]string{ocispec.MediaTypeImageManifest, ocispec.MediaTypeImageIndex}, ", "))
+
+	resp, err := c.registryAuthorizer.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, &statusError{url: req.URL.String(), status: resp.Status, statusCode: resp.StatusCode}
+	}
+}
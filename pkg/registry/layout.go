@@ -0,0 +1,175 @@
+package registry
+
+import (
+	// registers sha256 for the digests of layout blobs
+	_ "crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apple/pkl-go/pkl"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Layout reads packages from an OCI image layout directory, the oci-layout, index.json
+// and blobs structure exported by oras or skopeo, without a registry
+type Layout struct {
+	root string
+}
+
+// OpenLayout opens the OCI image layout stored in root, which may be given as an oci: uri
+func OpenLayout(root string) (*Layout, error) {
+	root = strings.TrimPrefix(strings.TrimPrefix(root, OCIScheme+"://"), OCIScheme+":")
+
+	data, err := os.ReadFile(filepath.Join(root, ocispec.ImageLayoutFile))
+	if err != nil {
+		return nil, fmt.Errorf("invalid oci layout %s: %w", root, err)
+	}
+
+	var layout ocispec.ImageLayout
+	if err := json.Unmarshal(data, &layout); err != nil {
+		return nil, fmt.Errorf("invalid oci layout %s: %w", root, err)
+	}
+
+	if layout.Version != ocispec.ImageLayoutVersion {
+		return nil, fmt.Errorf("unsupported oci layout version %s in %s", layout.Version, root)
+	}
+
+	return &Layout{root: root}, nil
+}
+
+// Pull reads the package of ref from the layout. The manifest is looked up in index.json by
+// its org.opencontainers.image.ref.name annotation, holding either the full reference, the
+// repository and tag or the tag alone. Every blob is verified against its digest.
+func (l *Layout) Pull(ref string, options ...PullOption) (*PullResult, error) {
+	parsedRef, err := parseReference(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	operation := &pullOperation{withPackage: true}
+	for _, option := range options {
+		option(operation)
+	}
+
+	manifestDescriptor, err := l.lookup(parsedRef.String(), parsedRef.Repository+":"+parsedRef.Reference, parsedRef.Reference)
+	if err != nil {
+		return nil, err
+	}
+
+	manifestData, err := l.readBlob(manifestDescriptor)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest ocispec.Manifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", manifestDescriptor.Digest, err)
+	}
+
+	if manifest.Config.MediaType != ConfigMediaType {
+		return nil, fmt.Errorf("could not load config with mediatype %s", ConfigMediaType)
+	}
+
+	result := &PullResult{
+		Manifest: &DescriptorPullSummary{Data: manifestData, Digest: manifestDescriptor.Digest.String(), Size: manifestDescriptor.Size},
+		Archive:  &DescriptorPullSummaryWithProject{},
+		Ref:      parsedRef.String(),
+	}
+
+	if result.Config, err = l.pullDescriptor(manifest.Config); err != nil {
+		return nil, err
+	}
+
+	var project *pkl.Project
+	if err := json.Unmarshal(result.Config.Data, &project); err != nil {
+		return nil, err
+	}
+	result.Archive.Project = project
+
+	for _, layer := range manifest.Layers {
+		if operation.ctx != nil && operation.ctx.Err() != nil {
+			return nil, operation.ctx.Err()
+		}
+
+		switch {
+		case layer.MediaType == MetadataMediaType:
+			result.Metadata, err = l.pullDescriptor(layer)
+		case layer.MediaType == PackageLayerMediaType && operation.withPackage:
+			var archive *DescriptorPullSummary
+			if archive, err = l.pullDescriptor(layer); err == nil {
+				result.Archive.DescriptorPullSummary = *archive
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if result.Metadata == nil {
+		return nil, fmt.Errorf("could not load metadata with mediatype %s", MetadataMediaType)
+	}
+
+	if operation.withPackage && result.Archive.Data == nil {
+		return nil, fmt.Errorf("manifest does not contain a layer with mediatype %s", PackageLayerMediaType)
+	}
+
+	return result, nil
+}
+
+// lookup returns the manifest of index.json annotated with the first matching name
+func (l *Layout) lookup(names ...string) (ocispec.Descriptor, error) {
+	data, err := os.ReadFile(filepath.Join(l.root, "index.json"))
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	var index ocispec.Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("invalid index.json in %s: %w", l.root, err)
+	}
+
+	for _, name := range names {
+		for _, manifest := range index.Manifests {
+			if manifest.Annotations[ocispec.AnnotationRefName] == name {
+				return manifest, nil
+			}
+		}
+	}
+
+	return ocispec.Descriptor{}, fmt.Errorf("%w: %s in oci layout %s", ErrNotFound, names[0], l.root)
+}
+
+func (l *Layout) pullDescriptor(descriptor ocispec.Descriptor) (*DescriptorPullSummary, error) {
+	data, err := l.readBlob(descriptor)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DescriptorPullSummary{Data: data, Digest: descriptor.Digest.String(), Size: descriptor.Size}, nil
+}
+
+// readBlob reads the blob of descriptor and verifies its size and digest
+func (l *Layout) readBlob(descriptor ocispec.Descriptor) ([]byte, error) {
+	if err := descriptor.Digest.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid digest %s: %w", descriptor.Digest, err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(l.root, "blobs", descriptor.Digest.Algorithm().String(), descriptor.Digest.Encoded()))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("blob %s missing from oci layout %s", descriptor.Digest, l.root)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) != descriptor.Size || descriptor.Digest.Algorithm().FromBytes(data) != descriptor.Digest {
+		return nil, fmt.Errorf("blob %s of oci layout %s does not match its digest", descriptor.Digest, l.root)
+	}
+
+	return data, nil
+}
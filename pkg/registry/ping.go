@@ -0,0 +1,34 @@
+package registry
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Ping checks that host answers the OCI distribution API with the configured credentials
+func (c *Client) Ping(host string) error {
+	scheme := "https"
+	if c.plainHTTP {
+		scheme = "http"
+	}
+
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s://%s/v2/", scheme, host), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.registryAuthorizer.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("authentication failed: %s", resp.Status)
+	default:
+		return &statusError{url: req.URL.String(), status: resp.Status, statusCode: resp.StatusCode}
+	}
+}
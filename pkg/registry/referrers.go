@@ -0,0 +1,155 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/pkg/registry"
+)
+
+// ErrNotFound is returned when the manifest of a reference does not exist in the registry
+var ErrNotFound = errors.New("manifest not found")
+
+// ErrReferrersUnsupported is returned when a registry does not expose the referrers API
+var ErrReferrersUnsupported = errors.New("registry does not support the referrers API")
+
+type statusError struct {
+	url        string
+	status     string
+	statusCode int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status %s for %s", e.status, e.url)
+}
+
+// PullReferrerMetadata fetches the package metadata attached to the manifest of ref
+// as a separate artifact through the OCI referrers API
+func (c *Client) PullReferrerMetadata(ref string) (*DescriptorPullSummary, error) {
+	parsedRef, err := parseReference(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	baseUrl := c.repositoryUrl(parsedRef)
+
+	subject, err := c.fetch(baseUrl+"/manifests/"+parsedRef.Reference, ocispec.MediaTypeImageManifest, "")
+	var subjectErr *statusError
+	if errors.As(err, &subjectErr) && subjectErr.statusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, parsedRef.String())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	referrersData, err := c.fetch(
+		fmt.Sprintf("%s/referrers/%s?artifactType=%s", baseUrl, subject.Digest, url.QueryEscape(MetadataMediaType)),
+		ocispec.MediaTypeImageIndex,
+		"",
+	)
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && statusErr.statusCode == http.StatusNotFound {
+		return nil, ErrReferrersUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var referrers ocispec.Index
+	if err := json.Unmarshal(referrersData.Data, &referrers); err != nil {
+		return nil, err
+	}
+
+	var metaManifest *ocispec.Descriptor
+	for _, descriptor := range referrers.Manifests {
+		if descriptor.ArtifactType == MetadataMediaType {
+			d := descriptor
+			metaManifest = &d
+			break
+		}
+	}
+
+	if metaManifest == nil {
+		return nil, fmt.Errorf("no referrer with artifact type %s found for %s", MetadataMediaType, parsedRef.String())
+	}
+
+	manifestData, err := c.fetch(baseUrl+"/manifests/"+metaManifest.Digest.String(), ocispec.MediaTypeImageManifest, metaManifest.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest ocispec.Manifest
+	if err := json.Unmarshal(manifestData.Data, &manifest); err != nil {
+		return nil, err
+	}
+
+	for _, layer := range manifest.Layers {
+		if layer.MediaType == MetadataMediaType {
+			return c.fetch(baseUrl+"/blobs/"+layer.Digest.String(), layer.MediaType, layer.Digest)
+		}
+	}
+
+	return nil, fmt.Errorf("referrer %s does not contain a layer with mediatype %s", metaManifest.Digest, MetadataMediaType)
+}
+
+// repositoryUrl returns the distribution API base url of the repository of ref
+func (c *Client) repositoryUrl(ref registry.Reference) string {
+	scheme := "https"
+	if c.plainHTTP {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s/v2/%s", scheme, ref.Registry, ref.Repository)
+}
+
+// fetch retrieves a registry resource and verifies it against the expected digest of the
+// descriptor it was referenced by. Resources referenced by tag, without a descriptor, are
+// checked against the digest reported by the registry.
+func (c *Client) fetch(resourceUrl string, mediaType string, expected digest.Digest) (*DescriptorPullSummary, error) {
+	req, err := http.NewRequest(http.MethodGet, resourceUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", mediaType)
+
+	resp, err := c.registryAuthorizer.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &statusError{url: resourceUrl, status: resp.Status, statusCode: resp.StatusCode}
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if expected == "" {
+		expected = digest.Digest(resp.Header.Get("Docker-Content-Digest"))
+	}
+
+	dataDigest := digest.FromBytes(data)
+	if expected != "" {
+		if err := expected.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid digest for %s: %w", resourceUrl, err)
+		}
+
+		if actual := expected.Algorithm().FromBytes(data); actual != expected {
+			return nil, fmt.Errorf("digest mismatch for %s: expected %s, got %s", resourceUrl, expected, actual)
+		}
+	}
+
+	return &DescriptorPullSummary{
+		Data:   data,
+		Digest: dataDigest.String(),
+		Size:   int64(len(data)),
+	}, nil
+}
@@ -21,10 +21,16 @@ var immutableOciAnnotations = []string{
 // ctx retrieves a fresh context.
 // disable verbose logging coming from ORAS (unless debug is enabled)
 func ctx(out io.Writer, debug bool) context.Context {
+	return withLogger(context.Background(), out, debug)
+}
+
+// withLogger derives a context from parent that logs ORAS output to out when
+// debug is enabled, and discards it otherwise
+func withLogger(parent context.Context, out io.Writer, debug bool) context.Context {
 	if !debug {
-		return orascontext.Background()
+		return orascontext.WithLoggerDiscarded(parent)
 	}
-	ctx := orascontext.WithLoggerFromWriter(context.Background(), out)
+	ctx := orascontext.WithLoggerFromWriter(parent, out)
 	orascontext.GetLogger(ctx).Logger.SetLevel(logrus.DebugLevel)
 	return ctx
 }